@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"distributed-systems/internal/auth"
 	internalhttp "distributed-systems/internal/http"
+	internallog "distributed-systems/internal/log"
 	"distributed-systems/internal/otel"
 	"distributed-systems/internal/server"
 	"log"
@@ -31,12 +32,51 @@ var (
 	listenAddress string
 	aclModelFile  string
 	aclPolicyFile string
+
+	logDir        string
+	maxIndexBytes uint64
+	maxStoreBytes uint64
 )
 
+var rebuildIndexCommand = &cli.Command{
+	Name:  "rebuild-index",
+	Usage: "Rebuild the segment indexes of a log directory from its store files.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "dir",
+			Usage:       "Path to the log directory.",
+			Required:    true,
+			Destination: &logDir,
+		},
+		&cli.Uint64Flag{
+			Name:        "max-index-bytes",
+			Usage:       "Maximum size of the entries of a segment index, 0 for no limit.",
+			Destination: &maxIndexBytes,
+		},
+		&cli.Uint64Flag{
+			Name:        "max-store-bytes",
+			Usage:       "Maximum size of a segment store.",
+			Value:       1024,
+			Destination: &maxStoreBytes,
+		},
+	},
+	Action: func(_ *cli.Context) error {
+		return internallog.RebuildIndex(logDir, internallog.Config{
+			Segment: internallog.Segment{
+				MaxIndexBytes: maxIndexBytes,
+				MaxStoreBytes: maxStoreBytes,
+			},
+		})
+	},
+}
+
 var app = &cli.App{
 	Name:    "distributed-systems",
 	Version: version,
 	Usage:   "Example of a distributed system",
+	Commands: []*cli.Command{
+		rebuildIndexCommand,
+	},
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:        "listen-address",
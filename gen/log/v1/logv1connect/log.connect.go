@@ -41,15 +41,66 @@ const (
 	LogAPIConsumeStreamProcedure = "/log.v1.LogAPI/ConsumeStream"
 	// LogAPIProduceStreamProcedure is the fully-qualified name of the LogAPI's ProduceStream RPC.
 	LogAPIProduceStreamProcedure = "/log.v1.LogAPI/ProduceStream"
+	// LogAPIOffsetForTimeProcedure is the fully-qualified name of the LogAPI's OffsetForTime RPC.
+	LogAPIOffsetForTimeProcedure = "/log.v1.LogAPI/OffsetForTime"
+	// LogAPICreateTopicProcedure is the fully-qualified name of the LogAPI's CreateTopic RPC.
+	LogAPICreateTopicProcedure = "/log.v1.LogAPI/CreateTopic"
+	// LogAPIDeleteTopicProcedure is the fully-qualified name of the LogAPI's DeleteTopic RPC.
+	LogAPIDeleteTopicProcedure = "/log.v1.LogAPI/DeleteTopic"
+	// LogAPIListTopicsProcedure is the fully-qualified name of the LogAPI's ListTopics RPC.
+	LogAPIListTopicsProcedure = "/log.v1.LogAPI/ListTopics"
+	// LogAPIListPartitionsProcedure is the fully-qualified name of the LogAPI's ListPartitions RPC.
+	LogAPIListPartitionsProcedure = "/log.v1.LogAPI/ListPartitions"
+	// LogAPIInitProducerProcedure is the fully-qualified name of the LogAPI's InitProducer RPC.
+	LogAPIInitProducerProcedure = "/log.v1.LogAPI/InitProducer"
+	// LogAPIBeginTxnProcedure is the fully-qualified name of the LogAPI's BeginTxn RPC.
+	LogAPIBeginTxnProcedure = "/log.v1.LogAPI/BeginTxn"
+	// LogAPIProduceTxnProcedure is the fully-qualified name of the LogAPI's ProduceTxn RPC.
+	LogAPIProduceTxnProcedure = "/log.v1.LogAPI/ProduceTxn"
+	// LogAPICommitTxnProcedure is the fully-qualified name of the LogAPI's CommitTxn RPC.
+	LogAPICommitTxnProcedure = "/log.v1.LogAPI/CommitTxn"
+	// LogAPIAbortTxnProcedure is the fully-qualified name of the LogAPI's AbortTxn RPC.
+	LogAPIAbortTxnProcedure = "/log.v1.LogAPI/AbortTxn"
+	// LogAPICommitOffsetProcedure is the fully-qualified name of the LogAPI's CommitOffset RPC.
+	LogAPICommitOffsetProcedure = "/log.v1.LogAPI/CommitOffset"
+	// LogAPIFetchOffsetProcedure is the fully-qualified name of the LogAPI's FetchOffset RPC.
+	LogAPIFetchOffsetProcedure = "/log.v1.LogAPI/FetchOffset"
+	// LogAPIListGroupsProcedure is the fully-qualified name of the LogAPI's ListGroups RPC.
+	LogAPIListGroupsProcedure = "/log.v1.LogAPI/ListGroups"
+	// LogAPIJoinGroupProcedure is the fully-qualified name of the LogAPI's JoinGroup RPC.
+	LogAPIJoinGroupProcedure = "/log.v1.LogAPI/JoinGroup"
+	// LogAPIHeartbeatProcedure is the fully-qualified name of the LogAPI's Heartbeat RPC.
+	LogAPIHeartbeatProcedure = "/log.v1.LogAPI/Heartbeat"
+	// LogAPILeaveGroupProcedure is the fully-qualified name of the LogAPI's LeaveGroup RPC.
+	LogAPILeaveGroupProcedure = "/log.v1.LogAPI/LeaveGroup"
+	// LogAPIGetOffsetsProcedure is the fully-qualified name of the LogAPI's GetOffsets RPC.
+	LogAPIGetOffsetsProcedure = "/log.v1.LogAPI/GetOffsets"
 )
 
 // These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
 var (
-	logAPIServiceDescriptor             = v1.File_log_v1_log_proto.Services().ByName("LogAPI")
-	logAPIProduceMethodDescriptor       = logAPIServiceDescriptor.Methods().ByName("Produce")
-	logAPIConsumeMethodDescriptor       = logAPIServiceDescriptor.Methods().ByName("Consume")
-	logAPIConsumeStreamMethodDescriptor = logAPIServiceDescriptor.Methods().ByName("ConsumeStream")
-	logAPIProduceStreamMethodDescriptor = logAPIServiceDescriptor.Methods().ByName("ProduceStream")
+	logAPIServiceDescriptor              = v1.File_log_v1_log_proto.Services().ByName("LogAPI")
+	logAPIProduceMethodDescriptor        = logAPIServiceDescriptor.Methods().ByName("Produce")
+	logAPIConsumeMethodDescriptor        = logAPIServiceDescriptor.Methods().ByName("Consume")
+	logAPIConsumeStreamMethodDescriptor  = logAPIServiceDescriptor.Methods().ByName("ConsumeStream")
+	logAPIProduceStreamMethodDescriptor  = logAPIServiceDescriptor.Methods().ByName("ProduceStream")
+	logAPIOffsetForTimeMethodDescriptor  = logAPIServiceDescriptor.Methods().ByName("OffsetForTime")
+	logAPICreateTopicMethodDescriptor    = logAPIServiceDescriptor.Methods().ByName("CreateTopic")
+	logAPIDeleteTopicMethodDescriptor    = logAPIServiceDescriptor.Methods().ByName("DeleteTopic")
+	logAPIListTopicsMethodDescriptor     = logAPIServiceDescriptor.Methods().ByName("ListTopics")
+	logAPIListPartitionsMethodDescriptor = logAPIServiceDescriptor.Methods().ByName("ListPartitions")
+	logAPIInitProducerMethodDescriptor   = logAPIServiceDescriptor.Methods().ByName("InitProducer")
+	logAPIBeginTxnMethodDescriptor       = logAPIServiceDescriptor.Methods().ByName("BeginTxn")
+	logAPIProduceTxnMethodDescriptor     = logAPIServiceDescriptor.Methods().ByName("ProduceTxn")
+	logAPICommitTxnMethodDescriptor      = logAPIServiceDescriptor.Methods().ByName("CommitTxn")
+	logAPIAbortTxnMethodDescriptor       = logAPIServiceDescriptor.Methods().ByName("AbortTxn")
+	logAPICommitOffsetMethodDescriptor   = logAPIServiceDescriptor.Methods().ByName("CommitOffset")
+	logAPIFetchOffsetMethodDescriptor    = logAPIServiceDescriptor.Methods().ByName("FetchOffset")
+	logAPIListGroupsMethodDescriptor     = logAPIServiceDescriptor.Methods().ByName("ListGroups")
+	logAPIJoinGroupMethodDescriptor      = logAPIServiceDescriptor.Methods().ByName("JoinGroup")
+	logAPIHeartbeatMethodDescriptor      = logAPIServiceDescriptor.Methods().ByName("Heartbeat")
+	logAPILeaveGroupMethodDescriptor     = logAPIServiceDescriptor.Methods().ByName("LeaveGroup")
+	logAPIGetOffsetsMethodDescriptor     = logAPIServiceDescriptor.Methods().ByName("GetOffsets")
 )
 
 // LogAPIClient is a client for the log.v1.LogAPI service.
@@ -58,6 +109,57 @@ type LogAPIClient interface {
 	Consume(context.Context, *connect.Request[v1.ConsumeRequest]) (*connect.Response[v1.ConsumeResponse], error)
 	ConsumeStream(context.Context, *connect.Request[v1.ConsumeStreamRequest]) (*connect.ServerStreamForClient[v1.ConsumeStreamResponse], error)
 	ProduceStream(context.Context) *connect.BidiStreamForClient[v1.ProduceStreamRequest, v1.ProduceStreamResponse]
+	// OffsetForTime returns the offset of the first record appended at or after
+	// the given time, or the next offset if there is none.
+	OffsetForTime(context.Context, *connect.Request[v1.OffsetForTimeRequest]) (*connect.Response[v1.OffsetForTimeResponse], error)
+	// CreateTopic creates a topic on every node of the cluster.
+	CreateTopic(context.Context, *connect.Request[v1.CreateTopicRequest]) (*connect.Response[v1.CreateTopicResponse], error)
+	// DeleteTopic deletes a topic and its records on every node of the cluster.
+	DeleteTopic(context.Context, *connect.Request[v1.DeleteTopicRequest]) (*connect.Response[v1.DeleteTopicResponse], error)
+	// ListTopics returns the topics, sorted by name. The default topic is not
+	// listed.
+	ListTopics(context.Context, *connect.Request[v1.ListTopicsRequest]) (*connect.Response[v1.ListTopicsResponse], error)
+	// ListPartitions returns the partitions of a topic and the nodes owning
+	// them.
+	ListPartitions(context.Context, *connect.Request[v1.ListPartitionsRequest]) (*connect.Response[v1.ListPartitionsResponse], error)
+	// InitProducer returns a new producer ID for an idempotent producer.
+	InitProducer(context.Context, *connect.Request[v1.InitProducerRequest]) (*connect.Response[v1.InitProducerResponse], error)
+	// BeginTxn begins a transaction whose records are appended together when
+	// it commits, or not at all.
+	//
+	// The records of a transaction are staged by the node which began it, and
+	// appended in a single Raft entry when it commits. The consumers never read
+	// the records of an aborted or ongoing transaction.
+	BeginTxn(context.Context, *connect.Request[v1.BeginTxnRequest]) (*connect.Response[v1.BeginTxnResponse], error)
+	// ProduceTxn stages a record in a transaction.
+	ProduceTxn(context.Context, *connect.Request[v1.ProduceTxnRequest]) (*connect.Response[v1.ProduceTxnResponse], error)
+	// CommitTxn appends the records of a transaction.
+	CommitTxn(context.Context, *connect.Request[v1.CommitTxnRequest]) (*connect.Response[v1.CommitTxnResponse], error)
+	// AbortTxn drops the records of a transaction.
+	AbortTxn(context.Context, *connect.Request[v1.AbortTxnRequest]) (*connect.Response[v1.AbortTxnResponse], error)
+	// CommitOffset commits the offset a consumer group consumes a partition
+	// from, on every node of the cluster.
+	CommitOffset(context.Context, *connect.Request[v1.CommitOffsetRequest]) (*connect.Response[v1.CommitOffsetResponse], error)
+	// FetchOffset returns the offset committed by a consumer group for a
+	// partition.
+	FetchOffset(context.Context, *connect.Request[v1.FetchOffsetRequest]) (*connect.Response[v1.FetchOffsetResponse], error)
+	// ListGroups returns the consumer groups, sorted by name, and their lag.
+	ListGroups(context.Context, *connect.Request[v1.ListGroupsRequest]) (*connect.Response[v1.ListGroupsResponse], error)
+	// JoinGroup joins a consumer to a consumer group sharing the partitions of
+	// a topic, and returns the partitions assigned to it.
+	//
+	// The partitions are assigned again, in ranges, each time a consumer joins
+	// or leaves the group, and the generation of the group is incremented.
+	JoinGroup(context.Context, *connect.Request[v1.JoinGroupRequest]) (*connect.Response[v1.JoinGroupResponse], error)
+	// Heartbeat keeps a consumer in its group, and returns the partitions
+	// assigned to it in the current generation. The consumers which do not
+	// send a heartbeat within their session timeout leave the group.
+	Heartbeat(context.Context, *connect.Request[v1.HeartbeatRequest]) (*connect.Response[v1.HeartbeatResponse], error)
+	// LeaveGroup removes a consumer from its group.
+	LeaveGroup(context.Context, *connect.Request[v1.LeaveGroupRequest]) (*connect.Response[v1.LeaveGroupResponse], error)
+	// GetOffsets returns the bounds of a partition on the node serving the
+	// request, and the progress of the replication.
+	GetOffsets(context.Context, *connect.Request[v1.GetOffsetsRequest]) (*connect.Response[v1.GetOffsetsResponse], error)
 }
 
 // NewLogAPIClient constructs a client for the log.v1.LogAPI service. By default, it uses the
@@ -94,15 +196,134 @@ func NewLogAPIClient(httpClient connect.HTTPClient, baseURL string, opts ...conn
 			connect.WithSchema(logAPIProduceStreamMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		offsetForTime: connect.NewClient[v1.OffsetForTimeRequest, v1.OffsetForTimeResponse](
+			httpClient,
+			baseURL+LogAPIOffsetForTimeProcedure,
+			connect.WithSchema(logAPIOffsetForTimeMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		createTopic: connect.NewClient[v1.CreateTopicRequest, v1.CreateTopicResponse](
+			httpClient,
+			baseURL+LogAPICreateTopicProcedure,
+			connect.WithSchema(logAPICreateTopicMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		deleteTopic: connect.NewClient[v1.DeleteTopicRequest, v1.DeleteTopicResponse](
+			httpClient,
+			baseURL+LogAPIDeleteTopicProcedure,
+			connect.WithSchema(logAPIDeleteTopicMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		listTopics: connect.NewClient[v1.ListTopicsRequest, v1.ListTopicsResponse](
+			httpClient,
+			baseURL+LogAPIListTopicsProcedure,
+			connect.WithSchema(logAPIListTopicsMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		listPartitions: connect.NewClient[v1.ListPartitionsRequest, v1.ListPartitionsResponse](
+			httpClient,
+			baseURL+LogAPIListPartitionsProcedure,
+			connect.WithSchema(logAPIListPartitionsMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		initProducer: connect.NewClient[v1.InitProducerRequest, v1.InitProducerResponse](
+			httpClient,
+			baseURL+LogAPIInitProducerProcedure,
+			connect.WithSchema(logAPIInitProducerMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		beginTxn: connect.NewClient[v1.BeginTxnRequest, v1.BeginTxnResponse](
+			httpClient,
+			baseURL+LogAPIBeginTxnProcedure,
+			connect.WithSchema(logAPIBeginTxnMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		produceTxn: connect.NewClient[v1.ProduceTxnRequest, v1.ProduceTxnResponse](
+			httpClient,
+			baseURL+LogAPIProduceTxnProcedure,
+			connect.WithSchema(logAPIProduceTxnMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		commitTxn: connect.NewClient[v1.CommitTxnRequest, v1.CommitTxnResponse](
+			httpClient,
+			baseURL+LogAPICommitTxnProcedure,
+			connect.WithSchema(logAPICommitTxnMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		abortTxn: connect.NewClient[v1.AbortTxnRequest, v1.AbortTxnResponse](
+			httpClient,
+			baseURL+LogAPIAbortTxnProcedure,
+			connect.WithSchema(logAPIAbortTxnMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		commitOffset: connect.NewClient[v1.CommitOffsetRequest, v1.CommitOffsetResponse](
+			httpClient,
+			baseURL+LogAPICommitOffsetProcedure,
+			connect.WithSchema(logAPICommitOffsetMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		fetchOffset: connect.NewClient[v1.FetchOffsetRequest, v1.FetchOffsetResponse](
+			httpClient,
+			baseURL+LogAPIFetchOffsetProcedure,
+			connect.WithSchema(logAPIFetchOffsetMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		listGroups: connect.NewClient[v1.ListGroupsRequest, v1.ListGroupsResponse](
+			httpClient,
+			baseURL+LogAPIListGroupsProcedure,
+			connect.WithSchema(logAPIListGroupsMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		joinGroup: connect.NewClient[v1.JoinGroupRequest, v1.JoinGroupResponse](
+			httpClient,
+			baseURL+LogAPIJoinGroupProcedure,
+			connect.WithSchema(logAPIJoinGroupMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		heartbeat: connect.NewClient[v1.HeartbeatRequest, v1.HeartbeatResponse](
+			httpClient,
+			baseURL+LogAPIHeartbeatProcedure,
+			connect.WithSchema(logAPIHeartbeatMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		leaveGroup: connect.NewClient[v1.LeaveGroupRequest, v1.LeaveGroupResponse](
+			httpClient,
+			baseURL+LogAPILeaveGroupProcedure,
+			connect.WithSchema(logAPILeaveGroupMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getOffsets: connect.NewClient[v1.GetOffsetsRequest, v1.GetOffsetsResponse](
+			httpClient,
+			baseURL+LogAPIGetOffsetsProcedure,
+			connect.WithSchema(logAPIGetOffsetsMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // logAPIClient implements LogAPIClient.
 type logAPIClient struct {
-	produce       *connect.Client[v1.ProduceRequest, v1.ProduceResponse]
-	consume       *connect.Client[v1.ConsumeRequest, v1.ConsumeResponse]
-	consumeStream *connect.Client[v1.ConsumeStreamRequest, v1.ConsumeStreamResponse]
-	produceStream *connect.Client[v1.ProduceStreamRequest, v1.ProduceStreamResponse]
+	produce        *connect.Client[v1.ProduceRequest, v1.ProduceResponse]
+	consume        *connect.Client[v1.ConsumeRequest, v1.ConsumeResponse]
+	consumeStream  *connect.Client[v1.ConsumeStreamRequest, v1.ConsumeStreamResponse]
+	produceStream  *connect.Client[v1.ProduceStreamRequest, v1.ProduceStreamResponse]
+	offsetForTime  *connect.Client[v1.OffsetForTimeRequest, v1.OffsetForTimeResponse]
+	createTopic    *connect.Client[v1.CreateTopicRequest, v1.CreateTopicResponse]
+	deleteTopic    *connect.Client[v1.DeleteTopicRequest, v1.DeleteTopicResponse]
+	listTopics     *connect.Client[v1.ListTopicsRequest, v1.ListTopicsResponse]
+	listPartitions *connect.Client[v1.ListPartitionsRequest, v1.ListPartitionsResponse]
+	initProducer   *connect.Client[v1.InitProducerRequest, v1.InitProducerResponse]
+	beginTxn       *connect.Client[v1.BeginTxnRequest, v1.BeginTxnResponse]
+	produceTxn     *connect.Client[v1.ProduceTxnRequest, v1.ProduceTxnResponse]
+	commitTxn      *connect.Client[v1.CommitTxnRequest, v1.CommitTxnResponse]
+	abortTxn       *connect.Client[v1.AbortTxnRequest, v1.AbortTxnResponse]
+	commitOffset   *connect.Client[v1.CommitOffsetRequest, v1.CommitOffsetResponse]
+	fetchOffset    *connect.Client[v1.FetchOffsetRequest, v1.FetchOffsetResponse]
+	listGroups     *connect.Client[v1.ListGroupsRequest, v1.ListGroupsResponse]
+	joinGroup      *connect.Client[v1.JoinGroupRequest, v1.JoinGroupResponse]
+	heartbeat      *connect.Client[v1.HeartbeatRequest, v1.HeartbeatResponse]
+	leaveGroup     *connect.Client[v1.LeaveGroupRequest, v1.LeaveGroupResponse]
+	getOffsets     *connect.Client[v1.GetOffsetsRequest, v1.GetOffsetsResponse]
 }
 
 // Produce calls log.v1.LogAPI.Produce.
@@ -125,12 +346,148 @@ func (c *logAPIClient) ProduceStream(ctx context.Context) *connect.BidiStreamFor
 	return c.produceStream.CallBidiStream(ctx)
 }
 
+// OffsetForTime calls log.v1.LogAPI.OffsetForTime.
+func (c *logAPIClient) OffsetForTime(ctx context.Context, req *connect.Request[v1.OffsetForTimeRequest]) (*connect.Response[v1.OffsetForTimeResponse], error) {
+	return c.offsetForTime.CallUnary(ctx, req)
+}
+
+// CreateTopic calls log.v1.LogAPI.CreateTopic.
+func (c *logAPIClient) CreateTopic(ctx context.Context, req *connect.Request[v1.CreateTopicRequest]) (*connect.Response[v1.CreateTopicResponse], error) {
+	return c.createTopic.CallUnary(ctx, req)
+}
+
+// DeleteTopic calls log.v1.LogAPI.DeleteTopic.
+func (c *logAPIClient) DeleteTopic(ctx context.Context, req *connect.Request[v1.DeleteTopicRequest]) (*connect.Response[v1.DeleteTopicResponse], error) {
+	return c.deleteTopic.CallUnary(ctx, req)
+}
+
+// ListTopics calls log.v1.LogAPI.ListTopics.
+func (c *logAPIClient) ListTopics(ctx context.Context, req *connect.Request[v1.ListTopicsRequest]) (*connect.Response[v1.ListTopicsResponse], error) {
+	return c.listTopics.CallUnary(ctx, req)
+}
+
+// ListPartitions calls log.v1.LogAPI.ListPartitions.
+func (c *logAPIClient) ListPartitions(ctx context.Context, req *connect.Request[v1.ListPartitionsRequest]) (*connect.Response[v1.ListPartitionsResponse], error) {
+	return c.listPartitions.CallUnary(ctx, req)
+}
+
+// InitProducer calls log.v1.LogAPI.InitProducer.
+func (c *logAPIClient) InitProducer(ctx context.Context, req *connect.Request[v1.InitProducerRequest]) (*connect.Response[v1.InitProducerResponse], error) {
+	return c.initProducer.CallUnary(ctx, req)
+}
+
+// BeginTxn calls log.v1.LogAPI.BeginTxn.
+func (c *logAPIClient) BeginTxn(ctx context.Context, req *connect.Request[v1.BeginTxnRequest]) (*connect.Response[v1.BeginTxnResponse], error) {
+	return c.beginTxn.CallUnary(ctx, req)
+}
+
+// ProduceTxn calls log.v1.LogAPI.ProduceTxn.
+func (c *logAPIClient) ProduceTxn(ctx context.Context, req *connect.Request[v1.ProduceTxnRequest]) (*connect.Response[v1.ProduceTxnResponse], error) {
+	return c.produceTxn.CallUnary(ctx, req)
+}
+
+// CommitTxn calls log.v1.LogAPI.CommitTxn.
+func (c *logAPIClient) CommitTxn(ctx context.Context, req *connect.Request[v1.CommitTxnRequest]) (*connect.Response[v1.CommitTxnResponse], error) {
+	return c.commitTxn.CallUnary(ctx, req)
+}
+
+// AbortTxn calls log.v1.LogAPI.AbortTxn.
+func (c *logAPIClient) AbortTxn(ctx context.Context, req *connect.Request[v1.AbortTxnRequest]) (*connect.Response[v1.AbortTxnResponse], error) {
+	return c.abortTxn.CallUnary(ctx, req)
+}
+
+// CommitOffset calls log.v1.LogAPI.CommitOffset.
+func (c *logAPIClient) CommitOffset(ctx context.Context, req *connect.Request[v1.CommitOffsetRequest]) (*connect.Response[v1.CommitOffsetResponse], error) {
+	return c.commitOffset.CallUnary(ctx, req)
+}
+
+// FetchOffset calls log.v1.LogAPI.FetchOffset.
+func (c *logAPIClient) FetchOffset(ctx context.Context, req *connect.Request[v1.FetchOffsetRequest]) (*connect.Response[v1.FetchOffsetResponse], error) {
+	return c.fetchOffset.CallUnary(ctx, req)
+}
+
+// ListGroups calls log.v1.LogAPI.ListGroups.
+func (c *logAPIClient) ListGroups(ctx context.Context, req *connect.Request[v1.ListGroupsRequest]) (*connect.Response[v1.ListGroupsResponse], error) {
+	return c.listGroups.CallUnary(ctx, req)
+}
+
+// JoinGroup calls log.v1.LogAPI.JoinGroup.
+func (c *logAPIClient) JoinGroup(ctx context.Context, req *connect.Request[v1.JoinGroupRequest]) (*connect.Response[v1.JoinGroupResponse], error) {
+	return c.joinGroup.CallUnary(ctx, req)
+}
+
+// Heartbeat calls log.v1.LogAPI.Heartbeat.
+func (c *logAPIClient) Heartbeat(ctx context.Context, req *connect.Request[v1.HeartbeatRequest]) (*connect.Response[v1.HeartbeatResponse], error) {
+	return c.heartbeat.CallUnary(ctx, req)
+}
+
+// LeaveGroup calls log.v1.LogAPI.LeaveGroup.
+func (c *logAPIClient) LeaveGroup(ctx context.Context, req *connect.Request[v1.LeaveGroupRequest]) (*connect.Response[v1.LeaveGroupResponse], error) {
+	return c.leaveGroup.CallUnary(ctx, req)
+}
+
+// GetOffsets calls log.v1.LogAPI.GetOffsets.
+func (c *logAPIClient) GetOffsets(ctx context.Context, req *connect.Request[v1.GetOffsetsRequest]) (*connect.Response[v1.GetOffsetsResponse], error) {
+	return c.getOffsets.CallUnary(ctx, req)
+}
+
 // LogAPIHandler is an implementation of the log.v1.LogAPI service.
 type LogAPIHandler interface {
 	Produce(context.Context, *connect.Request[v1.ProduceRequest]) (*connect.Response[v1.ProduceResponse], error)
 	Consume(context.Context, *connect.Request[v1.ConsumeRequest]) (*connect.Response[v1.ConsumeResponse], error)
 	ConsumeStream(context.Context, *connect.Request[v1.ConsumeStreamRequest], *connect.ServerStream[v1.ConsumeStreamResponse]) error
 	ProduceStream(context.Context, *connect.BidiStream[v1.ProduceStreamRequest, v1.ProduceStreamResponse]) error
+	// OffsetForTime returns the offset of the first record appended at or after
+	// the given time, or the next offset if there is none.
+	OffsetForTime(context.Context, *connect.Request[v1.OffsetForTimeRequest]) (*connect.Response[v1.OffsetForTimeResponse], error)
+	// CreateTopic creates a topic on every node of the cluster.
+	CreateTopic(context.Context, *connect.Request[v1.CreateTopicRequest]) (*connect.Response[v1.CreateTopicResponse], error)
+	// DeleteTopic deletes a topic and its records on every node of the cluster.
+	DeleteTopic(context.Context, *connect.Request[v1.DeleteTopicRequest]) (*connect.Response[v1.DeleteTopicResponse], error)
+	// ListTopics returns the topics, sorted by name. The default topic is not
+	// listed.
+	ListTopics(context.Context, *connect.Request[v1.ListTopicsRequest]) (*connect.Response[v1.ListTopicsResponse], error)
+	// ListPartitions returns the partitions of a topic and the nodes owning
+	// them.
+	ListPartitions(context.Context, *connect.Request[v1.ListPartitionsRequest]) (*connect.Response[v1.ListPartitionsResponse], error)
+	// InitProducer returns a new producer ID for an idempotent producer.
+	InitProducer(context.Context, *connect.Request[v1.InitProducerRequest]) (*connect.Response[v1.InitProducerResponse], error)
+	// BeginTxn begins a transaction whose records are appended together when
+	// it commits, or not at all.
+	//
+	// The records of a transaction are staged by the node which began it, and
+	// appended in a single Raft entry when it commits. The consumers never read
+	// the records of an aborted or ongoing transaction.
+	BeginTxn(context.Context, *connect.Request[v1.BeginTxnRequest]) (*connect.Response[v1.BeginTxnResponse], error)
+	// ProduceTxn stages a record in a transaction.
+	ProduceTxn(context.Context, *connect.Request[v1.ProduceTxnRequest]) (*connect.Response[v1.ProduceTxnResponse], error)
+	// CommitTxn appends the records of a transaction.
+	CommitTxn(context.Context, *connect.Request[v1.CommitTxnRequest]) (*connect.Response[v1.CommitTxnResponse], error)
+	// AbortTxn drops the records of a transaction.
+	AbortTxn(context.Context, *connect.Request[v1.AbortTxnRequest]) (*connect.Response[v1.AbortTxnResponse], error)
+	// CommitOffset commits the offset a consumer group consumes a partition
+	// from, on every node of the cluster.
+	CommitOffset(context.Context, *connect.Request[v1.CommitOffsetRequest]) (*connect.Response[v1.CommitOffsetResponse], error)
+	// FetchOffset returns the offset committed by a consumer group for a
+	// partition.
+	FetchOffset(context.Context, *connect.Request[v1.FetchOffsetRequest]) (*connect.Response[v1.FetchOffsetResponse], error)
+	// ListGroups returns the consumer groups, sorted by name, and their lag.
+	ListGroups(context.Context, *connect.Request[v1.ListGroupsRequest]) (*connect.Response[v1.ListGroupsResponse], error)
+	// JoinGroup joins a consumer to a consumer group sharing the partitions of
+	// a topic, and returns the partitions assigned to it.
+	//
+	// The partitions are assigned again, in ranges, each time a consumer joins
+	// or leaves the group, and the generation of the group is incremented.
+	JoinGroup(context.Context, *connect.Request[v1.JoinGroupRequest]) (*connect.Response[v1.JoinGroupResponse], error)
+	// Heartbeat keeps a consumer in its group, and returns the partitions
+	// assigned to it in the current generation. The consumers which do not
+	// send a heartbeat within their session timeout leave the group.
+	Heartbeat(context.Context, *connect.Request[v1.HeartbeatRequest]) (*connect.Response[v1.HeartbeatResponse], error)
+	// LeaveGroup removes a consumer from its group.
+	LeaveGroup(context.Context, *connect.Request[v1.LeaveGroupRequest]) (*connect.Response[v1.LeaveGroupResponse], error)
+	// GetOffsets returns the bounds of a partition on the node serving the
+	// request, and the progress of the replication.
+	GetOffsets(context.Context, *connect.Request[v1.GetOffsetsRequest]) (*connect.Response[v1.GetOffsetsResponse], error)
 }
 
 // NewLogAPIHandler builds an HTTP handler from the service implementation. It returns the path on
@@ -163,6 +520,108 @@ func NewLogAPIHandler(svc LogAPIHandler, opts ...connect.HandlerOption) (string,
 		connect.WithSchema(logAPIProduceStreamMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	logAPIOffsetForTimeHandler := connect.NewUnaryHandler(
+		LogAPIOffsetForTimeProcedure,
+		svc.OffsetForTime,
+		connect.WithSchema(logAPIOffsetForTimeMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPICreateTopicHandler := connect.NewUnaryHandler(
+		LogAPICreateTopicProcedure,
+		svc.CreateTopic,
+		connect.WithSchema(logAPICreateTopicMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIDeleteTopicHandler := connect.NewUnaryHandler(
+		LogAPIDeleteTopicProcedure,
+		svc.DeleteTopic,
+		connect.WithSchema(logAPIDeleteTopicMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIListTopicsHandler := connect.NewUnaryHandler(
+		LogAPIListTopicsProcedure,
+		svc.ListTopics,
+		connect.WithSchema(logAPIListTopicsMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIListPartitionsHandler := connect.NewUnaryHandler(
+		LogAPIListPartitionsProcedure,
+		svc.ListPartitions,
+		connect.WithSchema(logAPIListPartitionsMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIInitProducerHandler := connect.NewUnaryHandler(
+		LogAPIInitProducerProcedure,
+		svc.InitProducer,
+		connect.WithSchema(logAPIInitProducerMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIBeginTxnHandler := connect.NewUnaryHandler(
+		LogAPIBeginTxnProcedure,
+		svc.BeginTxn,
+		connect.WithSchema(logAPIBeginTxnMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIProduceTxnHandler := connect.NewUnaryHandler(
+		LogAPIProduceTxnProcedure,
+		svc.ProduceTxn,
+		connect.WithSchema(logAPIProduceTxnMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPICommitTxnHandler := connect.NewUnaryHandler(
+		LogAPICommitTxnProcedure,
+		svc.CommitTxn,
+		connect.WithSchema(logAPICommitTxnMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIAbortTxnHandler := connect.NewUnaryHandler(
+		LogAPIAbortTxnProcedure,
+		svc.AbortTxn,
+		connect.WithSchema(logAPIAbortTxnMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPICommitOffsetHandler := connect.NewUnaryHandler(
+		LogAPICommitOffsetProcedure,
+		svc.CommitOffset,
+		connect.WithSchema(logAPICommitOffsetMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIFetchOffsetHandler := connect.NewUnaryHandler(
+		LogAPIFetchOffsetProcedure,
+		svc.FetchOffset,
+		connect.WithSchema(logAPIFetchOffsetMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIListGroupsHandler := connect.NewUnaryHandler(
+		LogAPIListGroupsProcedure,
+		svc.ListGroups,
+		connect.WithSchema(logAPIListGroupsMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIJoinGroupHandler := connect.NewUnaryHandler(
+		LogAPIJoinGroupProcedure,
+		svc.JoinGroup,
+		connect.WithSchema(logAPIJoinGroupMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIHeartbeatHandler := connect.NewUnaryHandler(
+		LogAPIHeartbeatProcedure,
+		svc.Heartbeat,
+		connect.WithSchema(logAPIHeartbeatMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPILeaveGroupHandler := connect.NewUnaryHandler(
+		LogAPILeaveGroupProcedure,
+		svc.LeaveGroup,
+		connect.WithSchema(logAPILeaveGroupMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	logAPIGetOffsetsHandler := connect.NewUnaryHandler(
+		LogAPIGetOffsetsProcedure,
+		svc.GetOffsets,
+		connect.WithSchema(logAPIGetOffsetsMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/log.v1.LogAPI/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case LogAPIProduceProcedure:
@@ -173,6 +632,40 @@ func NewLogAPIHandler(svc LogAPIHandler, opts ...connect.HandlerOption) (string,
 			logAPIConsumeStreamHandler.ServeHTTP(w, r)
 		case LogAPIProduceStreamProcedure:
 			logAPIProduceStreamHandler.ServeHTTP(w, r)
+		case LogAPIOffsetForTimeProcedure:
+			logAPIOffsetForTimeHandler.ServeHTTP(w, r)
+		case LogAPICreateTopicProcedure:
+			logAPICreateTopicHandler.ServeHTTP(w, r)
+		case LogAPIDeleteTopicProcedure:
+			logAPIDeleteTopicHandler.ServeHTTP(w, r)
+		case LogAPIListTopicsProcedure:
+			logAPIListTopicsHandler.ServeHTTP(w, r)
+		case LogAPIListPartitionsProcedure:
+			logAPIListPartitionsHandler.ServeHTTP(w, r)
+		case LogAPIInitProducerProcedure:
+			logAPIInitProducerHandler.ServeHTTP(w, r)
+		case LogAPIBeginTxnProcedure:
+			logAPIBeginTxnHandler.ServeHTTP(w, r)
+		case LogAPIProduceTxnProcedure:
+			logAPIProduceTxnHandler.ServeHTTP(w, r)
+		case LogAPICommitTxnProcedure:
+			logAPICommitTxnHandler.ServeHTTP(w, r)
+		case LogAPIAbortTxnProcedure:
+			logAPIAbortTxnHandler.ServeHTTP(w, r)
+		case LogAPICommitOffsetProcedure:
+			logAPICommitOffsetHandler.ServeHTTP(w, r)
+		case LogAPIFetchOffsetProcedure:
+			logAPIFetchOffsetHandler.ServeHTTP(w, r)
+		case LogAPIListGroupsProcedure:
+			logAPIListGroupsHandler.ServeHTTP(w, r)
+		case LogAPIJoinGroupProcedure:
+			logAPIJoinGroupHandler.ServeHTTP(w, r)
+		case LogAPIHeartbeatProcedure:
+			logAPIHeartbeatHandler.ServeHTTP(w, r)
+		case LogAPILeaveGroupProcedure:
+			logAPILeaveGroupHandler.ServeHTTP(w, r)
+		case LogAPIGetOffsetsProcedure:
+			logAPIGetOffsetsHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -197,3 +690,71 @@ func (UnimplementedLogAPIHandler) ConsumeStream(context.Context, *connect.Reques
 func (UnimplementedLogAPIHandler) ProduceStream(context.Context, *connect.BidiStream[v1.ProduceStreamRequest, v1.ProduceStreamResponse]) error {
 	return connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.ProduceStream is not implemented"))
 }
+
+func (UnimplementedLogAPIHandler) OffsetForTime(context.Context, *connect.Request[v1.OffsetForTimeRequest]) (*connect.Response[v1.OffsetForTimeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.OffsetForTime is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) CreateTopic(context.Context, *connect.Request[v1.CreateTopicRequest]) (*connect.Response[v1.CreateTopicResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.CreateTopic is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) DeleteTopic(context.Context, *connect.Request[v1.DeleteTopicRequest]) (*connect.Response[v1.DeleteTopicResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.DeleteTopic is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) ListTopics(context.Context, *connect.Request[v1.ListTopicsRequest]) (*connect.Response[v1.ListTopicsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.ListTopics is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) ListPartitions(context.Context, *connect.Request[v1.ListPartitionsRequest]) (*connect.Response[v1.ListPartitionsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.ListPartitions is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) InitProducer(context.Context, *connect.Request[v1.InitProducerRequest]) (*connect.Response[v1.InitProducerResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.InitProducer is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) BeginTxn(context.Context, *connect.Request[v1.BeginTxnRequest]) (*connect.Response[v1.BeginTxnResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.BeginTxn is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) ProduceTxn(context.Context, *connect.Request[v1.ProduceTxnRequest]) (*connect.Response[v1.ProduceTxnResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.ProduceTxn is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) CommitTxn(context.Context, *connect.Request[v1.CommitTxnRequest]) (*connect.Response[v1.CommitTxnResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.CommitTxn is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) AbortTxn(context.Context, *connect.Request[v1.AbortTxnRequest]) (*connect.Response[v1.AbortTxnResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.AbortTxn is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) CommitOffset(context.Context, *connect.Request[v1.CommitOffsetRequest]) (*connect.Response[v1.CommitOffsetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.CommitOffset is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) FetchOffset(context.Context, *connect.Request[v1.FetchOffsetRequest]) (*connect.Response[v1.FetchOffsetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.FetchOffset is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) ListGroups(context.Context, *connect.Request[v1.ListGroupsRequest]) (*connect.Response[v1.ListGroupsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.ListGroups is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) JoinGroup(context.Context, *connect.Request[v1.JoinGroupRequest]) (*connect.Response[v1.JoinGroupResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.JoinGroup is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) Heartbeat(context.Context, *connect.Request[v1.HeartbeatRequest]) (*connect.Response[v1.HeartbeatResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.Heartbeat is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) LeaveGroup(context.Context, *connect.Request[v1.LeaveGroupRequest]) (*connect.Response[v1.LeaveGroupResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.LeaveGroup is not implemented"))
+}
+
+func (UnimplementedLogAPIHandler) GetOffsets(context.Context, *connect.Request[v1.GetOffsetsRequest]) (*connect.Response[v1.GetOffsetsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("log.v1.LogAPI.GetOffsets is not implemented"))
+}
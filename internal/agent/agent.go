@@ -37,6 +37,22 @@ type Config struct {
 	ACLModelFile       string
 	ACLPolicyFile      string
 	Bootstrap          bool
+	// SyncPolicy describes when the log segments are synced to stable storage.
+	SyncPolicy log.SyncPolicy
+	// Compression is the codec used to compress the log records.
+	Compression log.Codec
+	// Backend is the storage of the Raft log.
+	Backend log.Backend
+	// Retention describes when the oldest records of the partitions are
+	// deleted.
+	Retention log.Retention
+	// Compaction describes the key-based compaction of the partitions.
+	Compaction log.Compaction
+	// Tiering describes the offloading of the partitions to an archive.
+	Tiering log.Tiering
+	// ConsumeStreamKeepalive is the interval after which a keepalive is sent
+	// on the idle consume streams. No keepalive is sent if zero.
+	ConsumeStreamKeepalive time.Duration
 }
 
 // Agent is used for distributed logs using replication.
@@ -116,12 +132,37 @@ func (a *Agent) setupLog() error {
 			},
 			Bootstrap: a.Config.Bootstrap,
 		},
+		Segment: log.Segment{
+			SyncPolicy:  a.Config.SyncPolicy,
+			Compression: a.Config.Compression,
+		},
+		Backend:    a.Config.Backend,
+		Retention:  a.Config.Retention,
+		Compaction: a.Config.Compaction,
+		Tiering:    a.Config.Tiering,
 	}
 	var err error
 	a.log, err = distributed.NewLog(a.DataDir, cfg)
 	if err != nil {
 		return err
 	}
+	slog.Info(
+		"log started",
+		"dir",
+		a.DataDir,
+		"sync_policy",
+		cfg.Segment.SyncPolicy.String(),
+		"compression",
+		cfg.Segment.Compression.String(),
+		"backend",
+		cfg.Backend.String(),
+		"retention_interval",
+		cfg.Retention.CheckInterval,
+		"compaction_interval",
+		cfg.Compaction.CheckInterval,
+		"tiering",
+		cfg.Tiering.Archive != nil,
+	)
 	if a.Config.Bootstrap {
 		err = a.log.WaitForLeader(3 * time.Second)
 	}
@@ -145,7 +186,14 @@ func (a *Agent) setupServer() error {
 	r := http.NewServeMux()
 	path, handler := server.NewLogAPIHandler(
 		&server.Config{
-			CommitLog: a.log,
+			CommitLog:    a.log,
+			Topics:       topicRegistry{a.log},
+			Producers:    a.log,
+			Transactions: a.log,
+			Groups:       a.log,
+			Coordinator:  a.log,
+			Replication:  a.log,
+			Keepalive:    a.Config.ConsumeStreamKeepalive,
 		},
 		opts...,
 	)
@@ -167,6 +215,32 @@ func (a *Agent) setupServer() error {
 	return err
 }
 
+// topicRegistry serves the topics of the distributed log.
+type topicRegistry struct {
+	*distributed.Log
+}
+
+func (r topicRegistry) Topic(name string) (server.Topic, error) {
+	t, err := r.Log.Topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return topic{t}, nil
+}
+
+// topic serves the partitions of a topic of the distributed log.
+type topic struct {
+	*distributed.Topic
+}
+
+func (t topic) Partition(p uint32) (server.CommitLog, error) {
+	partition, err := t.Topic.Partition(p)
+	if err != nil {
+		return nil, err
+	}
+	return partition, nil
+}
+
 func (a *Agent) setupMembership() error {
 	rpcAddr, err := a.Config.RPCAddress()
 	if err != nil {
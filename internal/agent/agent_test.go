@@ -17,6 +17,7 @@ import (
 
 	"connectrpc.com/connect"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -48,6 +49,8 @@ func TestAgent(t *testing.T) {
 	)
 	require.NoError(t, err)
 
+	// Each node stores its Raft log in another backend.
+	backends := []log.Backend{log.BackendSegments, log.BackendPebble, log.BackendMemory}
 	var agents []*agent.Agent
 	for i := 0; i < 3; i++ {
 		port, err := net.GetAvailablePort()
@@ -78,6 +81,9 @@ func TestAgent(t *testing.T) {
 			ServerTLSConfig:    &serverTLSConfig,
 			PeerTLSConfig:      peerTLSConfig,
 			Bootstrap:          i == 0,
+			Backend:            backends[i],
+			Retention:          log.Retention{CheckInterval: time.Second},
+			Compaction:         log.Compaction{CheckInterval: time.Second},
 		})
 		require.NoError(t, err)
 
@@ -145,6 +151,210 @@ func TestAgent(t *testing.T) {
 	got := connect.CodeOf(err)
 	want := connect.CodeOf(server.WrapToConnectError(log.ErrOffsetOutOfRange{}))
 	require.Equal(t, want, got)
+
+	// The leader reports the bounds of the log and the Raft entries stored by
+	// every node.
+	offsetsResponse, err := leaderClient.GetOffsets(
+		context.Background(),
+		&connect.Request[logv1.GetOffsetsRequest]{Msg: &logv1.GetOffsetsRequest{}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, produceResponse.Msg.Offset+1, offsetsResponse.Msg.NextOffset)
+	replication := offsetsResponse.Msg.Replication
+	require.Len(t, replication.Replicas, len(agents))
+	for _, replica := range replication.Replicas {
+		require.NotNil(t, replica.MatchIndex)
+		require.LessOrEqual(t, *replica.MatchIndex, replication.LastIndex)
+	}
+
+	// The topics are replicated to every node.
+	_, err = leaderClient.CreateTopic(
+		context.Background(),
+		&connect.Request[logv1.CreateTopicRequest]{Msg: &logv1.CreateTopicRequest{
+			Topic: &logv1.Topic{
+				Name:   "orders",
+				Config: &logv1.TopicConfig{Partitions: 2},
+			},
+		}},
+	)
+	require.NoError(t, err)
+	produceResponse, err = leaderClient.Produce(
+		context.Background(),
+		&connect.Request[logv1.ProduceRequest]{Msg: &logv1.ProduceRequest{
+			Topic:  "orders",
+			Record: &logv1.Record{Key: []byte("customer-1"), Value: []byte("order")},
+		}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produceResponse.Msg.Offset)
+	partition := produceResponse.Msg.Partition
+	require.Eventually(t, func() bool {
+		consumeResponse, err := followerClient.Consume(
+			context.Background(),
+			&connect.Request[logv1.ConsumeRequest]{Msg: &logv1.ConsumeRequest{
+				Topic:     "orders",
+				Partition: partition,
+			}},
+		)
+		return err == nil && string(consumeResponse.Msg.Record.Value) == "order"
+	}, 3*time.Second, 50*time.Millisecond)
+	listResponse, err := followerClient.ListTopics(
+		context.Background(),
+		&connect.Request[logv1.ListTopicsRequest]{Msg: &logv1.ListTopicsRequest{}},
+	)
+	require.NoError(t, err)
+	require.Len(t, listResponse.Msg.Topics, 1)
+	require.Equal(t, "orders", listResponse.Msg.Topics[0].Name)
+
+	// Every node reports the leader as the owner of the partitions.
+	partitionsResponse, err := followerClient.ListPartitions(
+		context.Background(),
+		&connect.Request[logv1.ListPartitionsRequest]{Msg: &logv1.ListPartitionsRequest{
+			Topic: "orders",
+		}},
+	)
+	require.NoError(t, err)
+	require.Len(t, partitionsResponse.Msg.Partitions, 2)
+	for _, p := range partitionsResponse.Msg.Partitions {
+		require.Equal(t, "0", p.Leader)
+		require.ElementsMatch(t, []string{"0", "1", "2"}, p.Replicas)
+	}
+	require.Equal(t, uint64(1), partitionsResponse.Msg.Partitions[partition].NextOffset)
+
+	// A record of an idempotent producer produced again is not appended again.
+	initResponse, err := leaderClient.InitProducer(
+		context.Background(),
+		&connect.Request[logv1.InitProducerRequest]{Msg: &logv1.InitProducerRequest{}},
+	)
+	require.NoError(t, err)
+	var offsets []uint64
+	for i := 0; i < 2; i++ {
+		produceResponse, err = leaderClient.Produce(
+			context.Background(),
+			&connect.Request[logv1.ProduceRequest]{Msg: &logv1.ProduceRequest{
+				Topic:      "orders",
+				Record:     &logv1.Record{Value: []byte("retried")},
+				ProducerId: initResponse.Msg.ProducerId,
+			}},
+		)
+		require.NoError(t, err)
+		offsets = append(offsets, produceResponse.Msg.Offset)
+	}
+	require.Equal(t, offsets[0], offsets[1])
+
+	// The records of a transaction are appended when it commits, and the
+	// records of an aborted transaction are not.
+	beginResponse, err := leaderClient.BeginTxn(
+		context.Background(),
+		&connect.Request[logv1.BeginTxnRequest]{Msg: &logv1.BeginTxnRequest{}},
+	)
+	require.NoError(t, err)
+	aborted := beginResponse.Msg.TxnId
+	beginResponse, err = leaderClient.BeginTxn(
+		context.Background(),
+		&connect.Request[logv1.BeginTxnRequest]{Msg: &logv1.BeginTxnRequest{}},
+	)
+	require.NoError(t, err)
+	committed := beginResponse.Msg.TxnId
+	for _, txnID := range []uint64{aborted, committed} {
+		for _, topic := range []string{"orders", ""} {
+			_, err = leaderClient.ProduceTxn(
+				context.Background(),
+				&connect.Request[logv1.ProduceTxnRequest]{Msg: &logv1.ProduceTxnRequest{
+					TxnId:  txnID,
+					Topic:  topic,
+					Record: &logv1.Record{Key: []byte("customer-1"), Value: []byte("txn")},
+				}},
+			)
+			require.NoError(t, err)
+		}
+	}
+	_, err = leaderClient.AbortTxn(
+		context.Background(),
+		&connect.Request[logv1.AbortTxnRequest]{Msg: &logv1.AbortTxnRequest{TxnId: aborted}},
+	)
+	require.NoError(t, err)
+	_, err = leaderClient.CommitTxn(
+		context.Background(),
+		&connect.Request[logv1.CommitTxnRequest]{Msg: &logv1.CommitTxnRequest{TxnId: aborted}},
+	)
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	commitResponse, err := leaderClient.CommitTxn(
+		context.Background(),
+		&connect.Request[logv1.CommitTxnRequest]{Msg: &logv1.CommitTxnRequest{TxnId: committed}},
+	)
+	require.NoError(t, err)
+	require.Len(t, commitResponse.Msg.Records, 2)
+	for i, topic := range []string{"orders", ""} {
+		consumeResponse, err := leaderClient.Consume(
+			context.Background(),
+			&connect.Request[logv1.ConsumeRequest]{Msg: &logv1.ConsumeRequest{
+				Topic:     topic,
+				Partition: commitResponse.Msg.Records[i].Partition,
+				Offset:    commitResponse.Msg.Records[i].Offset,
+			}},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "txn", string(consumeResponse.Msg.Record.Value))
+	}
+
+	// The offsets of the consumer groups are replicated, with their lag.
+	_, err = leaderClient.CommitOffset(
+		context.Background(),
+		&connect.Request[logv1.CommitOffsetRequest]{Msg: &logv1.CommitOffsetRequest{
+			Group:  "billing",
+			Offset: 1,
+		}},
+	)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		groupsResponse, err := followerClient.ListGroups(
+			context.Background(),
+			&connect.Request[logv1.ListGroupsRequest]{Msg: &logv1.ListGroupsRequest{}},
+		)
+		if err != nil || len(groupsResponse.Msg.Groups) != 1 {
+			return false
+		}
+		offset := groupsResponse.Msg.Groups[0].Offsets[0]
+		return offset.Offset == 1 && offset.Lag == commitResponse.Msg.Records[1].Offset
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// The partitions of a consumer which stops sending heartbeats are assigned
+	// to the remaining ones.
+	var members []string
+	for i := 0; i < 2; i++ {
+		joinResponse, err := leaderClient.JoinGroup(
+			context.Background(),
+			&connect.Request[logv1.JoinGroupRequest]{Msg: &logv1.JoinGroupRequest{
+				Group:          "shipping",
+				Topic:          "orders",
+				SessionTimeout: durationpb.New(time.Second),
+			}},
+		)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), joinResponse.Msg.Generation)
+		members = append(members, joinResponse.Msg.MemberId)
+	}
+	require.Eventually(t, func() bool {
+		heartbeatResponse, err := leaderClient.Heartbeat(
+			context.Background(),
+			&connect.Request[logv1.HeartbeatRequest]{Msg: &logv1.HeartbeatRequest{
+				Group:    "shipping",
+				MemberId: members[0],
+			}},
+		)
+		require.NoError(t, err)
+		return heartbeatResponse.Msg.Generation == 3 &&
+			len(heartbeatResponse.Msg.Partitions) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	_, err = leaderClient.Heartbeat(
+		context.Background(),
+		&connect.Request[logv1.HeartbeatRequest]{Msg: &logv1.HeartbeatRequest{
+			Group:    "shipping",
+			MemberId: members[1],
+		}},
+	)
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
 }
 
 func client(
@@ -0,0 +1,211 @@
+package log
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchivedSegment describes a sealed segment stored in a SegmentArchive.
+type ArchivedSegment struct {
+	BaseOffset uint64
+	// Size is the size of the store and the index.
+	Size uint64
+	// ModTime is the time of the last write to the segment.
+	ModTime time.Time
+}
+
+// SegmentArchive stores sealed segments out of the local disk.
+//
+// Only the store and the index of a segment are archived. The time index is
+// rebuilt from the store when the segment is fetched.
+type SegmentArchive interface {
+	// Put archives the store and the index of a sealed segment.
+	Put(ctx context.Context, segment ArchivedSegment, store, index io.Reader) error
+	// Get copies the store and the index of an archived segment.
+	//
+	// Get returns an error wrapping os.ErrNotExist if the segment is not
+	// archived.
+	Get(ctx context.Context, baseOffset uint64, store, index io.Writer) error
+	// List returns the archived segments sorted by base offset.
+	List(ctx context.Context) ([]ArchivedSegment, error)
+	// Delete removes an archived segment.
+	Delete(ctx context.Context, baseOffset uint64) error
+}
+
+// ScopedArchive is implemented by the archives which can hold the segments of
+// several logs, each in its own scope.
+type ScopedArchive interface {
+	SegmentArchive
+	// Scope returns the archive of the segments of the named log. The name
+	// may be made of several '/'-separated elements.
+	Scope(name string) SegmentArchive
+}
+
+// ClearArchive deletes every segment of the archive.
+func ClearArchive(ctx context.Context, a SegmentArchive) error {
+	segments, err := a.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if err := a.Delete(ctx, s.BaseOffset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ ScopedArchive = LocalArchive{}
+
+// LocalArchive is a SegmentArchive storing the segments in a local
+// directory, which can be a mounted network file system.
+//
+// Each log must have its own archive directory.
+type LocalArchive struct {
+	Dir string
+}
+
+// Put implements SegmentArchive.
+func (a LocalArchive) Put(
+	_ context.Context,
+	segment ArchivedSegment,
+	store, index io.Reader,
+) error {
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return err
+	}
+	// The index is written first so that List only returns complete segments.
+	for _, f := range []struct {
+		ext string
+		r   io.Reader
+	}{
+		{ext: ".index", r: index},
+		{ext: ".store", r: store},
+	} {
+		name := a.name(segment.BaseOffset, f.ext)
+		if err := writeFile(name, f.r); err != nil {
+			return err
+		}
+		if err := os.Chtimes(name, segment.ModTime, segment.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile atomically writes the content of r to name.
+func writeFile(name string, r io.Reader) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Get implements SegmentArchive.
+func (a LocalArchive) Get(
+	_ context.Context,
+	baseOffset uint64,
+	store, index io.Writer,
+) error {
+	for _, f := range []struct {
+		ext string
+		w   io.Writer
+	}{
+		{ext: ".store", w: store},
+		{ext: ".index", w: index},
+	} {
+		r, err := os.Open(a.name(baseOffset, f.ext))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f.w, r)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List implements SegmentArchive.
+func (a LocalArchive) List(_ context.Context) ([]ArchivedSegment, error) {
+	files, err := os.ReadDir(a.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var segments []ArchivedSegment
+	for _, file := range files {
+		offStr, ok := strings.CutSuffix(file.Name(), ".store")
+		if !ok {
+			continue
+		}
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		if err != nil {
+			continue
+		}
+		store, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		index, err := os.Stat(a.name(off, ".index"))
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, ArchivedSegment{
+			BaseOffset: off,
+			Size:       uint64(store.Size() + index.Size()),
+			ModTime:    store.ModTime(),
+		})
+	}
+	slices.SortFunc(segments, func(a, b ArchivedSegment) int {
+		return cmp.Compare(a.BaseOffset, b.BaseOffset)
+	})
+	return segments, nil
+}
+
+// Delete implements SegmentArchive.
+func (a LocalArchive) Delete(_ context.Context, baseOffset uint64) error {
+	// The store is removed first so that List never returns a segment
+	// without index.
+	for _, ext := range []string{".store", ".index"} {
+		err := os.Remove(a.name(baseOffset, ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scope implements ScopedArchive: the segments of the scope are stored in a
+// subdirectory, which the List of the parent archive ignores.
+func (a LocalArchive) Scope(name string) SegmentArchive {
+	return LocalArchive{Dir: path.Join(a.Dir, name)}
+}
+
+func (a LocalArchive) name(baseOffset uint64, ext string) string {
+	return path.Join(a.Dir, fmt.Sprintf("%d%s", baseOffset, ext))
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "archive-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	a := LocalArchive{Dir: dir}
+
+	segments, err := a.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, segments)
+
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, off := range []uint64{10, 0} {
+		require.NoError(t, a.Put(
+			ctx,
+			ArchivedSegment{BaseOffset: off, ModTime: modTime},
+			bytes.NewReader([]byte("store")),
+			bytes.NewReader([]byte("index")),
+		))
+	}
+
+	segments, err = a.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	require.Equal(t, uint64(0), segments[0].BaseOffset)
+	require.Equal(t, uint64(10), segments[1].BaseOffset)
+	require.Equal(t, uint64(len("store")+len("index")), segments[0].Size)
+	require.True(t, modTime.Equal(segments[0].ModTime))
+
+	var store, index bytes.Buffer
+	require.NoError(t, a.Get(ctx, 10, &store, &index))
+	require.Equal(t, "store", store.String())
+	require.Equal(t, "index", index.String())
+
+	require.NoError(t, a.Delete(ctx, 10))
+	segments, err = a.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	require.ErrorIs(t, a.Get(ctx, 10, &store, &index), os.ErrNotExist)
+}
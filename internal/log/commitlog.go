@@ -0,0 +1,44 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"fmt"
+	"time"
+)
+
+// CommitLog is implemented by the backends of the log.
+type CommitLog interface {
+	// Append appends the record and returns its offset.
+	Append(*logv1.Record) (uint64, error)
+	// Read returns the record at the given offset, or ErrOffsetOutOfRange.
+	Read(uint64) (*logv1.Record, error)
+	// OffsetForTime returns the offset of the first record appended at or
+	// after t, or the next offset if there is none.
+	OffsetForTime(time.Time) (uint64, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+	// Truncate removes the records whose offset is lower than or equal to
+	// lowest. The segments backend only removes whole segments.
+	Truncate(lowest uint64) error
+	Close() error
+}
+
+var (
+	_ CommitLog = (*Log)(nil)
+	_ CommitLog = (*MemoryLog)(nil)
+	_ CommitLog = (*PebbleLog)(nil)
+)
+
+// Open opens the log of the backend selected by c.Backend in dir.
+func Open(dir string, c Config) (CommitLog, error) {
+	switch c.Backend {
+	case BackendSegments:
+		return NewLog(dir, c)
+	case BackendMemory:
+		return NewMemoryLog(c), nil
+	case BackendPebble:
+		return NewPebbleLog(dir, c)
+	default:
+		return nil, fmt.Errorf("open: unknown backend %s", c.Backend)
+	}
+}
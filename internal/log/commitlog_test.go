@@ -0,0 +1,248 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/raftpebble"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TestCommitLog runs the same scenarios against every backend.
+func TestCommitLog(t *testing.T) {
+	for _, backend := range []Backend{BackendSegments, BackendMemory, BackendPebble} {
+		for scenario, fn := range map[string]func(
+			t *testing.T, open func() CommitLog, log CommitLog,
+		){
+			"append and read":       testCommitLogAppendRead,
+			"offset out of range":   testCommitLogOutOfRange,
+			"restart":               testCommitLogRestart,
+			"truncate":              testCommitLogTruncate,
+			"offset for time":       testCommitLogOffsetForTime,
+			"offsets of empty logs": testCommitLogEmpty,
+			"closed":                testCommitLogClosed,
+		} {
+			t.Run(fmt.Sprintf("%s/%s", backend, scenario), func(t *testing.T) {
+				dir, err := os.MkdirTemp("", "commitlog-test")
+				require.NoError(t, err)
+				defer os.RemoveAll(dir)
+
+				// A record per segment, so that the segments backend
+				// truncates exactly.
+				c := Config{Backend: backend}
+				c.Segment.MaxIndexBytes = entryWidth
+				c.Pebble = raftpebble.GetTinyMemRaftLogRocksDBConfig()
+				open := func() CommitLog {
+					log, err := Open(dir, c)
+					require.NoError(t, err)
+					return log
+				}
+				log := open()
+				defer func() { _ = log.Close() }()
+
+				fn(t, open, log)
+			})
+		}
+	}
+}
+
+// appendValues appends a record per value and checks their offsets.
+func appendValues(t *testing.T, log CommitLog, first uint64, values ...string) {
+	t.Helper()
+	for i, value := range values {
+		off, err := log.Append(&logv1.Record{Value: []byte(value)})
+		require.NoError(t, err)
+		require.Equal(t, first+uint64(i), off)
+	}
+}
+
+func testCommitLogAppendRead(t *testing.T, _ func() CommitLog, log CommitLog) {
+	appendValues(t, log, 0, "first", "second", "third")
+	for off, want := range []string{"first", "second", "third"} {
+		read, err := log.Read(uint64(off))
+		require.NoError(t, err)
+		require.Equal(t, want, string(read.Value))
+		require.Equal(t, uint64(off), read.Offset)
+		require.NotNil(t, read.AppendTime)
+	}
+}
+
+func testCommitLogOutOfRange(t *testing.T, _ func() CommitLog, log CommitLog) {
+	_, err := log.Read(0)
+	require.Equal(t, ErrOffsetOutOfRange{Offset: 0}, err)
+
+	appendValues(t, log, 0, "first")
+	_, err = log.Read(1)
+	require.Equal(t, ErrOffsetOutOfRange{Offset: 1}, err)
+}
+
+func testCommitLogRestart(t *testing.T, open func() CommitLog, log CommitLog) {
+	if _, ok := log.(*MemoryLog); ok {
+		t.Skip("the memory backend does not persist its records")
+	}
+	appendValues(t, log, 0, "first", "second")
+	require.NoError(t, log.Close())
+
+	log = open()
+	defer log.Close()
+	read, err := log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(read.Value))
+	appendValues(t, log, 2, "third")
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+
+	// The offsets are not reused once every record is truncated.
+	require.NoError(t, log.Truncate(2))
+	require.NoError(t, log.Close())
+	log = open()
+	defer log.Close()
+	appendValues(t, log, 3, "fourth")
+}
+
+func testCommitLogTruncate(t *testing.T, _ func() CommitLog, log CommitLog) {
+	appendValues(t, log, 0, "first", "second", "third", "fourth")
+	require.NoError(t, log.Truncate(1))
+
+	for _, off := range []uint64{0, 1} {
+		_, err := log.Read(off)
+		require.Equal(t, ErrOffsetOutOfRange{Offset: off}, err)
+	}
+	for _, off := range []uint64{2, 3} {
+		_, err := log.Read(off)
+		require.NoError(t, err)
+	}
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lowest)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), highest)
+}
+
+func testCommitLogOffsetForTime(t *testing.T, _ func() CommitLog, log CommitLog) {
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&logv1.Record{
+			Value:      []byte("hello world"),
+			AppendTime: timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+
+	for ts, want := range map[time.Time]uint64{
+		time.Unix(-1, 0):           0,
+		start.Add(-time.Hour):      0,
+		start:                      0,
+		start.Add(time.Second):     1,
+		start.Add(2 * time.Minute): 2,
+		start.Add(time.Hour):       3,
+	} {
+		off, err := log.OffsetForTime(ts)
+		require.NoError(t, err)
+		require.Equal(t, want, off, ts)
+	}
+}
+
+func testCommitLogEmpty(t *testing.T, _ func() CommitLog, log CommitLog) {
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lowest)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), highest)
+}
+
+func testCommitLogClosed(t *testing.T, _ func() CommitLog, log CommitLog) {
+	appendValues(t, log, 0, "first")
+	require.NoError(t, log.Close())
+
+	_, err := log.Append(&logv1.Record{Value: []byte("second")})
+	require.Equal(t, ErrLogClosed{}, err)
+	_, err = log.Read(0)
+	require.Equal(t, ErrLogClosed{}, err)
+	_, err = log.OffsetForTime(time.Now())
+	require.Equal(t, ErrLogClosed{}, err)
+	require.Equal(t, ErrLogClosed{}, log.Truncate(0))
+	require.NoError(t, log.Close())
+}
+
+func TestPebbleLogTruncateTimes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pebble-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Pebble = raftpebble.GetTinyMemRaftLogRocksDBConfig()
+	log, err := NewPebbleLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 4; i++ {
+		_, err := log.Append(&logv1.Record{
+			Value:      []byte("hello world"),
+			AppendTime: timestamppb.New(start.Add(time.Duration(i/2) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+	times := func() (n int) {
+		iter, err := log.db.NewIter(prefixBounds(prefixTime))
+		require.NoError(t, err)
+		defer iter.Close()
+		for iter.First(); iter.Valid(); iter.Next() {
+			n++
+		}
+		return n
+	}
+	require.Equal(t, 2, times())
+
+	// The time of the records 0 and 1 is kept while the record 1 is.
+	require.NoError(t, log.Truncate(0))
+	require.Equal(t, 2, times())
+	off, err := log.OffsetForTime(start)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+
+	require.NoError(t, log.Truncate(1))
+	require.Equal(t, 1, times())
+	off, err = log.OffsetForTime(start)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+}
+
+func TestPebbleLogSyncPolicy(t *testing.T) {
+	for scenario, policy := range map[string]SyncPolicy{
+		"every records":  {Mode: SyncEveryRecords, Records: 2},
+		"every interval": {Mode: SyncEveryInterval, Interval: 50 * time.Millisecond},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "pebble-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			c := Config{}
+			c.Segment.SyncPolicy = policy
+			c.Pebble = raftpebble.GetTinyMemRaftLogRocksDBConfig()
+			log, err := NewPebbleLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			appendValues(t, log, 0, "first")
+			unsynced := func() uint64 {
+				log.mu.RLock()
+				defer log.mu.RUnlock()
+				return log.unsynced
+			}
+			require.Equal(t, uint64(1), unsynced())
+			if policy.Mode == SyncEveryRecords {
+				appendValues(t, log, 1, "second")
+			}
+			require.Eventually(t, func() bool {
+				return unsynced() == 0
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
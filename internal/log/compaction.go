@@ -0,0 +1,222 @@
+package log
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// compactDir is the directory, relative to the log directory, in which the
+// compacted segments are written before replacing the original ones.
+const compactDir = ".compact"
+
+// isTombstone returns true if the record marks the deletion of its key.
+func isTombstone(record *logv1.Record) bool {
+	return len(record.Key) > 0 && len(record.Value) == 0
+}
+
+// Compact rewrites the sealed segments so that only the latest record of each
+// key survives.
+//
+// Records without key are always kept. Tombstones are kept until their
+// segment is older than Compaction.TombstoneRetention. The last record of a
+// segment is always kept so that the segment keeps its offset range.
+//
+// Offsets are stable: reading a compacted offset returns ErrOffsetCompacted.
+func (l *Log) Compact(now time.Time) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.RLock()
+	sealed := slices.Clone(l.segments[:len(l.segments)-1])
+	activeBase, activeNext := l.activeSegment.baseOffset, l.activeSegment.nextOffset
+	l.mu.RUnlock()
+	if len(sealed) == 0 {
+		return nil
+	}
+
+	// Find the latest offset of each key.
+	latest := make(map[string]uint64)
+	collect := func(record *logv1.Record) error {
+		if len(record.Key) > 0 {
+			latest[string(record.Key)] = record.Offset
+		}
+		return nil
+	}
+	for _, s := range sealed {
+		if err := l.each(s, collect); err != nil {
+			return err
+		}
+	}
+	// The active segment is never compacted, but it may supersede keys.
+	it, err := l.Iterator(activeBase)
+	if err != nil {
+		return err
+	}
+	for it.Offset() < activeNext {
+		record, err := it.Next()
+		if err != nil {
+			return err
+		}
+		_ = collect(record)
+	}
+
+	for _, s := range sealed {
+		if err := l.compactSegment(s, latest, now); err != nil {
+			return fmt.Errorf("compact segment %d: %w", s.baseOffset, err)
+		}
+	}
+	return nil
+}
+
+// compactSegment rewrites the segment without the records superseded in
+// latest, and replaces it in the log.
+func (l *Log) compactSegment(
+	s *segment,
+	latest map[string]uint64,
+	now time.Time,
+) error {
+	fi, err := os.Stat(s.store.Name())
+	if err != nil {
+		return err
+	}
+	// The age of the segment is kept by the rewritten store, so that the
+	// tombstones are purged and the retention and the tiering apply as if
+	// the segment was not compacted.
+	modTime := fi.ModTime()
+	purge := now.Sub(modTime) > l.Config.Compaction.TombstoneRetention
+	last := s.nextOffset - 1
+	keep := func(record *logv1.Record) bool {
+		switch {
+		case record.Offset == last, len(record.Key) == 0:
+			return true
+		case latest[string(record.Key)] != record.Offset:
+			return false
+		default:
+			return !purge || !isTombstone(record)
+		}
+	}
+
+	var records []*logv1.Record
+	removed := 0
+	if err := l.each(s, func(record *logv1.Record) error {
+		if keep(record) {
+			records = append(records, record)
+		} else {
+			removed++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if removed == 0 {
+		return nil
+	}
+
+	// Write the compacted segment aside.
+	dir := path.Join(l.Dir, compactDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	storeName := path.Join(dir, fmt.Sprintf("%d.store", s.baseOffset))
+	indexName := path.Join(dir, fmt.Sprintf("%d.index", s.baseOffset))
+	timeIndexName := path.Join(dir, fmt.Sprintf("%d.timeindex", s.baseOffset))
+	for _, name := range []string{storeName, indexName, timeIndexName} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	c, err := newSegment(dir, s.baseOffset, l.Config)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := c.write(record); err != nil {
+			_ = c.Close()
+			return err
+		}
+	}
+	size := c.size()
+	if err := c.Close(); err != nil {
+		return err
+	}
+
+	// Swap the segments.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := slices.Index(l.segments, s)
+	if i < 0 {
+		// Removed in the meantime.
+		return nil
+	}
+	reclaimed := s.size() - size
+	l.untrack(s)
+	s.mu.Lock()
+	err = s.Close()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.Chtimes(storeName, modTime, modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(storeName, s.store.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(indexName, s.index.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(timeIndexName, s.timeIndex.Name()); err != nil {
+		return err
+	}
+	ns, err := newSegment(l.Dir, s.baseOffset, l.Config)
+	if err != nil {
+		return err
+	}
+	l.segments[i] = ns
+	if err := ns.seal(); err != nil {
+		return err
+	}
+	if err := l.touch(ns); err != nil {
+		return err
+	}
+
+	compactionRemovedRecords.Add(context.Background(), int64(removed))
+	compactionReclaimedBytes.Add(context.Background(), int64(reclaimed))
+	slog.Info(
+		"compacted segment",
+		"dir",
+		l.Dir,
+		"segment",
+		s.baseOffset,
+		"records",
+		removed,
+		"bytes",
+		reclaimed,
+	)
+	return nil
+}
+
+// each calls fn for every record of the sealed segment s, which is reopened
+// if cold.
+func (l *Log) each(s *segment, fn func(record *logv1.Record) error) error {
+	unpin, err := l.pin(s)
+	if err != nil {
+		return err
+	}
+	defer unpin()
+	return s.each(fn)
+}
+
+// compact runs the log compaction.
+func (l *Log) compact(now time.Time) {
+	if err := l.Compact(now); err != nil {
+		slog.Error("compaction failed", "dir", l.Dir, "error", err)
+	}
+}
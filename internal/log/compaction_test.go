@@ -0,0 +1,148 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompaction(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"latest record per key survives": testCompactLatest,
+		"tombstones are purged":          testCompactTombstones,
+		"compacted log reopens":          testCompactReopen,
+		"restore compacted records":      testCompactAppendAt,
+		"compacted segments keep age":    testCompactAge,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "compaction-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// Each segment holds 4 records.
+			c := Config{}
+			c.Segment.MaxIndexBytes = entryWidth * 4
+			c.Compaction.TombstoneRetention = time.Hour
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			records := []*logv1.Record{
+				{Key: []byte("a"), Value: []byte("a0")},
+				{Key: []byte("b"), Value: []byte("b0")},
+				{Value: []byte("no key")},
+				{Key: []byte("a"), Value: []byte("a1")},
+				{Key: []byte("a"), Value: []byte("a2")},
+				{Key: []byte("b")},
+				{Key: []byte("c"), Value: []byte("c0")},
+				{Key: []byte("c"), Value: []byte("c1")},
+				{Key: []byte("c"), Value: []byte("c2")},
+			}
+			for _, r := range records {
+				_, err := log.Append(r)
+				require.NoError(t, err)
+			}
+			// 2 sealed segments and 1 active segment.
+			require.Len(t, log.segments, 3)
+
+			fn(t, log)
+		})
+	}
+}
+
+func testCompactLatest(t *testing.T, log *Log) {
+	require.NoError(t, log.Compact(time.Now()))
+
+	// a0, b0 and c0 are superseded. a1 is superseded, but is the last record
+	// of its segment.
+	for off, next := range map[uint64]uint64{0: 2, 1: 2, 6: 7} {
+		_, err := log.Read(off)
+		require.Equal(t, ErrOffsetCompacted{Offset: off, Next: next}, err)
+	}
+	for off, want := range map[uint64]string{
+		2: "no key",
+		3: "a1",
+		4: "a2",
+		5: "",
+		7: "c1",
+		8: "c2",
+	} {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want, string(read.Value))
+		require.Equal(t, off, read.Offset)
+	}
+
+	// The active segment supersedes a2.
+	_, err := log.Append(&logv1.Record{Key: []byte("a"), Value: []byte("a3")})
+	require.NoError(t, err)
+	require.NoError(t, log.Compact(time.Now()))
+	_, err = log.Read(4)
+	require.Equal(t, ErrOffsetCompacted{Offset: 4, Next: 5}, err)
+}
+
+func testCompactTombstones(t *testing.T, log *Log) {
+	require.NoError(t, log.Compact(time.Now()))
+	read, err := log.Read(5)
+	require.NoError(t, err)
+	require.Empty(t, read.Value)
+
+	require.NoError(t, log.Compact(time.Now().Add(2*time.Hour)))
+	_, err = log.Read(5)
+	require.Equal(t, ErrOffsetCompacted{Offset: 5, Next: 7}, err)
+}
+
+func testCompactReopen(t *testing.T, log *Log) {
+	require.NoError(t, log.Compact(time.Now()))
+	require.NoError(t, log.Close())
+
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer n.Close()
+
+	_, err = n.Read(1)
+	require.Equal(t, ErrOffsetCompacted{Offset: 1, Next: 2}, err)
+	read, err := n.Read(4)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a2"), read.Value)
+	off, err := n.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), off)
+	off, err = n.Append(&logv1.Record{Value: []byte("after")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), off)
+}
+
+func testCompactAppendAt(t *testing.T, log *Log) {
+	require.Error(t, log.AppendAt(&logv1.Record{Offset: 8}))
+
+	require.NoError(t, log.AppendAt(&logv1.Record{Offset: 12, Value: []byte("at")}))
+	_, err := log.Read(10)
+	require.Equal(t, ErrOffsetCompacted{Offset: 10, Next: 12}, err)
+	read, err := log.Read(12)
+	require.NoError(t, err)
+	require.Equal(t, []byte("at"), read.Value)
+	off, err := log.Append(&logv1.Record{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(13), off)
+}
+
+func testCompactAge(t *testing.T, log *Log) {
+	old := time.Now().Add(-3 * time.Hour)
+	for _, s := range log.segments[:2] {
+		require.NoError(t, os.Chtimes(s.store.Name(), old, old))
+	}
+	require.NoError(t, log.Compact(time.Now()))
+	_, err := log.Read(5)
+	require.Equal(t, ErrOffsetCompacted{Offset: 5, Next: 7}, err)
+
+	log.Config.Retention.MaxAge = 2 * time.Hour
+	off, ok := log.RetentionOffset(time.Now())
+	require.True(t, ok)
+	require.Equal(t, uint64(7), off)
+}
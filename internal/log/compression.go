@@ -0,0 +1,67 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression codec of a record.
+//
+// The codec is recorded in the header of each frame, so that a log can mix
+// compressed and uncompressed records.
+type Codec byte
+
+const (
+	// CodecNone stores the records as is.
+	CodecNone Codec = iota
+	// CodecSnappy compresses the records with snappy.
+	CodecSnappy
+	// CodecZstd compresses the records with zstd.
+	CodecZstd
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown (%d)", byte(c))
+	}
+}
+
+func compress(c Codec, p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecSnappy:
+		return snappy.Encode(nil, p), nil
+	case CodecZstd:
+		return zstdEncoder.EncodeAll(p, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown codec %d", byte(c))
+	}
+}
+
+func decompress(c Codec, p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecSnappy:
+		return snappy.Decode(nil, p)
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(p, nil)
+	default:
+		return nil, fmt.Errorf("unknown codec %d: %w", byte(c), errChecksum)
+	}
+}
@@ -1,13 +1,154 @@
 package log
 
 import (
+	"distributed-systems/internal/raftpebble"
+	"fmt"
+	"time"
+
 	"github.com/hashicorp/raft"
 )
 
 type Segment struct {
 	MaxStoreBytes uint64
+	// MaxIndexBytes is the maximum size of the index entries of a segment,
+	// 16 bytes per record.
+	//
+	// The size of the index is not limited if zero.
 	MaxIndexBytes uint64
 	InitialOffset uint64
+	// SyncPolicy describes when the segments are committed to stable storage.
+	SyncPolicy SyncPolicy
+	// Compression is the codec used to compress the appended records.
+	Compression Codec
+	// MaxOpenSegments is the maximum number of sealed segments whose files
+	// are kept open. The least recently read segments are closed and reopened
+	// when read again.
+	//
+	// The number of open segments is not limited if zero.
+	MaxOpenSegments int
+}
+
+// SyncMode is the mode of a SyncPolicy.
+type SyncMode int
+
+const (
+	// SyncNever leaves the flushing to the operating system. The segments are
+	// only synced when closed.
+	SyncNever SyncMode = iota
+	// SyncAlways syncs the active segment after every append.
+	SyncAlways
+	// SyncEveryRecords syncs the active segment every SyncPolicy.Records
+	// records.
+	SyncEveryRecords
+	// SyncEveryInterval syncs the active segment every SyncPolicy.Interval.
+	SyncEveryInterval
+)
+
+// SyncPolicy describes when the store and the indexes of the active segment
+// are flushed and synced to stable storage.
+//
+// Whatever the mode, a segment is synced when sealed, unless the mode is
+// SyncNever.
+type SyncPolicy struct {
+	Mode SyncMode
+	// Records is the number of records between two syncs, for
+	// SyncEveryRecords.
+	Records uint64
+	// Interval is the interval between two syncs, for SyncEveryInterval.
+	Interval time.Duration
+}
+
+func (p SyncPolicy) String() string {
+	switch p.Mode {
+	case SyncNever:
+		return "never"
+	case SyncAlways:
+		return "always"
+	case SyncEveryRecords:
+		return fmt.Sprintf("every %d records", p.Records)
+	case SyncEveryInterval:
+		return fmt.Sprintf("every %s", p.Interval)
+	default:
+		return fmt.Sprintf("unknown (%d)", p.Mode)
+	}
+}
+
+// Retention describes when sealed segments are deleted.
+//
+// A zero value disables the corresponding limit.
+type Retention struct {
+	// MaxBytes is the maximum total size of the segments.
+	MaxBytes uint64
+	// MaxAge is the maximum age of a sealed segment, since its last write.
+	MaxAge time.Duration
+	// MinRecords is the minimum number of records to keep.
+	MinRecords uint64
+	// CheckInterval is the interval of the background retention loop.
+	//
+	// The loop is disabled if zero.
+	CheckInterval time.Duration
+}
+
+// Compaction describes the key-based compaction of sealed segments.
+type Compaction struct {
+	// TombstoneRetention is the duration for which tombstones are kept after
+	// their segment was last written, so that consumers can observe them.
+	TombstoneRetention time.Duration
+	// CheckInterval is the interval of the background compaction loop.
+	//
+	// The loop is disabled if zero.
+	CheckInterval time.Duration
+}
+
+// Tiering describes the offloading of sealed segments to a SegmentArchive.
+//
+// Offloaded segments are still readable: they are fetched and cached on the
+// local disk when an offset they contain is read.
+type Tiering struct {
+	// Archive is the archive of the offloaded segments.
+	//
+	// Tiering is disabled if nil.
+	Archive SegmentArchive
+	// LocalMaxBytes is the maximum total size of the local segments.
+	LocalMaxBytes uint64
+	// LocalMaxAge is the maximum age of a local sealed segment, since its last
+	// write.
+	LocalMaxAge time.Duration
+	// CacheSegments is the number of fetched segments kept on the local disk.
+	//
+	// At least one segment is cached.
+	CacheSegments int
+	// CheckInterval is the interval of the background offloading loop.
+	//
+	// The loop is disabled if zero.
+	CheckInterval time.Duration
+}
+
+// Backend is the storage of the records of a CommitLog.
+type Backend int
+
+const (
+	// BackendSegments stores the records in segment files, and supports the
+	// retention, the compaction, the tiering and the replication.
+	BackendSegments Backend = iota
+	// BackendMemory keeps the records in memory, for tests and ephemeral
+	// nodes. The records are lost when the log is closed.
+	BackendMemory
+	// BackendPebble stores the records in a pebble db.
+	BackendPebble
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendSegments:
+		return "segments"
+	case BackendMemory:
+		return "memory"
+	case BackendPebble:
+		return "pebble"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(b))
+	}
 }
 
 type Raft struct {
@@ -17,6 +158,18 @@ type Raft struct {
 }
 
 type Config struct {
-	Raft    Raft
-	Segment Segment
+	Raft       Raft
+	Segment    Segment
+	Retention  Retention
+	Compaction Compaction
+	Tiering    Tiering
+	// Backend is the backend opened by Open.
+	//
+	// The distributed log stores its Raft log in the backend, while its
+	// partitions always use BackendSegments.
+	Backend Backend
+	// Pebble configures BackendPebble, from one of the raftpebble presets.
+	//
+	// The default configuration of raftpebble is used if empty.
+	Pebble raftpebble.RaftLogRocksDBConfig
 }
@@ -0,0 +1,186 @@
+package distributed
+
+import (
+	"crypto/rand"
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// defaultSessionTimeout is the session timeout of the consumers which do
+	// not set one.
+	defaultSessionTimeout = 10 * time.Second
+	// sessionCheckInterval is the interval at which the leader evicts the
+	// consumers whose session timed out.
+	sessionCheckInterval = 500 * time.Millisecond
+)
+
+// memberKey identifies a member of a consumer group.
+type memberKey struct {
+	group  string
+	member string
+}
+
+// assignRange assigns the partitions of the topic of the group to its
+// members, sorted by ID, in contiguous ranges: the first n%m members get a
+// partition more than the others. The generation of the group is
+// incremented.
+func assignRange(state *logv1.GroupState, n uint32) {
+	state.Generation++
+	m := uint32(len(state.Members))
+	if m == 0 {
+		return
+	}
+	p := uint32(0)
+	for i, member := range state.Members {
+		count := n / m
+		if uint32(i) < n%m {
+			count++
+		}
+		member.Partitions = make([]uint32, 0, count)
+		for end := p + count; p < end; p++ {
+			member.Partitions = append(member.Partitions, p)
+		}
+	}
+}
+
+// JoinGroup joins the consumer to the group through Raft, and returns the
+// partitions assigned to it. A new consumer is given a member ID.
+func (l *Log) JoinGroup(req *logv1.JoinGroupRequest) (*logv1.JoinGroupResponse, error) {
+	if req.MemberId == "" {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		req.MemberId = hex.EncodeToString(b[:])
+	} else if _, _, err := l.fsm.session(req.Group, req.MemberId); err != nil {
+		// The consumer left the group, or was evicted, and joins as a new
+		// member.
+		return nil, err
+	}
+	if req.SessionTimeout == nil {
+		req.SessionTimeout = durationpb.New(defaultSessionTimeout)
+	}
+	res, err := l.apply(JoinGroupRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	l.heartbeat(memberKey{group: req.Group, member: req.MemberId}, req.SessionTimeout.AsDuration())
+	return res.(*logv1.JoinGroupResponse), nil
+}
+
+// Heartbeat keeps the consumer in its group, and returns the partitions
+// assigned to it.
+//
+// The sessions are tracked by the leader only: the consumers are given a new
+// session when the leader changes.
+func (l *Log) Heartbeat(group, member string) (*logv1.HeartbeatResponse, error) {
+	if l.raft.State() != raft.Leader {
+		return nil, raft.ErrNotLeader
+	}
+	res, timeout, err := l.fsm.session(group, member)
+	if err != nil {
+		return nil, err
+	}
+	l.heartbeat(memberKey{group: group, member: member}, timeout)
+	return res, nil
+}
+
+// LeaveGroup removes the consumer from its group through Raft.
+func (l *Log) LeaveGroup(group, member string) error {
+	_, err := l.apply(LeaveGroupRequestType, &logv1.LeaveGroupRequest{
+		Group:    group,
+		MemberId: member,
+	})
+	l.sessionsMu.Lock()
+	delete(l.sessions, memberKey{group: group, member: member})
+	l.sessionsMu.Unlock()
+	return err
+}
+
+// heartbeat extends the session of the member.
+func (l *Log) heartbeat(key memberKey, timeout time.Duration) {
+	l.sessionsMu.Lock()
+	defer l.sessionsMu.Unlock()
+	if l.sessions == nil {
+		l.sessions = make(map[memberKey]time.Time)
+	}
+	l.sessions[key] = time.Now().Add(timeout)
+}
+
+// startSessions starts the loop evicting the consumers whose session timed
+// out from their group, through Raft.
+func (l *Log) startSessions() {
+	l.sessionsDone = make(chan struct{})
+	l.sessionsWG.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.sessionsWG.Done()
+		ticker := time.NewTicker(sessionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, key := range l.expiredSessions(now) {
+					err := l.LeaveGroup(key.group, key.member)
+					switch err.(type) {
+					case nil, log.ErrUnknownMember:
+						slog.Info("evicted consumer", "group", key.group, "member", key.member)
+					default:
+						slog.Error(
+							"failed to evict consumer",
+							"group", key.group,
+							"member", key.member,
+							"error", err,
+						)
+					}
+				}
+			}
+		}
+	}(l.sessionsDone)
+}
+
+// expiredSessions returns the members whose session timed out.
+//
+// The members unknown to the leader are given a session, and the sessions are
+// dropped when the node is not the leader.
+func (l *Log) expiredSessions(now time.Time) []memberKey {
+	l.sessionsMu.Lock()
+	defer l.sessionsMu.Unlock()
+	if l.raft.State() != raft.Leader {
+		l.sessions = nil
+		return nil
+	}
+	if l.sessions == nil {
+		l.sessions = make(map[memberKey]time.Time)
+	}
+	members := make(map[memberKey]bool)
+	var expired []memberKey
+	for _, state := range l.fsm.groupStates() {
+		for _, m := range state.Members {
+			key := memberKey{group: state.Name, member: m.Id}
+			members[key] = true
+			deadline, ok := l.sessions[key]
+			if !ok {
+				l.sessions[key] = now.Add(m.SessionTimeout.AsDuration())
+				continue
+			}
+			if now.After(deadline) {
+				expired = append(expired, key)
+			}
+		}
+	}
+	for key := range l.sessions {
+		if !members[key] {
+			delete(l.sessions, key)
+		}
+	}
+	return expired
+}
@@ -2,6 +2,7 @@ package distributed
 
 import (
 	"bytes"
+	"context"
 	logv1 "distributed-systems/gen/log/v1"
 	"distributed-systems/internal/log"
 	"distributed-systems/internal/raftpebble"
@@ -10,17 +11,36 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/hashicorp/raft"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Log struct {
 	config log.Config
 	log    *log.Log
+	fsm    *fsm
 	raft   *raft.Raft
+	// transport records the replication of the Raft log to the other nodes.
+	transport *replicationTransport
+
+	retentionDone chan struct{}
+	retentionWG   sync.WaitGroup
+
+	// sessions are the deadlines of the sessions of the members of the
+	// consumer groups, tracked by the leader.
+	sessionsDone chan struct{}
+	sessionsWG   sync.WaitGroup
+	sessionsMu   sync.Mutex
+	sessions     map[memberKey]time.Time
+
+	// txns are the transactions begun by the node, by ID.
+	txnMu sync.Mutex
+	txns  map[uint64]*txn
 }
 
 func NewLog(dataDir string, config log.Config) (
@@ -36,6 +56,8 @@ func NewLog(dataDir string, config log.Config) (
 	if err := l.setupRaft(dataDir); err != nil {
 		return nil, err
 	}
+	l.startRetention()
+	l.startSessions()
 	return l, nil
 }
 
@@ -44,20 +66,43 @@ func (l *Log) setupLog(dataDir string) error {
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return err
 	}
+	// Retention is driven through Raft so that every replica drops the same
+	// prefix.
+	logConfig := l.config
+	logConfig.Retention.CheckInterval = 0
+	// The partitions are snapshotted, retained, compacted and tiered, which
+	// only the segments support. The backend stores the Raft log.
+	logConfig.Backend = log.BackendSegments
 	var err error
-	l.log, err = log.NewLog(logDir, l.config)
-	return err
+	l.log, err = log.NewLog(logDir, logConfig)
+	if err != nil {
+		return err
+	}
+	// The named topics are created by the FSM, each in its own directory.
+	// They are rebuilt from the snapshot and the Raft log when the node
+	// starts.
+	topicsDir := filepath.Join(dataDir, "topics")
+	if err := os.RemoveAll(topicsDir); err != nil {
+		return err
+	}
+	l.fsm = &fsm{
+		log:    l.log,
+		dir:    topicsDir,
+		config: logConfig,
+	}
+	return nil
 }
 
 func (l *Log) setupRaft(dataDir string) error {
-	fsm := &fsm{log: l.log}
-
 	logDir := filepath.Join(dataDir, "raft", "log")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return err
 	}
 	logConfig := l.config
 	logConfig.Segment.InitialOffset = 1
+	logConfig.Retention = log.Retention{}
+	logConfig.Compaction = log.Compaction{}
+	logConfig.Tiering = log.Tiering{}
 	ldb, err := newLogStore(logDir, logConfig)
 	if err != nil {
 		return err
@@ -89,6 +134,7 @@ func (l *Log) setupRaft(dataDir string) error {
 		timeout,
 		os.Stderr,
 	)
+	l.transport = newReplicationTransport(transport)
 
 	config := raft.DefaultConfig()
 	config.LocalID = l.config.Raft.LocalID
@@ -107,11 +153,11 @@ func (l *Log) setupRaft(dataDir string) error {
 
 	l.raft, err = raft.NewRaft(
 		config,
-		fsm,
+		l.fsm,
 		ldb,
 		sdb,
 		fss,
-		transport,
+		l.transport,
 	)
 	if err != nil {
 		return err
@@ -147,19 +193,86 @@ func (l *Log) setupRaft(dataDir string) error {
 	return err
 }
 
+// Append replicates the record of the default topic through Raft and returns
+// its offset.
+//
+// The append time is set by the leader so that every replica agrees on it.
 func (l *Log) Append(record *logv1.Record) (uint64, error) {
-	res, err := l.apply(AppendRequestType, &logv1.ProduceRequest{
-		Record: record,
+	return l.append(partitionID{}, record)
+}
+
+func (l *Log) append(id partitionID, record *logv1.Record) (uint64, error) {
+	res, err := l.produce(&logv1.ProduceRequest{
+		Record:    record,
+		Topic:     id.topic,
+		Partition: &id.partition,
 	})
 	if err != nil {
 		return 0, err
 	}
-	return res.(*logv1.ProduceResponse).Offset, nil
+	return res.Offset, nil
+}
+
+// Produce replicates the record of the request through Raft, to the partition
+// of the request or the partition chosen by the topic if unset.
+//
+// The record of an idempotent producer is appended once: if it is produced
+// again, the offset of the record appended first is returned.
+func (l *Log) Produce(req *logv1.ProduceRequest) (*logv1.ProduceResponse, error) {
+	if req.Partition == nil {
+		p, err := l.fsm.route(req.Topic, req.GetRecord())
+		if err != nil {
+			return nil, err
+		}
+		req.Partition = &p
+	}
+	return l.produce(req)
+}
+
+func (l *Log) produce(req *logv1.ProduceRequest) (*logv1.ProduceResponse, error) {
+	if req.Record == nil {
+		req.Record = &logv1.Record{}
+	}
+	req.Record.AppendTime = timestamppb.Now()
+	res, err := l.apply(AppendRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*logv1.ProduceResponse), nil
+}
+
+// InitProducer returns a new producer ID for an idempotent producer, given
+// through Raft so that every node knows the producer.
+func (l *Log) InitProducer() (uint64, error) {
+	res, err := l.apply(InitProducerRequestType, &logv1.InitProducerRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return res.(*logv1.InitProducerResponse).ProducerId, nil
 }
 
 func (l *Log) apply(reqType RequestType, req proto.Message) (
 	interface{},
 	error,
+) {
+	res, err := l.applyResponse(reqType, req)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+// applyResponse applies the request through Raft and returns the response of
+// the FSM, which is an error if the FSM rejected the request.
+//
+// The error returned by Raft does not tell whether the request was applied:
+// it may be committed even if the leadership was lost or the apply timed out.
+func (l *Log) applyResponse(reqType RequestType, req proto.Message) (
+	interface{},
+	error,
 ) {
 	var buf bytes.Buffer
 	_, err := buf.Write([]byte{byte(reqType)})
@@ -179,15 +292,82 @@ func (l *Log) apply(reqType RequestType, req proto.Message) (
 	if future.Error() != nil {
 		return nil, future.Error()
 	}
-	res := future.Response()
-	if err, ok := res.(error); ok {
-		return nil, err
+	return future.Response(), nil
+}
+
+// startRetention starts the retention loop, if enabled.
+//
+// The leader computes the retention offset and applies it through Raft.
+func (l *Log) startRetention() {
+	interval := l.config.Retention.CheckInterval
+	if interval == 0 {
+		return
 	}
-	return res, nil
+	l.retentionDone = make(chan struct{})
+	l.retentionWG.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.retentionWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if l.raft.State() != raft.Leader {
+					continue
+				}
+				for id, off := range l.fsm.retentionOffsets(now) {
+					if _, err := l.apply(RetainRequestType, &logv1.RetainRequest{
+						Offset:    off,
+						Topic:     id.topic,
+						Partition: id.partition,
+					}); err != nil {
+						slog.Error(
+							"failed to apply retention",
+							"topic", id.topic,
+							"partition", id.partition,
+							"offset", off,
+							"error", err,
+						)
+					}
+				}
+			}
+		}
+	}(l.retentionDone)
 }
 
+// Read returns the record of the default topic at the offset.
+//
+// The records of the default topic are read as those of its partition, so
+// that the records of a transaction are read once all of them are appended.
 func (l *Log) Read(offset uint64) (*logv1.Record, error) {
-	return l.log.Read(offset)
+	return l.defaultPartition().Read(offset)
+}
+
+func (l *Log) ReadEncoded(offset uint64) ([]byte, error) {
+	return l.defaultPartition().ReadEncoded(offset)
+}
+
+func (l *Log) OffsetForTime(t time.Time) (uint64, error) {
+	return l.defaultPartition().OffsetForTime(t)
+}
+
+func (l *Log) WaitForOffset(ctx context.Context, offset uint64) error {
+	return l.defaultPartition().WaitForOffset(ctx, offset)
+}
+
+func (l *Log) Offsets() (lowest, next uint64, err error) {
+	return l.defaultPartition().Offsets()
+}
+
+// defaultPartition returns the single partition of the default topic.
+func (l *Log) defaultPartition() *Partition {
+	return &Partition{log: l}
+}
+
+func (l *Log) Iterator(from uint64, opts ...log.IteratorOption) (*log.Iterator, error) {
+	return l.defaultPartition().Iterator(from, opts...)
 }
 
 func (l *Log) Join(id, addr string) error {
@@ -254,8 +434,17 @@ func (l *Log) WaitForLeader(timeout time.Duration) error {
 }
 
 func (l *Log) Close() error {
+	if l.retentionDone != nil {
+		close(l.retentionDone)
+		l.retentionWG.Wait()
+	}
+	close(l.sessionsDone)
+	l.sessionsWG.Wait()
 	if err := l.raft.Shutdown().Error(); err != nil {
 		return err
 	}
+	if err := l.fsm.Close(); err != nil {
+		return err
+	}
 	return l.log.Close()
 }
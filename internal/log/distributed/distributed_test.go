@@ -112,3 +112,194 @@ func TestMultipleNodes(t *testing.T) {
 	require.Equal(t, []byte("third"), record.Value)
 	require.Equal(t, off, record.Offset)
 }
+
+// newCluster starts the nodes with the configuration: the first one
+// bootstraps the cluster and the others join it. The nodes are closed when
+// the test ends.
+func newCluster(t *testing.T, nodeCount int, c log.Config) []*distributed.Log {
+	t.Helper()
+	var logs []*distributed.Log
+	for i := 0; i < nodeCount; i++ {
+		port, err := internalnet.GetAvailablePort()
+		require.NoError(t, err)
+		dataDir, err := os.MkdirTemp("", "distributed-log-test")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = os.RemoveAll(dataDir) })
+		ln, err := net.Listen(
+			"tcp",
+			net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		)
+		require.NoError(t, err)
+
+		config := c
+		config.Raft = log.Raft{
+			StreamLayer: distributed.NewStreamLayer(ln, nil, nil),
+			Config: raft.Config{
+				LocalID:            raft.ServerID(fmt.Sprintf("%d", i)),
+				HeartbeatTimeout:   50 * time.Millisecond,
+				ElectionTimeout:    50 * time.Millisecond,
+				LeaderLeaseTimeout: 50 * time.Millisecond,
+				CommitTimeout:      5 * time.Millisecond,
+			},
+			Bootstrap: i == 0,
+		}
+
+		l, err := distributed.NewLog(dataDir, config)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+
+		if i != 0 {
+			err = logs[0].Join(
+				fmt.Sprintf("%d", i), ln.Addr().String(),
+			)
+			require.NoError(t, err)
+		} else {
+			err = l.WaitForLeader(5 * time.Second)
+			require.NoError(t, err)
+		}
+
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+func TestFollowerReads(t *testing.T) {
+	logs := newCluster(t, 2, log.Config{})
+
+	records := []*logv1.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+	}
+	for _, record := range records {
+		off, err := logs[0].Append(record)
+		require.NoError(t, err)
+
+		// The append time is set by the leader.
+		require.Eventually(t, func() bool {
+			got, err := logs[1].Read(off)
+			return err == nil &&
+				got.AppendTime.AsTime().Equal(record.AppendTime.AsTime())
+		}, 500*time.Millisecond, 50*time.Millisecond)
+	}
+
+	it, err := logs[1].Iterator(0)
+	require.NoError(t, err)
+	for _, record := range records {
+		got, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, record.Value, got.Value)
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	nodeCount := 3
+	logs := newCluster(t, nodeCount, log.Config{})
+	for i := 0; i < 2; i++ {
+		_, err := logs[0].Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	lowest, next, err := logs[0].Offsets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lowest)
+	require.Equal(t, uint64(2), next)
+
+	// The leader knows the Raft entries stored by every node.
+	require.Eventually(t, func() bool {
+		replication, err := logs[0].Replication()
+		if err != nil || len(replication.Replicas) != nodeCount {
+			return false
+		}
+		for _, replica := range replication.Replicas {
+			if replica.MatchIndex == nil || *replica.MatchIndex != replication.LastIndex {
+				return false
+			}
+		}
+		return replication.CommitIndex == replication.LastIndex
+	}, 500*time.Millisecond, 50*time.Millisecond)
+
+	// The followers only know their own.
+	replication, err := logs[1].Replication()
+	require.NoError(t, err)
+	for _, replica := range replication.Replicas {
+		require.Equal(t, replica.Id == "1", replica.MatchIndex != nil)
+		require.Equal(t, replica.Id == "0", replica.Leader)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	logs := newCluster(t, 2, log.Config{})
+
+	// The transactions are begun by the leader.
+	_, err := logs[1].BeginTxn()
+	require.Equal(t, raft.ErrNotLeader, err)
+	txnID, err := logs[0].BeginTxn()
+	require.NoError(t, err)
+
+	// The transaction stays staged until committed.
+	require.NoError(t, logs[0].CreateTopic(&logv1.Topic{Name: "orders"}))
+	_, err = logs[0].ProduceTxn(txnID, &logv1.ProduceRequest{
+		Topic:  "orders",
+		Record: &logv1.Record{Value: []byte("order")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, logs[0].DeleteTopic("orders"))
+	_, err = logs[0].CommitTxn(txnID)
+	require.Equal(t, log.ErrTopicNotFound{Name: "orders"}, err)
+	require.NoError(t, logs[0].CreateTopic(&logv1.Topic{Name: "orders"}))
+	res, err := logs[0].CommitTxn(txnID)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, uint64(0), res[0].Offset)
+	_, err = logs[0].CommitTxn(txnID)
+	require.Equal(t, log.ErrTxnNotFound{ID: txnID}, err)
+
+	// The transaction is dropped if Raft fails, since its records may have
+	// been committed.
+	txnID, err = logs[0].BeginTxn()
+	require.NoError(t, err)
+	_, err = logs[0].ProduceTxn(txnID, &logv1.ProduceRequest{
+		Topic:  "orders",
+		Record: &logv1.Record{Value: []byte("order")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, logs[0].Leave("0"))
+	_, err = logs[0].CommitTxn(txnID)
+	require.Contains(t, []error{raft.ErrNotLeader, raft.ErrRaftShutdown}, err)
+	_, err = logs[0].CommitTxn(txnID)
+	require.Equal(t, log.ErrTxnNotFound{ID: txnID}, err)
+}
+
+func TestRetention(t *testing.T) {
+	logs := newCluster(t, 2, log.Config{
+		Segment: log.Segment{
+			MaxStoreBytes: 32,
+		},
+		Retention: log.Retention{
+			MaxBytes:      1,
+			MinRecords:    2,
+			CheckInterval: 50 * time.Millisecond,
+		},
+	})
+
+	var last uint64
+	for i := 0; i < 6; i++ {
+		off, err := logs[0].Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		last = off
+	}
+
+	// Every replica drops the same sealed segments, and keeps the last two
+	// records.
+	require.Eventually(t, func() bool {
+		for _, l := range logs {
+			if _, err := l.Read(0); err == nil {
+				return false
+			}
+			if _, err := l.Read(last); err != nil {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 50*time.Millisecond)
+}
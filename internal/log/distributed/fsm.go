@@ -2,9 +2,22 @@ package distributed
 
 import (
 	"bytes"
+	"context"
 	logv1 "distributed-systems/gen/log/v1"
 	"distributed-systems/internal/log"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/raft"
 	"google.golang.org/protobuf/proto"
@@ -14,12 +27,156 @@ type RequestType uint8
 
 const (
 	AppendRequestType RequestType = iota
+	RetainRequestType
+	CreateTopicRequestType
+	DeleteTopicRequestType
+	InitProducerRequestType
+	ApplyTxnRequestType
+	CommitOffsetRequestType
+	JoinGroupRequestType
+	LeaveGroupRequestType
 )
 
-var _ raft.FSM = (*fsm)(nil)
+var _ raft.BatchingFSM = (*fsm)(nil)
 
 type fsm struct {
+	// log is the log of the default topic.
 	log *log.Log
+	// dir is the directory of the logs of the named topics, and config the
+	// configuration they override.
+	dir    string
+	config log.Config
+
+	// mu guards the topics. It is held while a partition is read so that its
+	// log is not closed under the readers when the topic is deleted.
+	mu     sync.RWMutex
+	topics map[string]*topic
+
+	// producers are the states of the idempotent producers by ID, and
+	// lastProducerID the last ID given to a producer. They are only used by
+	// Apply, Snapshot and Restore, which are never called concurrently.
+	producers      map[uint64]*logv1.ProducerState
+	lastProducerID uint64
+
+	// groups are the offsets committed by the consumer groups, and members
+	// their members, by name. groupsMu guards them.
+	groupsMu sync.RWMutex
+	groups   map[string]map[partitionID]uint64
+	members  map[string]*logv1.GroupState
+}
+
+// topic is a named topic and the logs of its partitions.
+type topic struct {
+	meta       *logv1.Topic
+	partitions []*log.Log
+	// next is the partition of the next record without key appended through
+	// this node. It is not replicated.
+	next atomic.Uint32
+}
+
+// partitionID identifies a partition of a topic.
+type partitionID struct {
+	topic     string
+	partition uint32
+}
+
+// partition returns the log of the partition of the topic. The default topic
+// has no name and a single partition.
+//
+// f.mu must be held.
+func (f *fsm) partition(id partitionID) (*log.Log, error) {
+	if id.topic == "" {
+		if id.partition != 0 {
+			return nil, log.ErrPartitionNotFound{Partition: id.partition}
+		}
+		return f.log, nil
+	}
+	t, ok := f.topics[id.topic]
+	if !ok {
+		return nil, log.ErrTopicNotFound{Name: id.topic}
+	}
+	if id.partition >= uint32(len(t.partitions)) {
+		return nil, log.ErrPartitionNotFound{Topic: id.topic, Partition: id.partition}
+	}
+	return t.partitions[id.partition], nil
+}
+
+// view calls fn with the log of the partition, which is not closed until fn
+// returns.
+func (f *fsm) view(id partitionID, fn func(*log.Log) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	l, err := f.partition(id)
+	if err != nil {
+		return err
+	}
+	return fn(l)
+}
+
+// partitions returns the number of partitions of the topic.
+func (f *fsm) partitions(name string) (uint32, error) {
+	if name == "" {
+		return 1, nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	t, ok := f.topics[name]
+	if !ok {
+		return 0, log.ErrTopicNotFound{Name: name}
+	}
+	return uint32(len(t.partitions)), nil
+}
+
+// route returns the partition of the record: the partition of its key, or
+// the next partition in turn if the record has no key.
+func (f *fsm) route(name string, record *logv1.Record) (uint32, error) {
+	if name == "" {
+		return 0, nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	t, ok := f.topics[name]
+	if !ok {
+		return 0, log.ErrTopicNotFound{Name: name}
+	}
+	n := uint32(len(t.partitions))
+	if len(record.Key) > 0 {
+		return keyPartition(record.Key, n), nil
+	}
+	return (t.next.Add(1) - 1) % n, nil
+}
+
+// retentionOffsets returns the retention offsets of the partitions past their
+// retention limits.
+func (f *fsm) retentionOffsets(now time.Time) map[partitionID]uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	offsets := make(map[partitionID]uint64)
+	if off, ok := f.log.RetentionOffset(now); ok {
+		offsets[partitionID{}] = off
+	}
+	for name, t := range f.topics {
+		for p, l := range t.partitions {
+			if off, ok := l.RetentionOffset(now); ok {
+				offsets[partitionID{topic: name, partition: uint32(p)}] = off
+			}
+		}
+	}
+	return offsets
+}
+
+// listTopics returns the named topics, sorted by name.
+func (f *fsm) listTopics() []*logv1.Topic {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	topics := make([]*logv1.Topic, 0, len(f.topics))
+	for _, t := range f.topics {
+		topics = append(topics, proto.Clone(t.meta).(*logv1.Topic))
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Name < topics[j].Name
+	})
+	return topics
 }
 
 // Apply implements raft.FSM.
@@ -29,58 +186,821 @@ func (f *fsm) Apply(record *raft.Log) interface{} {
 	switch reqType {
 	case AppendRequestType:
 		return f.applyAppend(buf[1:])
+	case RetainRequestType:
+		return f.applyRetain(buf[1:])
+	case CreateTopicRequestType:
+		return f.applyCreateTopic(buf[1:])
+	case DeleteTopicRequestType:
+		return f.applyDeleteTopic(buf[1:])
+	case InitProducerRequestType:
+		return f.applyInitProducer()
+	case ApplyTxnRequestType:
+		return f.applyTxn(buf[1:])
+	case CommitOffsetRequestType:
+		return f.applyCommitOffset(buf[1:])
+	case JoinGroupRequestType:
+		return f.applyJoinGroup(buf[1:])
+	case LeaveGroupRequestType:
+		return f.applyLeaveGroup(buf[1:])
 	}
 	return nil
 }
 
+// ApplyBatch implements raft.BatchingFSM.
+//
+// Consecutive append requests to the same partition are appended to its log
+// as a single batch. The sequence numbers of the idempotent producers are
+// checked as the requests are batched, and their states are rolled back if the
+// batch fails.
+func (f *fsm) ApplyBatch(logs []*raft.Log) []interface{} {
+	res := make([]interface{}, len(logs))
+	var (
+		id      partitionID
+		records []*logv1.Record
+		indexes []int
+		// producers are the states of the producers of the records, nil for
+		// the records without producer, and saved the states of the producers
+		// of the batch before it.
+		producers []*logv1.ProducerState
+		saved     map[uint64]*logv1.ProducerState
+	)
+	flush := func() {
+		if len(records) == 0 {
+			return
+		}
+		err := f.view(id, func(l *log.Log) error {
+			first, _, err := l.AppendBatch(records)
+			if err != nil {
+				return err
+			}
+			for i, idx := range indexes {
+				res[idx] = &logv1.ProduceResponse{
+					Offset:    first + uint64(i),
+					Partition: id.partition,
+				}
+				if p := producers[i]; p != nil {
+					p.Partition, p.Offset = id.partition, first+uint64(i)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, idx := range indexes {
+				res[idx] = err
+			}
+			for pid, state := range saved {
+				f.producers[pid] = state
+			}
+		}
+		records, indexes, producers = records[:0], indexes[:0], producers[:0]
+		saved = nil
+	}
+	for i, l := range logs {
+		if l.Type != raft.LogCommand {
+			continue
+		}
+		if RequestType(l.Data[0]) != AppendRequestType {
+			flush()
+			res[i] = f.Apply(l)
+			continue
+		}
+		var req logv1.ProduceRequest
+		if err := proto.Unmarshal(l.Data[1:], &req); err != nil {
+			res[i] = err
+			continue
+		}
+		// The batch of the previous partition is appended before the sequence
+		// is checked, so that its states are rolled back before this record
+		// updates them.
+		if next := produceID(&req); next != id {
+			flush()
+			id = next
+		}
+		var producer *logv1.ProducerState
+		if req.ProducerId != 0 {
+			if _, ok := saved[req.ProducerId]; ok {
+				if state := f.producers[req.ProducerId]; req.Sequence != state.NextSequence {
+					// The record produced again may be in the batch.
+					flush()
+				}
+			}
+			state, dup, err := f.checkSequence(&req)
+			if err != nil {
+				res[i] = err
+				continue
+			}
+			if dup != nil {
+				res[i] = dup
+				continue
+			}
+			if saved == nil {
+				saved = make(map[uint64]*logv1.ProducerState)
+			}
+			if _, ok := saved[state.Id]; !ok {
+				saved[state.Id] = proto.Clone(state).(*logv1.ProducerState)
+			}
+			state.NextSequence++
+			producer = state
+		}
+		records = append(records, req.Record)
+		indexes = append(indexes, i)
+		producers = append(producers, producer)
+	}
+	flush()
+	return res
+}
+
+// produceID returns the partition of the produce request.
+func produceID(req *logv1.ProduceRequest) partitionID {
+	return partitionID{topic: req.Topic, partition: req.GetPartition()}
+}
+
 func (f *fsm) applyAppend(b []byte) interface{} {
 	var req logv1.ProduceRequest
 	err := proto.Unmarshal(b, &req)
 	if err != nil {
 		return err
 	}
-	offset, err := f.log.Append(req.Record)
+	var state *logv1.ProducerState
+	if req.ProducerId != 0 {
+		var dup *logv1.ProduceResponse
+		if state, dup, err = f.checkSequence(&req); err != nil {
+			return err
+		} else if dup != nil {
+			return dup
+		}
+	}
+	var offset uint64
+	err = f.view(produceID(&req), func(l *log.Log) error {
+		offset, err = l.Append(req.Record)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	return &logv1.ProduceResponse{Offset: offset}
+	if state != nil {
+		state.NextSequence++
+		state.Partition, state.Offset = req.GetPartition(), offset
+	}
+	return &logv1.ProduceResponse{Offset: offset, Partition: req.GetPartition()}
+}
+
+// checkSequence checks the sequence number of the record of an idempotent
+// producer. It returns the state of the producer if the record is its next
+// one, or the response of the last record of the producer if the record is
+// produced again.
+func (f *fsm) checkSequence(req *logv1.ProduceRequest) (
+	*logv1.ProducerState,
+	*logv1.ProduceResponse,
+	error,
+) {
+	state, ok := f.producers[req.ProducerId]
+	if !ok {
+		return nil, nil, log.ErrUnknownProducer{ID: req.ProducerId}
+	}
+	switch {
+	case req.Sequence == state.NextSequence:
+		return state, nil, nil
+	case req.Sequence+1 == state.NextSequence:
+		return nil, &logv1.ProduceResponse{
+			Offset:    state.Offset,
+			Partition: state.Partition,
+		}, nil
+	}
+	return nil, nil, log.ErrOutOfOrderSequence{
+		ProducerID: req.ProducerId,
+		Sequence:   req.Sequence,
+		Expected:   state.NextSequence,
+	}
+}
+
+// applyTxn appends the records of a committed transaction.
+//
+// The topics are locked while the records are appended so that the readers
+// read either all of them or none. The partitions are checked first so that
+// the transaction is not appended in part if a topic was deleted since. The
+// records of each partition are appended in one batch, and the partitions
+// already appended are rolled back if a later one fails.
+func (f *fsm) applyTxn(b []byte) interface{} {
+	var req logv1.ApplyTxnRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	type batch struct {
+		log     *log.Log
+		records []*logv1.Record
+		// indexes are the indexes of the records in the transaction.
+		indexes []int
+	}
+	var batches []*batch
+	byPartition := make(map[partitionID]*batch)
+	for i, r := range req.Records {
+		id := produceID(r)
+		p, ok := byPartition[id]
+		if !ok {
+			l, err := f.partition(id)
+			if err != nil {
+				return err
+			}
+			p = &batch{log: l}
+			byPartition[id] = p
+			batches = append(batches, p)
+		}
+		p.records = append(p.records, r.Record)
+		p.indexes = append(p.indexes, i)
+	}
+	res := &logv1.CommitTxnResponse{
+		Records: make([]*logv1.ProduceResponse, len(req.Records)),
+	}
+	marks := make([]log.Mark, 0, len(batches))
+	for _, p := range batches {
+		marks = append(marks, p.log.Mark())
+		first, _, err := p.log.AppendBatch(p.records)
+		if err != nil {
+			for i, m := range marks[:len(marks)-1] {
+				if rerr := batches[i].log.Rollback(m); rerr != nil {
+					err = errors.Join(err, rerr)
+				}
+			}
+			return err
+		}
+		for j, i := range p.indexes {
+			res.Records[i] = &logv1.ProduceResponse{
+				Offset:    first + uint64(j),
+				Partition: req.Records[i].GetPartition(),
+			}
+		}
+	}
+	return res
+}
+
+// applyCommitOffset commits the offset of the consumer group for the
+// partition.
+//
+// If the group has members, or the request names a generation, the offset
+// must be committed by a member of the current generation.
+func (f *fsm) applyCommitOffset(b []byte) interface{} {
+	var req logv1.CommitOffsetRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	id := partitionID{topic: req.Topic, partition: req.Partition}
+	f.mu.RLock()
+	_, err := f.partition(id)
+	f.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	f.groupsMu.Lock()
+	defer f.groupsMu.Unlock()
+	state := f.members[req.Group]
+	if len(state.GetMembers()) > 0 || req.Generation != 0 {
+		if req.Generation != state.GetGeneration() {
+			return log.ErrStaleGeneration{
+				Group:      req.Group,
+				Generation: req.Generation,
+				Current:    state.GetGeneration(),
+			}
+		}
+		if _, ok := findMember(state, req.MemberId); !ok {
+			return log.ErrUnknownMember{Group: req.Group, Member: req.MemberId}
+		}
+	}
+	if f.groups == nil {
+		f.groups = make(map[string]map[partitionID]uint64)
+	}
+	if f.groups[req.Group] == nil {
+		f.groups[req.Group] = make(map[partitionID]uint64)
+	}
+	f.groups[req.Group][id] = req.Offset
+	return nil
+}
+
+// groupOffset returns the offset committed by the consumer group for the
+// partition, or ErrGroupOffsetNotFound.
+func (f *fsm) groupOffset(group string, id partitionID) (uint64, error) {
+	f.groupsMu.RLock()
+	defer f.groupsMu.RUnlock()
+	off, ok := f.groups[group][id]
+	if !ok {
+		return 0, log.ErrGroupOffsetNotFound{
+			Group:     group,
+			Topic:     id.topic,
+			Partition: id.partition,
+		}
+	}
+	return off, nil
+}
+
+// groupOffsets returns the offsets committed by the consumer groups, sorted
+// by group, topic and partition.
+func (f *fsm) groupOffsets() []*logv1.CommitOffsetRequest {
+	f.groupsMu.RLock()
+	defer f.groupsMu.RUnlock()
+	var offsets []*logv1.CommitOffsetRequest
+	for group, partitions := range f.groups {
+		for id, off := range partitions {
+			offsets = append(offsets, &logv1.CommitOffsetRequest{
+				Group:     group,
+				Topic:     id.topic,
+				Partition: id.partition,
+				Offset:    off,
+			})
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		a, b := offsets[i], offsets[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return offsets
+}
+
+// applyJoinGroup adds the consumer to the group, and assigns the partitions
+// of the topic again if it is a new member. The ID of a new member is set by
+// the leader.
+func (f *fsm) applyJoinGroup(b []byte) interface{} {
+	var req logv1.JoinGroupRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if req.Group == "" || req.MemberId == "" {
+		return log.ErrInvalidGroup{Name: req.Group, Reason: "the group and the member must be named"}
+	}
+	n, err := f.partitions(req.Topic)
+	if err != nil {
+		return err
+	}
+	f.groupsMu.Lock()
+	defer f.groupsMu.Unlock()
+	state := f.members[req.Group]
+	if state == nil {
+		state = &logv1.GroupState{Name: req.Group, Topic: req.Topic}
+		if f.members == nil {
+			f.members = make(map[string]*logv1.GroupState)
+		}
+		f.members[req.Group] = state
+	}
+	if len(state.Members) > 0 && state.Topic != req.Topic {
+		return log.ErrInvalidGroup{
+			Name:   req.Group,
+			Reason: fmt.Sprintf("the group consumes topic %q", state.Topic),
+		}
+	}
+	state.Topic = req.Topic
+	member, ok := findMember(state, req.MemberId)
+	if ok {
+		member.SessionTimeout = req.SessionTimeout
+	} else {
+		member = &logv1.GroupMember{Id: req.MemberId, SessionTimeout: req.SessionTimeout}
+		state.Members = append(state.Members, member)
+		sort.Slice(state.Members, func(i, j int) bool {
+			return state.Members[i].Id < state.Members[j].Id
+		})
+		assignRange(state, n)
+	}
+	return &logv1.JoinGroupResponse{
+		MemberId:   member.Id,
+		Generation: state.Generation,
+		Partitions: slices.Clone(member.Partitions),
+	}
+}
+
+// applyLeaveGroup removes the consumer from the group, and assigns the
+// partitions of the topic to the remaining members.
+func (f *fsm) applyLeaveGroup(b []byte) interface{} {
+	var req logv1.LeaveGroupRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	// The group has no member left to assign if its topic was deleted.
+	n, _ := f.partitions(f.groupTopic(req.Group))
+	f.groupsMu.Lock()
+	defer f.groupsMu.Unlock()
+	state := f.members[req.Group]
+	i := slices.IndexFunc(state.GetMembers(), func(m *logv1.GroupMember) bool {
+		return m.Id == req.MemberId
+	})
+	if i < 0 {
+		return log.ErrUnknownMember{Group: req.Group, Member: req.MemberId}
+	}
+	state.Members = slices.Delete(state.Members, i, i+1)
+	assignRange(state, n)
+	return nil
+}
+
+// groupTopic returns the topic consumed by the members of the group.
+func (f *fsm) groupTopic(group string) string {
+	f.groupsMu.RLock()
+	defer f.groupsMu.RUnlock()
+	return f.members[group].GetTopic()
+}
+
+// session returns the generation of the group, the partitions assigned to the
+// member and its session timeout, or ErrUnknownMember.
+func (f *fsm) session(group, id string) (*logv1.HeartbeatResponse, time.Duration, error) {
+	f.groupsMu.RLock()
+	defer f.groupsMu.RUnlock()
+	state := f.members[group]
+	member, ok := findMember(state, id)
+	if !ok {
+		return nil, 0, log.ErrUnknownMember{Group: group, Member: id}
+	}
+	return &logv1.HeartbeatResponse{
+		Generation: state.Generation,
+		Partitions: slices.Clone(member.Partitions),
+	}, member.SessionTimeout.AsDuration(), nil
+}
+
+// groupStates returns the members of the consumer groups, sorted by group.
+func (f *fsm) groupStates() []*logv1.GroupState {
+	f.groupsMu.RLock()
+	defer f.groupsMu.RUnlock()
+	states := make([]*logv1.GroupState, 0, len(f.members))
+	for _, state := range f.members {
+		states = append(states, proto.Clone(state).(*logv1.GroupState))
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// findMember returns the member of the group.
+func findMember(state *logv1.GroupState, id string) (*logv1.GroupMember, bool) {
+	for _, m := range state.GetMembers() {
+		if m.Id == id {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// applyInitProducer gives the next producer ID to a new idempotent producer.
+//
+// The states of the producers are never removed.
+func (f *fsm) applyInitProducer() interface{} {
+	f.lastProducerID++
+	if f.producers == nil {
+		f.producers = make(map[uint64]*logv1.ProducerState)
+	}
+	f.producers[f.lastProducerID] = &logv1.ProducerState{Id: f.lastProducerID}
+	return &logv1.InitProducerResponse{ProducerId: f.lastProducerID}
+}
+
+func (f *fsm) applyRetain(b []byte) interface{} {
+	var req logv1.RetainRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	id := partitionID{topic: req.Topic, partition: req.Partition}
+	return f.view(id, func(l *log.Log) error {
+		return l.Retain(req.Offset)
+	})
+}
+
+func (f *fsm) applyCreateTopic(b []byte) interface{} {
+	var req logv1.CreateTopicRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if err := validateTopic(req.Topic); err != nil {
+		return err
+	}
+	name := req.Topic.Name
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.topics[name]; ok {
+		return log.ErrTopicExists{Name: name}
+	}
+	// The topic starts empty: the segments archived by a former topic of the
+	// same name are dropped.
+	for p := uint32(0); p < max(req.Topic.GetConfig().GetPartitions(), 1); p++ {
+		if a := topicConfig(f.config, req.Topic, p).Tiering.Archive; a != nil {
+			if err := log.ClearArchive(context.Background(), a); err != nil {
+				return err
+			}
+		}
+	}
+	return f.createTopic(req.Topic)
+}
+
+// createTopic opens the logs of the partitions of the topic, each in its own
+// directory.
+//
+// The segments archived by the partitions are kept, so that a topic rebuilt
+// from a snapshot reads its offloaded records again.
+//
+// f.mu must be held.
+func (f *fsm) createTopic(meta *logv1.Topic) error {
+	t := &topic{meta: meta}
+	n := max(meta.GetConfig().GetPartitions(), 1)
+	for p := uint32(0); p < n; p++ {
+		dir := filepath.Join(f.dir, meta.Name, strconv.FormatUint(uint64(p), 10))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Join(err, t.close())
+		}
+		l, err := log.NewLog(dir, topicConfig(f.config, meta, p))
+		if err != nil {
+			return errors.Join(err, t.close())
+		}
+		t.partitions = append(t.partitions, l)
+	}
+	if f.topics == nil {
+		f.topics = make(map[string]*topic)
+	}
+	f.topics[meta.Name] = t
+	return nil
+}
+
+func (f *fsm) applyDeleteTopic(b []byte) interface{} {
+	var req logv1.DeleteTopicRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.topics[req.Name]
+	if !ok {
+		return log.ErrTopicNotFound{Name: req.Name}
+	}
+	delete(f.topics, req.Name)
+	f.removeGroupOffsets(req.Name)
+	return f.removeTopic(t)
+}
+
+// removeGroupOffsets removes the offsets committed by the consumer groups for
+// the partitions of the topic, and the groups left without offset. The
+// members of the groups consuming the topic are removed too.
+func (f *fsm) removeGroupOffsets(name string) {
+	f.groupsMu.Lock()
+	defer f.groupsMu.Unlock()
+	for group, state := range f.members {
+		if state.Topic == name {
+			delete(f.members, group)
+		}
+	}
+	for group, partitions := range f.groups {
+		for id := range partitions {
+			if id.topic == name {
+				delete(partitions, id)
+			}
+		}
+		if len(partitions) == 0 {
+			delete(f.groups, group)
+		}
+	}
+}
+
+// removeTopic removes the logs of the partitions of the topic, their
+// archived segments, and its directory.
+func (f *fsm) removeTopic(t *topic) error {
+	for _, l := range t.partitions {
+		if err := l.Remove(); err != nil {
+			return err
+		}
+		if archive := l.Config.Tiering.Archive; archive != nil {
+			if err := log.ClearArchive(context.Background(), archive); err != nil {
+				return err
+			}
+		}
+	}
+	// The directories of the snapshots not closed yet are kept.
+	_ = os.Remove(filepath.Join(f.dir, t.meta.Name))
+	return nil
+}
+
+// close closes the logs of the partitions of the topic.
+func (t *topic) close() error {
+	var errs []error
+	for _, l := range t.partitions {
+		errs = append(errs, l.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// topicConfig returns the configuration of the log of the partition of the
+// topic.
+//
+// Each partition offloads its segments to its own scope of the archive. The
+// partitions are not tiered if the archive has no scopes, since their
+// segments would overwrite each other.
+func topicConfig(c log.Config, meta *logv1.Topic, p uint32) log.Config {
+	c.Segment.InitialOffset = 0
+	if scoped, ok := c.Tiering.Archive.(log.ScopedArchive); ok {
+		c.Tiering.Archive = scoped.Scope(path.Join("topics", meta.Name, strconv.FormatUint(uint64(p), 10)))
+	} else {
+		c.Tiering = log.Tiering{}
+	}
+	if n := meta.GetConfig().GetMaxStoreBytes(); n != 0 {
+		c.Segment.MaxStoreBytes = n
+	}
+	if n := meta.GetConfig().GetMaxIndexBytes(); n != 0 {
+		c.Segment.MaxIndexBytes = n
+	}
+	return c
 }
 
 // Restore implements raft.FSM.
+//
+// The topics which are not in the snapshot are deleted, and the states of the
+// producers and the offsets and members of the consumer groups are replaced.
+//
+// A snapshot without marker is a legacy snapshot, holding only the frames of
+// the records of the default topic.
 func (f *fsm) Restore(r io.ReadCloser) error {
-	b := make([]byte, log.LenWidth)
-	var buf bytes.Buffer
+	marker := make([]byte, len(snapshotMarker))
+	n, err := io.ReadFull(r, marker)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if !bytes.Equal(marker[:n], snapshotMarker) {
+		return f.restore(&logv1.SnapshotHeader{
+			Topics: []*logv1.TopicSnapshot{{Topic: &logv1.Topic{}, Size: math.MaxInt64}},
+		}, io.MultiReader(bytes.NewReader(marker[:n]), r))
+	}
+	b, err := log.ReadFrame(r)
+	if err != nil {
+		return err
+	}
+	var header logv1.SnapshotHeader
+	if err := proto.Unmarshal(b, &header); err != nil {
+		return err
+	}
+	return f.restore(&header, r)
+}
+
+// restore restores the state described by the header, followed by the frames
+// of the logs of its topics in r.
+func (f *fsm) restore(header *logv1.SnapshotHeader, r io.Reader) error {
+	f.lastProducerID = header.LastProducerId
+	f.producers = make(map[uint64]*logv1.ProducerState, len(header.Producers))
+	for _, state := range header.Producers {
+		f.producers[state.Id] = state
+	}
+	groups := make(map[string]map[partitionID]uint64)
+	for _, req := range header.GroupOffsets {
+		if groups[req.Group] == nil {
+			groups[req.Group] = make(map[partitionID]uint64)
+		}
+		groups[req.Group][partitionID{topic: req.Topic, partition: req.Partition}] = req.Offset
+	}
+	members := make(map[string]*logv1.GroupState, len(header.Groups))
+	for _, state := range header.Groups {
+		members[state.Name] = state
+	}
+	f.groupsMu.Lock()
+	f.groups, f.members = groups, members
+	f.groupsMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	restored := make(map[string]bool)
+	for _, ts := range header.Topics {
+		name := ts.GetTopic().GetName()
+		if t, ok := f.topics[name]; ok && !restored[name] && !proto.Equal(t.meta, ts.Topic) {
+			// The topic was deleted and created again since.
+			delete(f.topics, name)
+			if err := f.removeTopic(t); err != nil {
+				return err
+			}
+		}
+		if _, ok := f.topics[name]; !ok && name != "" {
+			if err := f.createTopic(ts.Topic); err != nil {
+				return err
+			}
+		}
+		l, err := f.partition(partitionID{topic: name, partition: ts.Partition})
+		if err != nil {
+			return err
+		}
+		lr := io.LimitReader(r, int64(ts.Size))
+		if err := restoreLog(l, lr, ts.LowestOffset, ts.NextOffset); err != nil {
+			return err
+		}
+		restored[name] = true
+	}
+	for name, t := range f.topics {
+		if restored[name] {
+			continue
+		}
+		delete(f.topics, name)
+		if err := f.removeTopic(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreLog replaces the records of the log with the frames read from r.
+// The log is emptied and starts at next if r holds no record. The records
+// below lowest are retained out, as they were in the snapshotted log.
+func restoreLog(l *log.Log, r io.Reader, lowest, next uint64) error {
+	reset := func(off uint64) error {
+		l.Config.Segment.InitialOffset = off
+		return l.Reset()
+	}
 	for i := 0; ; i++ {
-		_, err := io.ReadFull(r, b)
+		b, err := log.ReadFrame(r)
 		if err == io.EOF {
-			break
+			if i == 0 {
+				if err := reset(next); err != nil {
+					return err
+				}
+			}
+			if lowest == 0 {
+				return nil
+			}
+			return l.Retain(lowest - 1)
 		} else if err != nil {
 			return err
 		}
-		size := int64(log.Encoding.Uint64(b))
-		if _, err = io.CopyN(&buf, r, int64(size)); err != nil {
-			return err
-		}
 		record := &logv1.Record{}
-		if err := proto.Unmarshal(buf.Bytes(), record); err != nil {
+		if err := proto.Unmarshal(b, record); err != nil {
 			return err
 		}
 		if i == 0 {
-			f.log.Config.Segment.InitialOffset = record.Offset
-			if err := f.log.Reset(); err != nil {
+			if err := reset(record.Offset); err != nil {
 				return err
 			}
 		}
-		if _, err = f.log.Append(record); err != nil {
+		// Offsets are kept as is since the log may be compacted.
+		if err = l.AppendAt(record); err != nil {
 			return err
 		}
-		buf.Reset()
 	}
-	return nil
 }
 
 // Snapshot implements raft.FSM.
+//
+// It is called between two applies, so the snapshot holds exactly the applied
+// records of every partition.
 func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	r := f.log.Reader()
-	return &snapshot{reader: r}, nil
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	s := &snapshot{header: &logv1.SnapshotHeader{
+		LastProducerId: f.lastProducerID,
+	}}
+	for _, state := range f.producers {
+		s.header.Producers = append(s.header.Producers, proto.Clone(state).(*logv1.ProducerState))
+	}
+	sort.Slice(s.header.Producers, func(i, j int) bool {
+		return s.header.Producers[i].Id < s.header.Producers[j].Id
+	})
+	s.header.GroupOffsets = f.groupOffsets()
+	s.header.Groups = f.groupStates()
+	add := func(meta *logv1.Topic, p int, l *log.Log) error {
+		ls, err := l.Snapshot()
+		if err != nil {
+			return err
+		}
+		s.snapshots = append(s.snapshots, ls)
+		s.header.Topics = append(s.header.Topics, &logv1.TopicSnapshot{
+			Topic:        meta,
+			Partition:    uint32(p),
+			Size:         ls.Size(),
+			NextOffset:   ls.High,
+			LowestOffset: ls.Low,
+		})
+		return nil
+	}
+	if err := add(&logv1.Topic{}, 0, f.log); err != nil {
+		s.Release()
+		return nil, err
+	}
+	names := make([]string, 0, len(f.topics))
+	for name := range f.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := f.topics[name]
+		meta := proto.Clone(t.meta).(*logv1.Topic)
+		for p, l := range t.partitions {
+			if err := add(meta, p, l); err != nil {
+				s.Release()
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// Close closes the logs of the named topics.
+func (f *fsm) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for _, t := range f.topics {
+		errs = append(errs, t.close())
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,665 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// newFSM returns an FSM whose logs are removed when the test ends.
+func newFSM(t *testing.T) *fsm {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "fsm-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "log"), 0755))
+	c := log.Config{}
+	c.Segment.MaxStoreBytes = 64
+	l, err := log.NewLog(filepath.Join(dir, "log"), c)
+	require.NoError(t, err)
+	f := &fsm{log: l, dir: filepath.Join(dir, "topics"), config: c}
+	t.Cleanup(func() {
+		_ = f.Close()
+		_ = l.Close()
+	})
+	return f
+}
+
+// command returns the Raft log of the request.
+func command(t *testing.T, reqType RequestType, req proto.Message) *raft.Log {
+	t.Helper()
+	b, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return &raft.Log{Type: raft.LogCommand, Data: append([]byte{byte(reqType)}, b...)}
+}
+
+// snapshotRestore persists a snapshot of the source and restores it to the
+// target.
+func snapshotRestore(t *testing.T, s raft.FSMSnapshot, target *fsm) {
+	t.Helper()
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, 5, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.Persist(sink))
+	s.Release()
+
+	_, rc, err := store.Open(sink.ID())
+	require.NoError(t, err)
+	require.NoError(t, target.Restore(rc))
+}
+
+// topicNames returns the names of the topics of the FSM.
+func topicNames(f *fsm) []string {
+	var names []string
+	for _, topic := range f.listTopics() {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	appendRecords := func(f *fsm, n int) {
+		for i := 0; i < n; i++ {
+			_, err := f.log.Append(&logv1.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+		}
+	}
+
+	// Arrange
+	source := newFSM(t)
+	appendRecords(source, 5)
+
+	// Act: the log keeps changing while the snapshot is persisted.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	appendRecords(source, 5)
+	require.NoError(t, source.log.Truncate(3))
+
+	target := newFSM(t)
+	appendRecords(target, 8)
+	snapshotRestore(t, s, target)
+
+	// Assert: the target holds exactly the records of the snapshot.
+	for off := uint64(0); off < 5; off++ {
+		record, err := target.log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+	}
+	_, err = target.log.Read(5)
+	require.ErrorAs(t, err, &log.ErrOffsetOutOfRange{})
+}
+
+func TestFSMRestoreLegacy(t *testing.T) {
+	// Arrange: the legacy snapshots hold the frames of the records of the
+	// default topic, with a length and no checksum.
+	var b []byte
+	for off := uint64(2); off < 5; off++ {
+		p, err := proto.Marshal(&logv1.Record{Value: []byte("hello world"), Offset: off})
+		require.NoError(t, err)
+		b = log.Encoding.AppendUint64(b, uint64(len(p)))
+		b = append(b, p...)
+	}
+	target := newFSM(t)
+	res := target.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders"},
+	}))
+	require.Nil(t, res)
+
+	// Act
+	require.NoError(t, target.Restore(io.NopCloser(bytes.NewReader(b))))
+
+	// Assert
+	require.Empty(t, topicNames(target))
+	lowest, next, err := target.log.Offsets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lowest)
+	require.Equal(t, uint64(5), next)
+	for off := uint64(2); off < 5; off++ {
+		record, err := target.log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, "hello world", string(record.Value))
+	}
+}
+
+func TestFSMSnapshotRetained(t *testing.T) {
+	// Arrange: the retained offset is in the middle of a segment.
+	source := newFSM(t)
+	for i := 0; i < 5; i++ {
+		_, err := source.log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, source.log.Retain(0))
+
+	// Act
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	target := newFSM(t)
+	snapshotRestore(t, s, target)
+
+	// Assert: the target retains the same records as the source.
+	for _, f := range []*fsm{source, target} {
+		lowest, next, err := f.log.Offsets()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), lowest)
+		require.Equal(t, uint64(5), next)
+		_, err = f.log.Read(0)
+		require.ErrorAs(t, err, &log.ErrOffsetOutOfRange{})
+	}
+}
+
+func TestFSMTopics(t *testing.T) {
+	// Arrange
+	source := newFSM(t)
+	for _, topic := range []*logv1.Topic{
+		{Name: "orders", Config: &logv1.TopicConfig{Partitions: 2}},
+		{Name: "audit"},
+	} {
+		res := source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+			Topic: topic,
+		}))
+		require.Nil(t, res)
+	}
+	res := source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders"},
+	}))
+	require.Equal(t, log.ErrTopicExists{Name: "orders"}, res)
+	res = source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "../orders"},
+	}))
+	require.IsType(t, log.ErrInvalidTopic{}, res)
+
+	// Act: the appends of the batch are routed to their partition.
+	var logs []*raft.Log
+	for _, id := range []partitionID{
+		{topic: "orders"},
+		{topic: "orders"},
+		{},
+		{topic: "audit"},
+		{topic: "orders", partition: 1},
+	} {
+		logs = append(logs, command(t, AppendRequestType, &logv1.ProduceRequest{
+			Topic:     id.topic,
+			Partition: &id.partition,
+			Record:    &logv1.Record{Value: []byte(id.topic)},
+		}))
+	}
+	logs = append(logs, command(t, AppendRequestType, &logv1.ProduceRequest{
+		Topic:  "metrics",
+		Record: &logv1.Record{Value: []byte("metrics")},
+	}))
+	results := source.ApplyBatch(logs)
+
+	// Assert
+	var offsets []uint64
+	for _, res := range results[:5] {
+		offsets = append(offsets, res.(*logv1.ProduceResponse).Offset)
+	}
+	require.Equal(t, []uint64{0, 1, 0, 0, 0}, offsets)
+	require.Equal(t, uint32(1), results[4].(*logv1.ProduceResponse).Partition)
+	require.Equal(t, log.ErrTopicNotFound{Name: "metrics"}, results[5])
+	require.Equal(t, []string{"audit", "orders"}, topicNames(source))
+
+	// The snapshot holds the topics and their records, and the topics
+	// deleted since are restored.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	res = source.Apply(command(t, DeleteTopicRequestType, &logv1.DeleteTopicRequest{
+		Name: "audit",
+	}))
+	require.Nil(t, res)
+	require.Equal(t, []string{"orders"}, topicNames(source))
+
+	target := newFSM(t)
+	res = target.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "metrics"},
+	}))
+	require.Nil(t, res)
+	snapshotRestore(t, s, target)
+
+	require.Equal(t, []string{"audit", "orders"}, topicNames(target))
+	for p, want := range []uint64{2, 1} {
+		err = target.view(partitionID{topic: "orders", partition: uint32(p)}, func(l *log.Log) error {
+			record, err := l.Read(want - 1)
+			require.NoError(t, err)
+			require.Equal(t, "orders", string(record.Value))
+			require.Equal(t, want, l.NextOffset())
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	_, err = os.Stat(filepath.Join(target.dir, "metrics"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFSMTieredPartitions(t *testing.T) {
+	// Arrange: every sealed segment is offloaded.
+	f := newFSM(t)
+	archive := log.LocalArchive{Dir: filepath.Join(f.dir, "..", "archive")}
+	f.config.Tiering = log.Tiering{Archive: archive, LocalMaxBytes: 1}
+	createOrders := func() {
+		res := f.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+			Topic: &logv1.Topic{Name: "orders", Config: &logv1.TopicConfig{Partitions: 2}},
+		}))
+		require.Nil(t, res)
+	}
+	createOrders()
+
+	// Act
+	for i := 0; i < 4; i++ {
+		for p := uint32(0); p < 2; p++ {
+			res := f.Apply(command(t, AppendRequestType, &logv1.ProduceRequest{
+				Topic:     "orders",
+				Partition: &p,
+				Record:    &logv1.Record{Value: []byte(fmt.Sprintf("%d-%d", p, i))},
+			}))
+			require.Equal(t, uint64(i), res.(*logv1.ProduceResponse).Offset)
+		}
+	}
+	for p := uint32(0); p < 2; p++ {
+		err := f.view(partitionID{topic: "orders", partition: p}, func(l *log.Log) error {
+			return l.Offload(time.Now())
+		})
+		require.NoError(t, err)
+	}
+
+	// Assert: each partition reads its own archived segments.
+	for p := uint32(0); p < 2; p++ {
+		segments, err := archive.Scope(fmt.Sprintf("topics/orders/%d", p)).List(context.Background())
+		require.NoError(t, err)
+		require.NotEmpty(t, segments)
+		require.Equal(t, uint64(0), segments[0].BaseOffset)
+		err = f.view(partitionID{topic: "orders", partition: p}, func(l *log.Log) error {
+			for i := uint64(0); i < 4; i++ {
+				record, err := l.Read(i)
+				require.NoError(t, err)
+				require.Equal(t, fmt.Sprintf("%d-%d", p, i), string(record.Value))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// The archived segments are deleted with the topic.
+	res := f.Apply(command(t, DeleteTopicRequestType, &logv1.DeleteTopicRequest{
+		Name: "orders",
+	}))
+	require.Nil(t, res)
+	createOrders()
+	err := f.view(partitionID{topic: "orders"}, func(l *log.Log) error {
+		_, err := l.Read(0)
+		return err
+	})
+	require.ErrorAs(t, err, &log.ErrOffsetOutOfRange{})
+	segments, err := archive.Scope("topics/orders/0").List(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, segments)
+}
+
+func TestFSMTieredRestart(t *testing.T) {
+	// Arrange: every sealed segment of the topic is offloaded.
+	source := newFSM(t)
+	archive := log.LocalArchive{Dir: filepath.Join(source.dir, "..", "archive")}
+	source.config.Tiering = log.Tiering{Archive: archive, LocalMaxBytes: 1}
+	res := source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders"},
+	}))
+	require.Nil(t, res)
+	for i := 0; i < 4; i++ {
+		res := source.Apply(command(t, AppendRequestType, &logv1.ProduceRequest{
+			Topic:  "orders",
+			Record: &logv1.Record{Value: []byte(fmt.Sprintf("order-%d", i))},
+		}))
+		require.IsType(t, &logv1.ProduceResponse{}, res)
+	}
+	err := source.view(partitionID{topic: "orders"}, func(l *log.Log) error {
+		return l.Offload(time.Now())
+	})
+	require.NoError(t, err)
+	segments, err := archive.Scope("topics/orders/0").List(context.Background())
+	require.NoError(t, err)
+	require.NotEmpty(t, segments)
+
+	// Act: the node restarts with an empty topics directory and restores the
+	// topic from its snapshot.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	require.NoError(t, source.Close())
+	target := newFSM(t)
+	target.config.Tiering = source.config.Tiering
+	snapshotRestore(t, s, target)
+
+	// Assert: the offloaded records are read from the archive.
+	err = target.view(partitionID{topic: "orders"}, func(l *log.Log) error {
+		for i := uint64(0); i < 4; i++ {
+			record, err := l.Read(i)
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("order-%d", i), string(record.Value))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestFSMRoute(t *testing.T) {
+	f := newFSM(t)
+	res := f.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders", Config: &logv1.TopicConfig{Partitions: 3}},
+	}))
+	require.Nil(t, res)
+
+	// The records of a key are routed to the same partition.
+	record := &logv1.Record{Key: []byte("customer-1")}
+	want, err := f.route("orders", record)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		p, err := f.route("orders", record)
+		require.NoError(t, err)
+		require.Equal(t, want, p)
+	}
+
+	// The records without key are routed in turn.
+	for _, want := range []uint32{0, 1, 2, 0} {
+		p, err := f.route("orders", &logv1.Record{})
+		require.NoError(t, err)
+		require.Equal(t, want, p)
+	}
+
+	_, err = f.route("metrics", record)
+	require.Equal(t, log.ErrTopicNotFound{Name: "metrics"}, err)
+}
+
+func TestFSMProducers(t *testing.T) {
+	// Arrange
+	source := newFSM(t)
+	res := source.Apply(command(t, InitProducerRequestType, &logv1.InitProducerRequest{}))
+	producerID := res.(*logv1.InitProducerResponse).ProducerId
+	require.Equal(t, uint64(1), producerID)
+	produce := func(producerID, sequence uint64) *raft.Log {
+		return command(t, AppendRequestType, &logv1.ProduceRequest{
+			Record:     &logv1.Record{Value: []byte("hello world")},
+			ProducerId: producerID,
+			Sequence:   sequence,
+		})
+	}
+	offset := func(res interface{}) uint64 {
+		t.Helper()
+		require.IsType(t, &logv1.ProduceResponse{}, res)
+		return res.(*logv1.ProduceResponse).Offset
+	}
+
+	// Act: the records produced again are not appended again, even in the
+	// batch of the record appended first.
+	require.Equal(t, uint64(0), offset(source.Apply(produce(producerID, 0))))
+	require.Equal(t, uint64(0), offset(source.Apply(produce(producerID, 0))))
+	results := source.ApplyBatch([]*raft.Log{
+		produce(producerID, 1),
+		produce(0, 0),
+		produce(producerID, 1),
+		produce(producerID, 2),
+		produce(producerID, 4),
+		produce(producerID+1, 0),
+	})
+
+	// Assert
+	require.Equal(t, uint64(1), offset(results[0]))
+	require.Equal(t, uint64(2), offset(results[1]))
+	require.Equal(t, uint64(1), offset(results[2]))
+	require.Equal(t, uint64(3), offset(results[3]))
+	require.Equal(t, log.ErrOutOfOrderSequence{
+		ProducerID: producerID,
+		Sequence:   4,
+		Expected:   3,
+	}, results[4])
+	require.Equal(t, log.ErrUnknownProducer{ID: producerID + 1}, results[5])
+	require.Equal(t, uint64(4), source.log.NextOffset())
+
+	// The snapshot holds the states of the producers.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	target := newFSM(t)
+	snapshotRestore(t, s, target)
+	require.Equal(t, uint64(3), offset(target.Apply(produce(producerID, 2))))
+	require.Equal(t, uint64(4), offset(target.Apply(produce(producerID, 3))))
+	res = target.Apply(command(t, InitProducerRequestType, &logv1.InitProducerRequest{}))
+	require.Equal(t, uint64(2), res.(*logv1.InitProducerResponse).ProducerId)
+}
+
+func TestFSMProducerFailedBatch(t *testing.T) {
+	// Arrange: the appends to the second partition fail.
+	f := newFSM(t)
+	res := f.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders", Config: &logv1.TopicConfig{Partitions: 2}},
+	}))
+	require.Nil(t, res)
+	res = f.Apply(command(t, InitProducerRequestType, &logv1.InitProducerRequest{}))
+	producerID := res.(*logv1.InitProducerResponse).ProducerId
+	err := f.view(partitionID{topic: "orders", partition: 1}, func(l *log.Log) error {
+		return l.Close()
+	})
+	require.NoError(t, err)
+	produce := func(partition uint32, sequence uint64) *raft.Log {
+		return command(t, AppendRequestType, &logv1.ProduceRequest{
+			Topic:      "orders",
+			Partition:  &partition,
+			Record:     &logv1.Record{Value: []byte("hello world")},
+			ProducerId: producerID,
+			Sequence:   sequence,
+		})
+	}
+
+	// Act: the producer switches partitions within the batches.
+	results := f.ApplyBatch([]*raft.Log{
+		produce(0, 0),
+		produce(1, 1),
+	})
+	failed := f.ApplyBatch([]*raft.Log{
+		produce(1, 1),
+		produce(0, 2),
+	})
+
+	// Assert: the sequences of the records not appended are not consumed.
+	require.True(t, proto.Equal(&logv1.ProduceResponse{}, results[0].(*logv1.ProduceResponse)))
+	require.Error(t, results[1].(error))
+	require.Error(t, failed[0].(error))
+	require.Equal(t, log.ErrOutOfOrderSequence{
+		ProducerID: producerID,
+		Sequence:   2,
+		Expected:   1,
+	}, failed[1])
+	want := &logv1.ProducerState{Id: producerID, NextSequence: 1}
+	require.True(t, proto.Equal(want, f.producers[producerID]))
+	res = f.Apply(produce(0, 1))
+	require.True(t, proto.Equal(&logv1.ProduceResponse{Offset: 1}, res.(*logv1.ProduceResponse)))
+}
+
+func TestFSMTxn(t *testing.T) {
+	// Arrange
+	f := newFSM(t)
+	res := f.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders"},
+	}))
+	require.Nil(t, res)
+	produce := func(topic string, value string) *logv1.ProduceRequest {
+		var p uint32
+		return &logv1.ProduceRequest{
+			Topic:     topic,
+			Partition: &p,
+			Record:    &logv1.Record{Value: []byte(value)},
+		}
+	}
+
+	// Act
+	res = f.Apply(command(t, ApplyTxnRequestType, &logv1.ApplyTxnRequest{
+		Records: []*logv1.ProduceRequest{
+			produce("orders", "order"),
+			produce("", "audit"),
+			produce("orders", "order"),
+		},
+	}))
+
+	// Assert
+	require.IsType(t, &logv1.CommitTxnResponse{}, res)
+	var offsets []uint64
+	for _, r := range res.(*logv1.CommitTxnResponse).Records {
+		offsets = append(offsets, r.Offset)
+	}
+	require.Equal(t, []uint64{0, 0, 1}, offsets)
+
+	// A transaction with a record to a missing topic is not appended at all.
+	res = f.ApplyBatch([]*raft.Log{
+		command(t, ApplyTxnRequestType, &logv1.ApplyTxnRequest{
+			Records: []*logv1.ProduceRequest{
+				produce("", "audit"),
+				produce("metrics", "metric"),
+			},
+		}),
+	})[0]
+	require.Equal(t, log.ErrTopicNotFound{Name: "metrics"}, res)
+	require.Equal(t, uint64(1), f.log.NextOffset())
+
+	// A transaction failing to append to a partition is rolled back from the
+	// partitions already appended.
+	err := f.view(partitionID{topic: "orders"}, func(l *log.Log) error {
+		return l.Close()
+	})
+	require.NoError(t, err)
+	res = f.Apply(command(t, ApplyTxnRequestType, &logv1.ApplyTxnRequest{
+		Records: []*logv1.ProduceRequest{
+			produce("", "audit"),
+			produce("", "audit"),
+			produce("", "audit"),
+			produce("orders", "order"),
+		},
+	}))
+	require.Equal(t, log.ErrLogClosed{}, res)
+	require.Equal(t, uint64(1), f.log.NextOffset())
+	off, err := f.log.Append(&logv1.Record{Value: []byte("audit")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+}
+
+func TestFSMGroups(t *testing.T) {
+	// Arrange
+	source := newFSM(t)
+	res := source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders", Config: &logv1.TopicConfig{Partitions: 2}},
+	}))
+	require.Nil(t, res)
+
+	// Act
+	for _, req := range []*logv1.CommitOffsetRequest{
+		{Group: "billing", Topic: "orders", Partition: 1, Offset: 3},
+		{Group: "billing", Offset: 5},
+		{Group: "shipping", Topic: "orders", Offset: 1},
+		{Group: "shipping", Topic: "orders", Offset: 2},
+	} {
+		require.Nil(t, source.Apply(command(t, CommitOffsetRequestType, req)))
+	}
+	res = source.Apply(command(t, CommitOffsetRequestType, &logv1.CommitOffsetRequest{
+		Group: "billing", Topic: "orders", Partition: 2,
+	}))
+
+	// Assert
+	require.Equal(t, log.ErrPartitionNotFound{Topic: "orders", Partition: 2}, res)
+	off, err := source.groupOffset("shipping", partitionID{topic: "orders"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+	_, err = source.groupOffset("billing", partitionID{topic: "orders"})
+	require.Equal(t, log.ErrGroupOffsetNotFound{Group: "billing", Topic: "orders"}, err)
+
+	// The snapshot holds the offsets, and the offsets of a deleted topic are
+	// removed.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	target := newFSM(t)
+	snapshotRestore(t, s, target)
+	require.Len(t, target.groupOffsets(), 3)
+	res = target.Apply(command(t, DeleteTopicRequestType, &logv1.DeleteTopicRequest{
+		Name: "orders",
+	}))
+	require.Nil(t, res)
+	offsets := target.groupOffsets()
+	require.Len(t, offsets, 1)
+	require.Equal(t, "billing", offsets[0].Group)
+	require.Equal(t, uint64(5), offsets[0].Offset)
+}
+
+func TestFSMGroupMembers(t *testing.T) {
+	// Arrange
+	source := newFSM(t)
+	res := source.Apply(command(t, CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: &logv1.Topic{Name: "orders", Config: &logv1.TopicConfig{Partitions: 5}},
+	}))
+	require.Nil(t, res)
+	join := func(f *fsm, member string) *logv1.JoinGroupResponse {
+		t.Helper()
+		res := f.Apply(command(t, JoinGroupRequestType, &logv1.JoinGroupRequest{
+			Group:    "billing",
+			Topic:    "orders",
+			MemberId: member,
+		}))
+		require.IsType(t, &logv1.JoinGroupResponse{}, res)
+		return res.(*logv1.JoinGroupResponse)
+	}
+	commit := func(f *fsm, member string, generation uint64) interface{} {
+		return f.Apply(command(t, CommitOffsetRequestType, &logv1.CommitOffsetRequest{
+			Group:      "billing",
+			Topic:      "orders",
+			Offset:     1,
+			MemberId:   member,
+			Generation: generation,
+		}))
+	}
+
+	// Act: the partitions are assigned in ranges to the members sorted by ID.
+	require.Equal(t, []uint32{0, 1, 2, 3, 4}, join(source, "b").Partitions)
+	a := join(source, "a")
+	require.Equal(t, uint64(2), a.Generation)
+	require.Equal(t, []uint32{0, 1, 2}, a.Partitions)
+	session, _, err := source.session("billing", "b")
+	require.NoError(t, err)
+	require.Equal(t, []uint32{3, 4}, session.Partitions)
+
+	// Joining again keeps the generation.
+	require.Equal(t, uint64(2), join(source, "a").Generation)
+
+	// Assert: the commits of a previous generation are fenced off.
+	require.Nil(t, commit(source, "a", 2))
+	require.Equal(t, log.ErrStaleGeneration{Group: "billing", Generation: 1, Current: 2}, commit(source, "b", 1))
+	require.Equal(t, log.ErrStaleGeneration{Group: "billing", Current: 2}, commit(source, "", 0))
+	require.Equal(t, log.ErrUnknownMember{Group: "billing", Member: "c"}, commit(source, "c", 2))
+	res = source.Apply(command(t, JoinGroupRequestType, &logv1.JoinGroupRequest{
+		Group:    "billing",
+		Topic:    "audit",
+		MemberId: "c",
+	}))
+	require.Equal(t, log.ErrTopicNotFound{Name: "audit"}, res)
+
+	// The membership is in the snapshot.
+	s, err := source.Snapshot()
+	require.NoError(t, err)
+	target := newFSM(t)
+	snapshotRestore(t, s, target)
+	res = target.Apply(command(t, LeaveGroupRequestType, &logv1.LeaveGroupRequest{
+		Group:    "billing",
+		MemberId: "a",
+	}))
+	require.Nil(t, res)
+	session, _, err = target.session("billing", "b")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), session.Generation)
+	require.Equal(t, []uint32{0, 1, 2, 3, 4}, session.Partitions)
+	_, _, err = target.session("billing", "a")
+	require.Equal(t, log.ErrUnknownMember{Group: "billing", Member: "a"}, err)
+}
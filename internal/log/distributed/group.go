@@ -0,0 +1,53 @@
+package distributed
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+)
+
+// CommitOffset commits the offset of the next record the consumer group
+// consumes from the partition of the topic, on every node through Raft.
+//
+// If the group has members, the offset must be committed by a member of its
+// current generation, or ErrStaleGeneration is returned.
+func (l *Log) CommitOffset(req *logv1.CommitOffsetRequest) error {
+	_, err := l.apply(CommitOffsetRequestType, req)
+	return err
+}
+
+// FetchOffset returns the offset committed by the consumer group for the
+// partition of the topic, as known to the node, or ErrGroupOffsetNotFound.
+func (l *Log) FetchOffset(group, topic string, partition uint32) (uint64, error) {
+	return l.fsm.groupOffset(group, partitionID{topic: topic, partition: partition})
+}
+
+// ListGroups returns the consumer groups known to the node, sorted by name,
+// and their lag: the number of records from their offset to the next offset
+// of the partition.
+func (l *Log) ListGroups() []*logv1.ConsumerGroup {
+	var groups []*logv1.ConsumerGroup
+	for _, req := range l.fsm.groupOffsets() {
+		offset := &logv1.GroupOffset{
+			Topic:     req.Topic,
+			Partition: req.Partition,
+			Offset:    req.Offset,
+		}
+		id := partitionID{topic: req.Topic, partition: req.Partition}
+		err := l.fsm.view(id, func(l *log.Log) error {
+			if next := l.NextOffset(); next > offset.Offset {
+				offset.Lag = next - offset.Offset
+			}
+			return nil
+		})
+		if err != nil {
+			// The topic was deleted since, with the offsets of its partitions.
+			continue
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != req.Group {
+			groups = append(groups, &logv1.ConsumerGroup{Name: req.Group})
+		}
+		group := groups[len(groups)-1]
+		group.Offsets = append(group.Offsets, offset)
+	}
+	return groups
+}
@@ -0,0 +1,167 @@
+package distributed
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/proto"
+)
+
+// replicationTransport is a Raft transport recording the index of the last
+// Raft entry stored by each node, from the AppendEntries requests the node
+// acknowledged to the leader.
+type replicationTransport struct {
+	raft.Transport
+
+	mu      sync.Mutex
+	matches map[raft.ServerID]uint64
+}
+
+var (
+	_ raft.Transport = (*replicationTransport)(nil)
+	_ raft.WithClose = (*replicationTransport)(nil)
+)
+
+func newReplicationTransport(transport raft.Transport) *replicationTransport {
+	return &replicationTransport{
+		Transport: transport,
+		matches:   make(map[raft.ServerID]uint64),
+	}
+}
+
+func (t *replicationTransport) AppendEntries(
+	id raft.ServerID,
+	target raft.ServerAddress,
+	args *raft.AppendEntriesRequest,
+	resp *raft.AppendEntriesResponse,
+) error {
+	if err := t.Transport.AppendEntries(id, target, args, resp); err != nil {
+		return err
+	}
+	t.record(id, args, resp)
+	return nil
+}
+
+func (t *replicationTransport) AppendEntriesPipeline(
+	id raft.ServerID,
+	target raft.ServerAddress,
+) (raft.AppendPipeline, error) {
+	pipeline, err := t.Transport.AppendEntriesPipeline(id, target)
+	if err != nil {
+		return nil, err
+	}
+	p := &replicationPipeline{
+		AppendPipeline: pipeline,
+		consumer:       make(chan raft.AppendFuture),
+		done:           make(chan struct{}),
+	}
+	go p.consume(t, id)
+	return p, nil
+}
+
+// Close closes the underlying transport.
+func (t *replicationTransport) Close() error {
+	if closer, ok := t.Transport.(raft.WithClose); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// record records the index of the last entry of the request acknowledged by
+// the node. The heartbeats, which carry no entry, are ignored.
+func (t *replicationTransport) record(
+	id raft.ServerID,
+	args *raft.AppendEntriesRequest,
+	resp *raft.AppendEntriesResponse,
+) {
+	if !resp.Success || args.PrevLogEntry == 0 && len(args.Entries) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.matches[id] = args.PrevLogEntry + uint64(len(args.Entries))
+}
+
+// match returns the index of the last entry stored by the node, if known.
+func (t *replicationTransport) match(id raft.ServerID) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index, ok := t.matches[id]
+	return index, ok
+}
+
+// replicationPipeline records the responses of the AppendEntries requests of
+// a pipeline before handing them to Raft.
+type replicationPipeline struct {
+	raft.AppendPipeline
+
+	consumer  chan raft.AppendFuture
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (p *replicationPipeline) consume(t *replicationTransport, id raft.ServerID) {
+	for {
+		select {
+		case future := <-p.AppendPipeline.Consumer():
+			if future.Error() == nil {
+				t.record(id, future.Request(), future.Response())
+			}
+			select {
+			case p.consumer <- future:
+			case <-p.done:
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *replicationPipeline) Consumer() <-chan raft.AppendFuture {
+	return p.consumer
+}
+
+func (p *replicationPipeline) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return p.AppendPipeline.Close()
+}
+
+// Replication returns the progress of the Raft log replicating the
+// partitions.
+//
+// The index of the last entry stored by the other nodes is known to the
+// leader only.
+func (l *Log) Replication() (*logv1.Replication, error) {
+	future := l.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	_, leader := l.raft.LeaderWithID()
+	isLeader := l.raft.State() == raft.Leader
+	replication := &logv1.Replication{
+		CommitIndex:  l.raft.CommitIndex(),
+		AppliedIndex: l.raft.AppliedIndex(),
+		LastIndex:    l.raft.LastIndex(),
+	}
+	for _, srv := range future.Configuration().Servers {
+		replica := &logv1.Replica{
+			Id:     string(srv.ID),
+			Leader: srv.ID == leader,
+			Voter:  srv.Suffrage == raft.Voter,
+		}
+		switch {
+		case srv.ID == l.config.Raft.LocalID:
+			replica.MatchIndex = proto.Uint64(replication.LastIndex)
+		case isLeader:
+			if index, ok := l.transport.match(srv.ID); ok {
+				replica.MatchIndex = proto.Uint64(index)
+			}
+		}
+		replication.Replicas = append(replication.Replicas, replica)
+	}
+	return replication, nil
+}
@@ -1,23 +1,60 @@
 package distributed
 
 import (
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
 	"io"
 
 	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/proto"
 )
 
 var _ raft.FSMSnapshot = (*snapshot)(nil)
 
+// snapshotMarker starts the snapshots holding a header. The first byte of a
+// frame is its version, which is never 0xff, so the legacy snapshots made of
+// the frames of the records of the default topic are told apart.
+var snapshotMarker = []byte("\xffsnap/v1")
+
+// snapshot persists a point-in-time snapshot of the topics, which is released
+// once persisted.
+//
+// The marker and the header describing the topics are followed by the frames
+// of their logs, in the order of the header.
 type snapshot struct {
-	reader io.Reader
+	header    *logv1.SnapshotHeader
+	snapshots []*log.Snapshot
 }
 
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	if _, err := io.Copy(sink, s.reader); err != nil {
+	if err := s.persist(sink); err != nil {
 		_ = sink.Cancel()
 		return err
 	}
 	return sink.Close()
 }
 
-func (s *snapshot) Release() {}
+func (s *snapshot) persist(w io.Writer) error {
+	b, err := proto.Marshal(s.header)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(snapshotMarker); err != nil {
+		return err
+	}
+	if _, err := log.WriteFrame(w, b); err != nil {
+		return err
+	}
+	for _, ls := range s.snapshots {
+		if _, err := io.Copy(w, ls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *snapshot) Release() {
+	for _, ls := range s.snapshots {
+		_ = ls.Close()
+	}
+}
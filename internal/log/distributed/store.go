@@ -5,16 +5,27 @@ import (
 	"distributed-systems/internal/log"
 
 	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var _ raft.LogStore = (*logStore)(nil)
 
+// logStore stores the Raft log in a log of any backend, an entry per record.
+// The entry is encoded as a RaftEntry in the value of the record.
 type logStore struct {
-	*log.Log
+	log.CommitLog
+}
+
+// batchAppender is implemented by the backends appending a batch of records
+// at once.
+type batchAppender interface {
+	AppendBatch([]*logv1.Record) (first, last uint64, err error)
 }
 
 func newLogStore(dir string, c log.Config) (*logStore, error) {
-	log, err := log.NewLog(dir, c)
+	log, err := log.Open(dir, c)
 	if err != nil {
 		return nil, err
 	}
@@ -37,13 +48,69 @@ func (l *logStore) GetLog(index uint64, log *raft.Log) error {
 	if err != nil {
 		return err
 	}
-	log.Data = in.GetValue()
+	entry, err := raftEntry(in)
+	if err != nil {
+		return err
+	}
 	log.Index = in.GetOffset()
-	log.Type = raft.LogType(in.GetType())
-	log.Term = in.GetTerm()
+	log.Term = entry.GetTerm()
+	log.Type = raft.LogType(entry.GetType())
+	log.Data = entry.GetData()
+	log.Extensions = entry.GetExtensions()
+	if entry.AppendedAt != nil {
+		log.AppendedAt = entry.AppendedAt.AsTime()
+	}
 	return nil
 }
 
+// raftEntry decodes the Raft entry of the record.
+//
+// The records written before RaftEntry hold the data as their value, and the
+// term and type in the fields 3 and 4, since removed from Record. Those
+// records are told apart by the presence of either field, whatever its
+// value: a legacy record with a zero term is still decoded as legacy. Only a
+// legacy record with both a zero term and a zero type, which Raft never
+// writes, would be decoded as a RaftEntry.
+func raftEntry(record *logv1.Record) (*logv1.RaftEntry, error) {
+	legacy := &logv1.RaftEntry{Data: record.GetValue()}
+	var isLegacy bool
+	b := record.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, log.ErrCorruptRecord{Offset: record.GetOffset()}
+		}
+		b = b[n:]
+		if typ == protowire.VarintType && (num == 3 || num == 4) {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, log.ErrCorruptRecord{Offset: record.GetOffset()}
+			}
+			isLegacy = true
+			if num == 3 {
+				legacy.Term = v
+			} else {
+				legacy.Type = uint32(v)
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, log.ErrCorruptRecord{Offset: record.GetOffset()}
+		}
+		b = b[n:]
+	}
+	if isLegacy {
+		return legacy, nil
+	}
+	entry := &logv1.RaftEntry{}
+	if err := proto.Unmarshal(record.GetValue(), entry); err != nil {
+		return nil, log.ErrCorruptRecord{Offset: record.GetOffset()}
+	}
+	return entry, nil
+}
+
 // LastIndex implements raft.LogStore.
 func (l *logStore) LastIndex() (uint64, error) {
 	return l.HighestOffset()
@@ -56,12 +123,32 @@ func (l *logStore) StoreLog(log *raft.Log) error {
 
 // StoreLogs implements raft.LogStore.
 func (l *logStore) StoreLogs(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	records := make([]*logv1.Record, 0, len(logs))
 	for _, log := range logs {
-		if _, err := l.Append(&logv1.Record{
-			Value: log.Data,
-			Term:  log.Term,
-			Type:  uint32(log.Type),
-		}); err != nil {
+		entry := &logv1.RaftEntry{
+			Term:       log.Term,
+			Type:       uint32(log.Type),
+			Data:       log.Data,
+			Extensions: log.Extensions,
+		}
+		if !log.AppendedAt.IsZero() {
+			entry.AppendedAt = timestamppb.New(log.AppendedAt)
+		}
+		value, err := proto.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		records = append(records, &logv1.Record{Value: value})
+	}
+	if b, ok := l.CommitLog.(batchAppender); ok {
+		_, _, err := b.AppendBatch(records)
+		return err
+	}
+	for _, record := range records {
+		if _, err := l.Append(record); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,99 @@
+package distributed
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestLogStore(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, s *logStore){
+		"store and get logs": testLogStoreGetLog,
+		"get legacy records": testLogStoreLegacy,
+	} {
+		for _, backend := range []log.Backend{
+			log.BackendSegments,
+			log.BackendMemory,
+			log.BackendPebble,
+		} {
+			t.Run(scenario+"/"+backend.String(), func(t *testing.T) {
+				dir, err := os.MkdirTemp("", "log-store-test")
+				require.NoError(t, err)
+				defer os.RemoveAll(dir)
+
+				c := log.Config{Backend: backend}
+				c.Segment.InitialOffset = 1
+				s, err := newLogStore(dir, c)
+				require.NoError(t, err)
+				defer s.Close()
+
+				fn(t, s)
+			})
+		}
+	}
+}
+
+func testLogStoreGetLog(t *testing.T, s *logStore) {
+	appendedAt := time.Unix(1700000000, 0).UTC()
+	want := []*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: []byte("config")},
+		{
+			Index:      2,
+			Term:       2,
+			Type:       raft.LogCommand,
+			Data:       []byte("command"),
+			Extensions: []byte("extensions"),
+			AppendedAt: appendedAt,
+		},
+	}
+	require.NoError(t, s.StoreLogs(want))
+
+	for _, want := range want {
+		var got raft.Log
+		require.NoError(t, s.GetLog(want.Index, &got))
+		require.Equal(t, *want, got)
+	}
+	last, err := s.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), last)
+}
+
+func testLogStoreLegacy(t *testing.T, s *logStore) {
+	// The records written before RaftEntry hold the term and type in the
+	// fields since removed from Record.
+	for _, want := range []raft.Log{
+		{Index: 1, Term: 2, Type: raft.LogBarrier, Data: []byte("command")},
+		// A zero term is not encoded: the record is legacy by its type.
+		{Index: 2, Term: 0, Type: raft.LogBarrier, Data: []byte("command")},
+	} {
+		_, err := s.Append(legacyRecord(want))
+		require.NoError(t, err)
+
+		var got raft.Log
+		require.NoError(t, s.GetLog(want.Index, &got))
+		require.Equal(t, want, got)
+	}
+}
+
+// legacyRecord returns the record of the entry as written before RaftEntry,
+// with its term and type encoded as proto3 fields, omitted when zero.
+func legacyRecord(entry raft.Log) *logv1.Record {
+	record := &logv1.Record{Value: entry.Data}
+	var legacy []byte
+	if entry.Term != 0 {
+		legacy = protowire.AppendTag(legacy, 3, protowire.VarintType)
+		legacy = protowire.AppendVarint(legacy, entry.Term)
+	}
+	if entry.Type != 0 {
+		legacy = protowire.AppendTag(legacy, 4, protowire.VarintType)
+		legacy = protowire.AppendVarint(legacy, uint64(entry.Type))
+	}
+	record.ProtoReflect().SetUnknown(legacy)
+	return record
+}
@@ -0,0 +1,242 @@
+package distributed
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+	"fmt"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// maxTopicNameLen is the maximum length of the name of a topic.
+	maxTopicNameLen = 249
+	// maxPartitions is the maximum number of partitions of a topic.
+	maxPartitions = 1024
+)
+
+// validateTopic returns ErrInvalidTopic unless the name is made of 1 to 249
+// ASCII letters, digits, '.', '_' and '-', and is neither "." nor "..", so
+// that it is a valid directory name, and the topic has at most 1024
+// partitions.
+func validateTopic(topic *logv1.Topic) error {
+	name := topic.GetName()
+	invalidName := log.ErrInvalidTopic{
+		Name:   name,
+		Reason: fmt.Sprintf("the name must be 1 to %d letters, digits, '.', '_' and '-'", maxTopicNameLen),
+	}
+	if name == "" || name == "." || name == ".." || len(name) > maxTopicNameLen {
+		return invalidName
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return invalidName
+		}
+	}
+	if topic.GetConfig().GetPartitions() > maxPartitions {
+		return log.ErrInvalidTopic{
+			Name:   name,
+			Reason: fmt.Sprintf("a topic has at most %d partitions", maxPartitions),
+		}
+	}
+	return nil
+}
+
+// keyPartition returns the partition of the key among n partitions.
+func keyPartition(key []byte, n uint32) uint32 {
+	return uint32(xxhash.Sum64(key) % uint64(n))
+}
+
+// CreateTopic creates the topic on every node through Raft.
+func (l *Log) CreateTopic(topic *logv1.Topic) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	_, err := l.apply(CreateTopicRequestType, &logv1.CreateTopicRequest{
+		Topic: topic,
+	})
+	return err
+}
+
+// DeleteTopic deletes the topic and its records on every node through Raft.
+func (l *Log) DeleteTopic(name string) error {
+	_, err := l.apply(DeleteTopicRequestType, &logv1.DeleteTopicRequest{
+		Name: name,
+	})
+	return err
+}
+
+// ListTopics returns the named topics known to the node, sorted by name.
+func (l *Log) ListTopics() []*logv1.Topic {
+	return l.fsm.listTopics()
+}
+
+// ListPartitions returns the partitions of the topic, the default one if
+// name is empty.
+//
+// The topics are replicated by a single Raft group: the leader of the
+// cluster leads every partition, and every node replicates them.
+func (l *Log) ListPartitions(name string) ([]*logv1.Partition, error) {
+	n, err := l.fsm.partitions(name)
+	if err != nil {
+		return nil, err
+	}
+	future := l.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	var replicas []string
+	for _, srv := range future.Configuration().Servers {
+		if srv.Suffrage == raft.Voter {
+			replicas = append(replicas, string(srv.ID))
+		}
+	}
+	_, leader := l.raft.LeaderWithID()
+	partitions := make([]*logv1.Partition, 0, n)
+	for p := uint32(0); p < n; p++ {
+		partition := &logv1.Partition{
+			Id:       p,
+			Leader:   string(leader),
+			Replicas: replicas,
+		}
+		err := l.fsm.view(partitionID{topic: name, partition: p}, func(l *log.Log) error {
+			partition.NextOffset = l.NextOffset()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+// Topic returns the topic of the given name, or ErrTopicNotFound if the node
+// does not know it.
+func (l *Log) Topic(name string) (*Topic, error) {
+	if _, err := l.fsm.partitions(name); err != nil {
+		return nil, err
+	}
+	return &Topic{name: name, log: l}, nil
+}
+
+// Topic is a named topic of a distributed log.
+//
+// Its methods return ErrTopicNotFound once the topic is deleted.
+type Topic struct {
+	name string
+	log  *Log
+}
+
+// Partitions returns the number of partitions of the topic.
+func (t *Topic) Partitions() (uint32, error) {
+	return t.log.fsm.partitions(t.name)
+}
+
+// Append replicates the record through Raft and returns its partition and
+// offset.
+//
+// The partition of a record with a key is the xxhash of the key modulo the
+// number of partitions, so that the records of a key are ordered. The
+// records without key are spread over the partitions in turn.
+func (t *Topic) Append(record *logv1.Record) (uint32, uint64, error) {
+	p, err := t.log.fsm.route(t.name, record)
+	if err != nil {
+		return 0, 0, err
+	}
+	off, err := t.log.append(partitionID{topic: t.name, partition: p}, record)
+	return p, off, err
+}
+
+// Partition returns the partition of the topic, or ErrPartitionNotFound.
+func (t *Topic) Partition(p uint32) (*Partition, error) {
+	n, err := t.Partitions()
+	if err != nil {
+		return nil, err
+	}
+	if p >= n {
+		return nil, log.ErrPartitionNotFound{Topic: t.name, Partition: p}
+	}
+	return &Partition{id: partitionID{topic: t.name, partition: p}, log: t.log}, nil
+}
+
+// Partition is a partition of a topic of a distributed log.
+type Partition struct {
+	id  partitionID
+	log *Log
+}
+
+// Append replicates the record of the partition through Raft and returns its
+// offset.
+func (p *Partition) Append(record *logv1.Record) (uint64, error) {
+	return p.log.append(p.id, record)
+}
+
+func (p *Partition) Read(offset uint64) (record *logv1.Record, err error) {
+	err = p.log.fsm.view(p.id, func(l *log.Log) error {
+		record, err = l.Read(offset)
+		return err
+	})
+	return record, err
+}
+
+func (p *Partition) ReadEncoded(offset uint64) (record []byte, err error) {
+	err = p.log.fsm.view(p.id, func(l *log.Log) error {
+		record, err = l.ReadEncoded(offset)
+		return err
+	})
+	return record, err
+}
+
+// Iterator returns an iterator over the records of the partition starting at
+// from.
+//
+// Like Read, the iterator reads the records of a transaction once all of
+// them are appended. It returns io.EOF once the topic is deleted.
+func (p *Partition) Iterator(from uint64, opts ...log.IteratorOption) (it *log.Iterator, err error) {
+	opts = append(opts, log.WithLock(p.log.fsm.mu.RLocker()))
+	err = p.log.fsm.view(p.id, func(l *log.Log) error {
+		it, err = l.Iterator(from, opts...)
+		return err
+	})
+	return it, err
+}
+
+// WaitForOffset blocks until the record at the offset is appended to the
+// partition, or ctx is done. It returns io.EOF once the topic is deleted.
+func (p *Partition) WaitForOffset(ctx context.Context, offset uint64) error {
+	var waiter *log.Log
+	err := p.log.fsm.view(p.id, func(l *log.Log) error {
+		waiter = l
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The log is not held while waiting so that the topic can be deleted.
+	return waiter.WaitForOffset(ctx, offset)
+}
+
+// Offsets returns the offset of the first record retained by the partition,
+// and the offset of the next record appended to it.
+func (p *Partition) Offsets() (lowest, next uint64, err error) {
+	err = p.log.fsm.view(p.id, func(l *log.Log) error {
+		lowest, next, err = l.Offsets()
+		return err
+	})
+	return lowest, next, err
+}
+
+func (p *Partition) OffsetForTime(ts time.Time) (offset uint64, err error) {
+	err = p.log.fsm.view(p.id, func(l *log.Log) error {
+		offset, err = l.OffsetForTime(ts)
+		return err
+	})
+	return offset, err
+}
@@ -0,0 +1,150 @@
+package distributed
+
+import (
+	"crypto/rand"
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/log"
+	"encoding/binary"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// txnTimeout is the time after which a transaction which is not committed is
+// aborted.
+const txnTimeout = time.Minute
+
+// txn is a transaction begun by the node, and the records staged in it.
+type txn struct {
+	deadline time.Time
+	records  []*logv1.ProduceRequest
+}
+
+// BeginTxn begins a transaction and returns its ID.
+//
+// The transactions are staged by the node, and are lost if it stops. They are
+// aborted if not committed within a minute. Only the leader begins
+// transactions, since only the leader commits them.
+func (l *Log) BeginTxn() (uint64, error) {
+	if l.raft.State() != raft.Leader {
+		return 0, raft.ErrNotLeader
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	id := binary.BigEndian.Uint64(b[:])
+	now := time.Now()
+	l.txnMu.Lock()
+	defer l.txnMu.Unlock()
+	for id, t := range l.txns {
+		if now.After(t.deadline) {
+			delete(l.txns, id)
+		}
+	}
+	if l.txns == nil {
+		l.txns = make(map[uint64]*txn)
+	}
+	l.txns[id] = &txn{deadline: now.Add(txnTimeout)}
+	return id, nil
+}
+
+// ProduceTxn stages the record of the request in the transaction and returns
+// its partition: the partition of the request, or the partition chosen by the
+// topic if unset.
+func (l *Log) ProduceTxn(id uint64, req *logv1.ProduceRequest) (uint32, error) {
+	req = proto.Clone(req).(*logv1.ProduceRequest)
+	if req.Partition == nil {
+		p, err := l.fsm.route(req.Topic, req.GetRecord())
+		if err != nil {
+			return 0, err
+		}
+		req.Partition = &p
+	} else {
+		n, err := l.fsm.partitions(req.Topic)
+		if err != nil {
+			return 0, err
+		}
+		if *req.Partition >= n {
+			return 0, log.ErrPartitionNotFound{Topic: req.Topic, Partition: *req.Partition}
+		}
+	}
+	if req.Record == nil {
+		req.Record = &logv1.Record{}
+	}
+	l.txnMu.Lock()
+	defer l.txnMu.Unlock()
+	t, err := l.txn(id)
+	if err != nil {
+		return 0, err
+	}
+	t.records = append(t.records, req)
+	return req.GetPartition(), nil
+}
+
+// CommitTxn appends the records of the transaction in a single Raft entry,
+// and returns their partitions and offsets.
+//
+// If the FSM fails to append the records, the transaction stays staged, so
+// that the commit can be retried or the transaction aborted. If Raft fails,
+// the records may have been committed anyway: the transaction is dropped so
+// that they are not committed twice.
+func (l *Log) CommitTxn(id uint64) ([]*logv1.ProduceResponse, error) {
+	l.txnMu.Lock()
+	t, err := l.txn(id)
+	if err == nil {
+		// The transaction is taken out while committed so that it is not
+		// committed twice concurrently.
+		delete(l.txns, id)
+	}
+	l.txnMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(t.records) == 0 {
+		return nil, nil
+	}
+	// The records of the transaction share the same append time.
+	now := timestamppb.Now()
+	for _, req := range t.records {
+		req.Record.AppendTime = now
+	}
+	res, err := l.applyResponse(ApplyTxnRequestType, &logv1.ApplyTxnRequest{
+		Records: t.records,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := res.(error); ok {
+		l.txnMu.Lock()
+		l.txns[id] = t
+		l.txnMu.Unlock()
+		return nil, err
+	}
+	return res.(*logv1.CommitTxnResponse).Records, nil
+}
+
+// AbortTxn drops the records of the transaction.
+func (l *Log) AbortTxn(id uint64) error {
+	l.txnMu.Lock()
+	defer l.txnMu.Unlock()
+	if _, err := l.txn(id); err != nil {
+		return err
+	}
+	delete(l.txns, id)
+	return nil
+}
+
+// txn returns the transaction, or ErrTxnNotFound if it expired.
+//
+// l.txnMu must be held.
+func (l *Log) txn(id uint64) (*txn, error) {
+	t, ok := l.txns[id]
+	if !ok || time.Now().After(t.deadline) {
+		delete(l.txns, id)
+		return nil, log.ErrTxnNotFound{ID: id}
+	}
+	return t, nil
+}
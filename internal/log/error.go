@@ -1,5 +1,7 @@
 package log
 
+import "fmt"
+
 var _ error = ErrOffsetOutOfRange{}
 
 type ErrOffsetOutOfRange struct {
@@ -9,3 +11,212 @@ type ErrOffsetOutOfRange struct {
 func (e ErrOffsetOutOfRange) Error() string {
 	return "offset out of range"
 }
+
+var _ error = ErrLogClosed{}
+
+// ErrLogClosed is returned when a log is used after it is closed.
+type ErrLogClosed struct{}
+
+func (e ErrLogClosed) Error() string {
+	return "log is closed"
+}
+
+var _ error = ErrCorruptRecord{}
+
+// ErrCorruptRecord is returned when a record fails its checksum or cannot be
+// decoded.
+type ErrCorruptRecord struct {
+	Offset uint64
+	// Segment is the base offset of the segment containing the record.
+	Segment uint64
+}
+
+func (e ErrCorruptRecord) Error() string {
+	return fmt.Sprintf("corrupt record at offset %d in segment %d", e.Offset, e.Segment)
+}
+
+var _ error = ErrOffsetCompacted{}
+
+// ErrOffsetCompacted is returned when the record at the given offset was
+// removed by the log compaction.
+type ErrOffsetCompacted struct {
+	Offset uint64
+	// Next is the offset of the next record available.
+	Next uint64
+}
+
+func (e ErrOffsetCompacted) Error() string {
+	return fmt.Sprintf("offset %d was compacted, next offset is %d", e.Offset, e.Next)
+}
+
+var _ error = ErrOffsetTruncated{}
+
+// ErrOffsetTruncated is returned by an iterator whose next record was removed
+// by the log retention.
+type ErrOffsetTruncated struct {
+	Offset uint64
+	// Lowest is the lowest offset of the log.
+	Lowest uint64
+}
+
+func (e ErrOffsetTruncated) Error() string {
+	return fmt.Sprintf("offset %d was truncated, lowest offset is %d", e.Offset, e.Lowest)
+}
+
+var _ error = ErrTopicNotFound{}
+
+// ErrTopicNotFound is returned when the requested topic does not exist.
+type ErrTopicNotFound struct {
+	Name string
+}
+
+func (e ErrTopicNotFound) Error() string {
+	return fmt.Sprintf("topic %q not found", e.Name)
+}
+
+var _ error = ErrTopicExists{}
+
+// ErrTopicExists is returned when creating a topic that already exists.
+type ErrTopicExists struct {
+	Name string
+}
+
+func (e ErrTopicExists) Error() string {
+	return fmt.Sprintf("topic %q already exists", e.Name)
+}
+
+var _ error = ErrInvalidTopic{}
+
+// ErrInvalidTopic is returned when creating a topic whose name or
+// configuration is not valid.
+type ErrInvalidTopic struct {
+	Name   string
+	Reason string
+}
+
+func (e ErrInvalidTopic) Error() string {
+	return fmt.Sprintf("invalid topic %q: %s", e.Name, e.Reason)
+}
+
+var _ error = ErrPartitionNotFound{}
+
+// ErrPartitionNotFound is returned when the requested partition is not a
+// partition of the topic.
+type ErrPartitionNotFound struct {
+	Topic     string
+	Partition uint32
+}
+
+func (e ErrPartitionNotFound) Error() string {
+	return fmt.Sprintf("partition %d of topic %q not found", e.Partition, e.Topic)
+}
+
+var _ error = ErrUnknownProducer{}
+
+// ErrUnknownProducer is returned when a record is produced with a producer ID
+// that was not returned by InitProducer.
+type ErrUnknownProducer struct {
+	ID uint64
+}
+
+func (e ErrUnknownProducer) Error() string {
+	return fmt.Sprintf("unknown producer %d", e.ID)
+}
+
+var _ error = ErrOutOfOrderSequence{}
+
+// ErrOutOfOrderSequence is returned when a record of an idempotent producer
+// is neither the next record of the producer nor its last record produced
+// again.
+type ErrOutOfOrderSequence struct {
+	ProducerID uint64
+	Sequence   uint64
+	// Expected is the sequence number of the next record of the producer.
+	Expected uint64
+}
+
+func (e ErrOutOfOrderSequence) Error() string {
+	return fmt.Sprintf(
+		"out of order sequence %d of producer %d, expected %d",
+		e.Sequence,
+		e.ProducerID,
+		e.Expected,
+	)
+}
+
+var _ error = ErrTxnNotFound{}
+
+// ErrTxnNotFound is returned when the transaction was not begun by the node,
+// or is committed, aborted or expired.
+type ErrTxnNotFound struct {
+	ID uint64
+}
+
+func (e ErrTxnNotFound) Error() string {
+	return fmt.Sprintf("transaction %d not found", e.ID)
+}
+
+var _ error = ErrGroupOffsetNotFound{}
+
+// ErrGroupOffsetNotFound is returned when the consumer group committed no
+// offset for the partition.
+type ErrGroupOffsetNotFound struct {
+	Group     string
+	Topic     string
+	Partition uint32
+}
+
+func (e ErrGroupOffsetNotFound) Error() string {
+	return fmt.Sprintf(
+		"group %q committed no offset for partition %d of topic %q",
+		e.Group,
+		e.Partition,
+		e.Topic,
+	)
+}
+
+var _ error = ErrInvalidGroup{}
+
+// ErrInvalidGroup is returned when a consumer joins a group with a name or a
+// topic which is not valid.
+type ErrInvalidGroup struct {
+	Name   string
+	Reason string
+}
+
+func (e ErrInvalidGroup) Error() string {
+	return fmt.Sprintf("invalid group %q: %s", e.Name, e.Reason)
+}
+
+var _ error = ErrUnknownMember{}
+
+// ErrUnknownMember is returned when the consumer is not a member of the
+// group, because it left it or was evicted.
+type ErrUnknownMember struct {
+	Group  string
+	Member string
+}
+
+func (e ErrUnknownMember) Error() string {
+	return fmt.Sprintf("unknown member %q of group %q", e.Member, e.Group)
+}
+
+var _ error = ErrStaleGeneration{}
+
+// ErrStaleGeneration is returned when a consumer commits an offset in a
+// generation of its group which is not the current one.
+type ErrStaleGeneration struct {
+	Group      string
+	Generation uint64
+	// Current is the current generation of the group.
+	Current uint64
+}
+
+func (e ErrStaleGeneration) Error() string {
+	return fmt.Sprintf(
+		"stale generation %d of group %q, current is %d",
+		e.Generation,
+		e.Group,
+		e.Current,
+	)
+}
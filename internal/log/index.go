@@ -1,98 +1,268 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"os"
+	"sort"
 	"syscall"
 	"unsafe"
 )
 
 var (
-	offWidth   uint64 = 4
+	offWidth   uint64 = 8
 	posWidth   uint64 = 8
 	entryWidth        = offWidth + posWidth
+
+	// headerWidth is the width of the header of the index file: a magic
+	// number followed by the version of the format.
+	headerWidth uint64 = 8
+	// indexMagic starts the header. As the relative offset of a v1 entry, it
+	// would be greater than the number of records a v1 segment could hold.
+	indexMagic = []byte{0xff, 'I', 'D', 'X'}
+
+	// The v1 format has no header, and its entries are 4 bytes for the
+	// offset and 8 bytes for the position.
+	v1OffWidth   uint64 = 4
+	v1EntryWidth        = v1OffWidth + posWidth
+
+	// indexGrowth is the room left in the map of an index when opened.
+	indexGrowth = 64 * entryWidth
 )
 
+const indexVersion uint32 = 2
+
+// index maps the relative offsets of the records to their positions in the
+// store.
+//
+// The file starts with a header, followed by the entries: 8 bytes for the
+// relative offset and 8 bytes for the position. The file and its map grow as
+// entries are written, and the file is truncated back to its entries when
+// closed.
 type index struct {
 	file *os.File
 	mmap []byte
+	// size is the size of the entries, header excluded.
 	size uint64
+	// max is the maximum size of the entries, or 0 if not limited.
+	max uint64
 }
 
 func newIndex(f *os.File, c Config) (*index, error) {
 	idx := &index{
 		file: f,
+		max:  c.Segment.MaxIndexBytes,
 	}
 	fi, err := f.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("stat: %w", err)
 	}
-	idx.size = uint64(fi.Size())
+	size := uint64(fi.Size())
+	header := make([]byte, headerWidth)
+	if _, err := f.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	version := Encoding.Uint32(header[len(indexMagic):])
+	switch {
+	case !bytes.Equal(header[:len(indexMagic)], indexMagic) && size > 0:
+		if size, err = idx.migrate(size); err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+	case version > indexVersion:
+		return nil, fmt.Errorf("unknown index version %d", version)
+	case version != indexVersion:
+		// The header is missing or torn: the index is rebuilt from the store.
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		if err := idx.writeHeader(); err != nil {
+			return nil, err
+		}
+		size = headerWidth
+	}
+	idx.size = max(size, headerWidth) - headerWidth
 
-	// Allocate the memory for the index.
-	if err = f.Truncate(int64(c.Segment.MaxIndexBytes)); err != nil {
+	if err := idx.remap(headerWidth + idx.size + indexGrowth); err != nil {
 		return nil, err
 	}
-	if idx.mmap, err = syscall.Mmap(
-		int(f.Fd()),
+	return idx, nil
+}
+
+// writeHeader writes the header of an empty index.
+func (i *index) writeHeader() error {
+	header := make([]byte, headerWidth)
+	copy(header, indexMagic)
+	Encoding.PutUint32(header[len(indexMagic):], indexVersion)
+	if _, err := i.file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	return nil
+}
+
+// migrate rewrites an index of the v1 format, of the given size, and returns
+// the size of the rewritten file.
+//
+// The index is rewritten in place: if interrupted, it is rebuilt from the
+// store when the segment is opened again.
+func (i *index) migrate(size uint64) (uint64, error) {
+	v1 := make([]byte, size)
+	if _, err := i.file.ReadAt(v1, 0); err != nil {
+		return 0, err
+	}
+	n := size / v1EntryWidth
+	v2 := make([]byte, headerWidth+n*entryWidth)
+	copy(v2, indexMagic)
+	Encoding.PutUint32(v2[len(indexMagic):], indexVersion)
+	for k := uint64(0); k < n; k++ {
+		e1, e2 := v1[k*v1EntryWidth:], v2[headerWidth+k*entryWidth:]
+		Encoding.PutUint64(e2, uint64(Encoding.Uint32(e1)))
+		copy(e2[offWidth:entryWidth], e1[v1OffWidth:v1EntryWidth])
+	}
+	if err := i.file.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := i.file.WriteAt(v2, 0); err != nil {
+		return 0, err
+	}
+	if err := i.file.Sync(); err != nil {
+		return 0, err
+	}
+	slog.Info("migrated index", "index", i.file.Name(), "entries", n)
+	return uint64(len(v2)), nil
+}
+
+// remap resizes the file and its map to the given capacity, which is
+// limited to the maximum size of the index.
+func (i *index) remap(capacity uint64) error {
+	if i.max > 0 {
+		capacity = min(capacity, headerWidth+max(i.max, i.size))
+	}
+	if i.mmap != nil {
+		if err := syscall.Munmap(i.mmap); err != nil {
+			return fmt.Errorf("unmap: %w", err)
+		}
+		i.mmap = nil
+	}
+	if err := i.file.Truncate(int64(capacity)); err != nil {
+		return err
+	}
+	mmap, err := syscall.Mmap(
+		int(i.file.Fd()),
 		0,
-		int(c.Segment.MaxIndexBytes),
+		int(capacity),
 		syscall.PROT_READ|syscall.PROT_WRITE,
 		syscall.MAP_SHARED,
-	); err != nil {
-		return nil, fmt.Errorf("mmap: %w", err)
+	)
+	if err != nil {
+		return fmt.Errorf("mmap: %w", err)
 	}
-	return idx, nil
+	i.mmap = mmap
+	return nil
 }
 
-func (i *index) Close() error {
-	if _, _, err := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&i.mmap[0])), uintptr(i.size), uintptr(syscall.MS_SYNC)); err != 0 {
+// Sync commits the entries of the index to stable storage.
+func (i *index) Sync() error {
+	if _, _, err := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&i.mmap[0])), uintptr(headerWidth+i.size), uintptr(syscall.MS_SYNC)); err != 0 {
 		return fmt.Errorf("msync: %w", err)
 	}
-	if err := syscall.Munmap(i.mmap); err != nil {
-		return fmt.Errorf("unmap: %w", err)
-	}
 	if err := i.file.Sync(); err != nil {
 		return fmt.Errorf("sync: %w", err)
 	}
+	return nil
+}
+
+func (i *index) Close() error {
+	if err := i.Sync(); err != nil {
+		return err
+	}
+	if err := syscall.Munmap(i.mmap); err != nil {
+		return fmt.Errorf("unmap: %w", err)
+	}
 	// Truncate to the true size of the index.
-	if err := i.file.Truncate(int64(i.size)); err != nil {
+	if err := i.file.Truncate(int64(headerWidth + i.size)); err != nil {
 		return fmt.Errorf("truncate: %w", err)
 	}
 	return i.file.Close()
 }
 
-func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
+func (i *index) Read(in int64) (out uint64, pos uint64, err error) {
 	if i.size == 0 {
 		return 0, 0, io.EOF
 	}
 	if in == -1 {
-		out = uint32((i.size / entryWidth) - 1)
+		out = (i.size / entryWidth) - 1
 	} else {
-		out = uint32(in)
+		out = uint64(in)
 	}
-	pos = uint64(out) * entryWidth
-	if i.size < pos+entryWidth {
+	pos = headerWidth + out*entryWidth
+	if headerWidth+i.size < pos+entryWidth {
 		return 0, 0, io.EOF
 	}
-	// 4 bytes for the offset and 8 bytes for the position.
-	out = Encoding.Uint32(i.mmap[pos : pos+offWidth])
+	// 8 bytes for the offset and 8 bytes for the position.
+	out = Encoding.Uint64(i.mmap[pos : pos+offWidth])
 	pos = Encoding.Uint64(i.mmap[pos+offWidth : pos+entryWidth])
 	return out, pos, nil
 }
 
-func (i *index) Write(off uint32, pos uint64) error {
-	if uint64(len(i.mmap)) < i.size+entryWidth {
+// Search returns the first entry whose relative offset is greater than or
+// equal to in.
+//
+// The offsets may be sparse if the segment was compacted.
+func (i *index) Search(in uint64) (out uint64, pos uint64, err error) {
+	n := i.size / entryWidth
+	// Fast path for dense indexes.
+	if in < n {
+		if out, pos, err = i.Read(int64(in)); err == nil && out == in {
+			return out, pos, nil
+		}
+	}
+	k := sort.Search(int(n), func(k int) bool {
+		out, _, _ := i.Read(int64(k))
+		return out >= in
+	})
+	return i.Read(int64(k))
+}
+
+// Write appends an entry to the index, growing the map if needed.
+//
+// It returns io.EOF if the index reached its maximum size.
+func (i *index) Write(off uint64, pos uint64) error {
+	if i.Room() == 0 {
 		return io.EOF
 	}
-	// 4 bytes for the offset and 8 bytes for the position.
-	Encoding.PutUint32(i.mmap[i.size:i.size+offWidth], off)
-	Encoding.PutUint64(i.mmap[i.size+offWidth:i.size+entryWidth], pos)
+	end := headerWidth + i.size + entryWidth
+	if uint64(len(i.mmap)) < end {
+		if err := i.remap(max(2*uint64(len(i.mmap)), end)); err != nil {
+			return err
+		}
+	}
+	// 8 bytes for the offset and 8 bytes for the position.
+	e := i.mmap[headerWidth+i.size : end]
+	Encoding.PutUint64(e[:offWidth], off)
+	Encoding.PutUint64(e[offWidth:], pos)
 	i.size += entryWidth
 	return nil
 }
 
+// Room returns the number of entries that can still be written.
+//
+// It returns math.MaxUint64 if the size of the index is not limited.
+func (i *index) Room() uint64 {
+	if i.max == 0 {
+		return math.MaxUint64
+	}
+	return (i.max - min(i.size, i.max)) / entryWidth
+}
+
+// Truncate keeps the first n entries and zeroes the rest of the index.
+func (i *index) Truncate(n uint64) {
+	i.size = min(n*entryWidth, uint64(len(i.mmap))-headerWidth)
+	clear(i.mmap[headerWidth+i.size:])
+}
+
 func (i *index) Name() string {
 	return i.file.Name()
 }
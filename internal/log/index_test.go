@@ -2,6 +2,7 @@ package log
 
 import (
 	"io"
+	"math"
 	"os"
 	"testing"
 
@@ -38,7 +39,7 @@ func TestIndex(t *testing.T) {
 
 	// Act: Write and read
 	entries := []struct {
-		Off uint32
+		Off uint64
 		Pos uint64
 	}{
 		{Off: 0, Pos: 0},
@@ -68,6 +69,102 @@ func TestIndex(t *testing.T) {
 	require.NoError(t, err)
 	off, pos, err := idx.Read(-1)
 	require.NoError(t, err)
-	require.Equal(t, uint32(1), off)
+	require.Equal(t, uint64(1), off)
 	require.Equal(t, entries[1].Pos, pos)
 }
+
+func TestIndexSearch(t *testing.T) {
+	// Arrange: a sparse index
+	config := Config{
+		Segment: Segment{
+			MaxIndexBytes: 1024,
+		},
+	}
+	idx := prepareIndex(config)
+	defer os.Remove(idx.file.Name())
+	defer idx.Close()
+	for _, off := range []uint64{0, 1, 4, 5, 9} {
+		require.NoError(t, idx.Write(off, uint64(off)*10))
+	}
+
+	// Act & Assert
+	for in, want := range map[uint64]uint64{0: 0, 1: 1, 2: 4, 4: 4, 6: 9, 9: 9} {
+		out, pos, err := idx.Search(in)
+		require.NoError(t, err)
+		require.Equal(t, want, out)
+		require.Equal(t, uint64(want)*10, pos)
+	}
+	_, _, err := idx.Search(10)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestIndexGrowth(t *testing.T) {
+	// Arrange: an index without size limit.
+	idx := prepareIndex(Config{})
+	fname := idx.file.Name()
+	defer os.Remove(fname)
+
+	// Act: write past the initial map, and past the uint32 offsets.
+	n := 4 * indexGrowth / entryWidth
+	for k := uint64(0); k < n; k++ {
+		require.NoError(t, idx.Write(k<<32, k*10))
+	}
+	require.Equal(t, uint64(math.MaxUint64), idx.Room())
+	require.NoError(t, idx.Close())
+
+	// Assert: the file is truncated to its entries and reopens.
+	fi, err := os.Stat(fname)
+	require.NoError(t, err)
+	require.Equal(t, int64(headerWidth+n*entryWidth), fi.Size())
+	f, err := os.OpenFile(fname, os.O_RDWR, 0600)
+	require.NoError(t, err)
+	idx, err = newIndex(f, Config{})
+	require.NoError(t, err)
+	defer idx.Close()
+	for k := uint64(0); k < n; k++ {
+		out, pos, err := idx.Search(k << 32)
+		require.NoError(t, err)
+		require.Equal(t, k<<32, out)
+		require.Equal(t, k*10, pos)
+	}
+}
+
+func TestIndexMigration(t *testing.T) {
+	// Arrange: an index of the v1 format.
+	f, err := os.CreateTemp("", "index")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	entries := []struct {
+		Off uint32
+		Pos uint64
+	}{
+		{Off: 0, Pos: 0},
+		{Off: 1, Pos: 10},
+		{Off: 3, Pos: 20},
+	}
+	v1 := make([]byte, 0, len(entries)*int(v1EntryWidth))
+	for _, e := range entries {
+		v1 = Encoding.AppendUint32(v1, e.Off)
+		v1 = Encoding.AppendUint64(v1, e.Pos)
+	}
+	_, err = f.Write(v1)
+	require.NoError(t, err)
+
+	// Act
+	idx, err := newIndex(f, Config{})
+	require.NoError(t, err)
+	defer idx.Close()
+
+	// Assert
+	require.Equal(t, uint64(len(entries))*entryWidth, idx.size)
+	for k, e := range entries {
+		out, pos, err := idx.Read(int64(k))
+		require.NoError(t, err)
+		require.Equal(t, uint64(e.Off), out)
+		require.Equal(t, e.Pos, pos)
+	}
+	header := make([]byte, headerWidth)
+	_, err = f.ReadAt(header, 0)
+	require.NoError(t, err)
+	require.Equal(t, indexMagic, header[:len(indexMagic)])
+}
@@ -0,0 +1,270 @@
+package log
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Iterator reads the records of a log in order, streaming the frames of the
+// segments instead of looking up every offset in the indexes.
+type Iterator struct {
+	log *Log
+	// ctx is the context until which Next waits for appends, or nil if Next
+	// returns io.EOF at the end of the log.
+	ctx context.Context
+	// lock is held while the records are read, if set.
+	lock sync.Locker
+
+	// off is the offset of the next record, or a lower offset if the records
+	// in between were compacted.
+	off uint64
+	// segment and pos are the segment and the store position of the next
+	// frame. segment is nil until positioned.
+	segment *segment
+	pos     uint64
+}
+
+type IteratorOption func(*Iterator)
+
+// WithWait makes Next wait for the next record to be appended, until ctx is
+// done, instead of returning io.EOF at the end of the log.
+func WithWait(ctx context.Context) IteratorOption {
+	return func(it *Iterator) {
+		it.ctx = ctx
+	}
+}
+
+// WithLock makes the iterator hold lock while reading the records, so that
+// the records appended under the lock are read together.
+func WithLock(lock sync.Locker) IteratorOption {
+	return func(it *Iterator) {
+		it.lock = lock
+	}
+}
+
+// Iterator returns an iterator over the records of the log starting at from,
+// or ErrLogClosed.
+//
+// The offloaded segments are read through the archive.
+func (l *Log) Iterator(from uint64, opts ...IteratorOption) (*Iterator, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed() {
+		return nil, ErrLogClosed{}
+	}
+	it := &Iterator{log: l, off: from}
+	for _, o := range opts {
+		o(it)
+	}
+	return it, nil
+}
+
+// recordOffsetField is the field number of the offset of a record.
+var recordOffsetField = (&logv1.Record{}).ProtoReflect().Descriptor().Fields().
+	ByName("offset").Number()
+
+// recordOffset returns the offset of the encoded record, without decoding
+// the other fields.
+func recordOffset(p []byte) (uint64, error) {
+	var off uint64
+	for len(p) > 0 {
+		num, typ, n := protowire.ConsumeTag(p)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		p = p[n:]
+		if num == recordOffsetField && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(p)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			// The last occurrence of the field wins.
+			off, p = v, p[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, p)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		p = p[n:]
+	}
+	return off, nil
+}
+
+// Offset returns the offset following the last record returned, at or before
+// the offset of the next record.
+func (it *Iterator) Offset() uint64 {
+	return it.off
+}
+
+// errArchived is returned by read when the next record is offloaded.
+var errArchived = errors.New("record is archived")
+
+// Next returns the next record of the log.
+//
+// At the end of the log, Next returns io.EOF, or waits for the next record if
+// the iterator was created with WithWait. It returns ErrOffsetTruncated if
+// the next record was removed by the retention, and io.EOF once the log is
+// closed.
+func (it *Iterator) Next() (*logv1.Record, error) {
+	p, err := it.NextEncoded()
+	if err != nil {
+		return nil, err
+	}
+	record := &logv1.Record{}
+	if err := proto.Unmarshal(p, record); err != nil {
+		return nil, ErrCorruptRecord{Offset: it.off - 1}
+	}
+	return record, nil
+}
+
+// NextEncoded returns a copy of the next encoded record of the log, like
+// Next, so that it can be sent without being decoded and encoded again.
+func (it *Iterator) NextEncoded() ([]byte, error) {
+	for {
+		p, appended, err := it.read()
+		switch {
+		case err == nil:
+			return p, nil
+		case errors.Is(err, errArchived):
+			return it.readArchived()
+		case err != io.EOF || it.ctx == nil || appended == nil:
+			return nil, err
+		}
+		select {
+		case <-appended:
+		case <-it.ctx.Done():
+			return nil, it.ctx.Err()
+		}
+	}
+}
+
+// read returns the next local encoded record. At the end of the log, it
+// returns io.EOF and the channel closed by the next append.
+func (it *Iterator) read() ([]byte, <-chan struct{}, error) {
+	if it.lock != nil {
+		it.lock.Lock()
+		defer it.lock.Unlock()
+	}
+	l := it.log
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.appended == nil {
+		return nil, nil, io.EOF
+	}
+	if it.segment == nil || !l.isCurrent(it.segment) {
+		if lowest := l.lowestOffset(); it.off < lowest {
+			return nil, nil, ErrOffsetTruncated{Offset: it.off, Lowest: lowest}
+		}
+		if it.off < l.segments[0].baseOffset {
+			return nil, nil, errArchived
+		}
+		if err := it.seek(); err != nil {
+			return nil, nil, err
+		}
+	}
+	for {
+		unpin, err := l.pin(it.segment)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, n, err := it.segment.frameAt(it.pos)
+		var off uint64
+		if err == nil {
+			off, err = recordOffset(p)
+		}
+		if err == nil && off >= it.off {
+			// The frame of a sealed segment aliases its memory map.
+			p = slices.Clone(p)
+		}
+		unpin()
+		switch {
+		case err == io.EOF && it.segment == l.activeSegment:
+			return nil, l.appended, io.EOF
+		case err == io.EOF:
+			it.off = max(it.off, it.segment.nextOffset)
+			if err := it.seek(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case err != nil:
+			return nil, nil, ErrCorruptRecord{Offset: it.off, Segment: it.segment.baseOffset}
+		}
+		it.pos += n
+		if off < it.off {
+			continue
+		}
+		it.off = off + 1
+		return p, nil, nil
+	}
+}
+
+// seek positions the iterator on the first local record at or after it.off.
+//
+// l.mu must be held.
+func (it *Iterator) seek() error {
+	l := it.log
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].nextOffset > it.off
+	})
+	if i == len(l.segments) {
+		it.segment, it.pos = l.activeSegment, l.activeSegment.store.size
+		return nil
+	}
+	s := l.segments[i]
+	it.segment, it.pos = s, 0
+	if it.off <= s.baseOffset {
+		return nil
+	}
+	unpin, err := l.pin(s)
+	if err != nil {
+		return err
+	}
+	defer unpin()
+	_, pos, err := s.index.Search(it.off - s.baseOffset)
+	if err != nil {
+		return ErrCorruptRecord{Offset: it.off, Segment: s.baseOffset}
+	}
+	it.pos = pos
+	return nil
+}
+
+// readArchived returns the next encoded record from the offloaded segments.
+func (it *Iterator) readArchived() ([]byte, error) {
+	if it.lock != nil {
+		it.lock.Lock()
+		defer it.lock.Unlock()
+	}
+	for {
+		record, err := it.log.Read(it.off)
+		var compacted ErrOffsetCompacted
+		if errors.As(err, &compacted) {
+			it.off = compacted.Next
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		it.off = record.Offset + 1
+		return proto.Marshal(record)
+	}
+}
+
+// isCurrent returns true if s is still a segment of the log, that is it was
+// neither removed nor replaced by the compaction.
+//
+// l.mu must be held.
+func (l *Log) isCurrent(s *segment) bool {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].baseOffset >= s.baseOffset
+	})
+	return i < len(l.segments) && l.segments[i] == s
+}
@@ -0,0 +1,180 @@
+package log
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIterator(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"iterate across segments":        testIterateSegments,
+		"iterate from an offset":         testIterateFrom,
+		"resume after concurrent append": testIterateAppend,
+		"wait for append":                testIterateWait,
+		"truncated under the iterator":   testIterateTruncated,
+		"skip compacted records":         testIterateCompacted,
+		"closed log":                     testIterateClosed,
+		"encoded records":                testIterateEncoded,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "iterator-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// Each segment holds 3 records.
+			c := Config{}
+			c.Segment.MaxIndexBytes = entryWidth * 3
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			for i := 0; i < 7; i++ {
+				key := []byte{byte('a' + i)}
+				if i == 1 || i == 3 || i == 6 {
+					key = []byte("x")
+				}
+				_, err := log.Append(&logv1.Record{
+					Key:   key,
+					Value: []byte(fmt.Sprintf("record %d", i)),
+				})
+				require.NoError(t, err)
+			}
+			require.Len(t, log.segments, 3)
+
+			fn(t, log)
+		})
+	}
+}
+
+// iterator returns an iterator over the records of the log from the offset.
+func iterator(t *testing.T, log *Log, from uint64, opts ...IteratorOption) *Iterator {
+	t.Helper()
+	it, err := log.Iterator(from, opts...)
+	require.NoError(t, err)
+	return it
+}
+
+// requireNext asserts that the next records of the iterator have the given
+// offsets.
+func requireNext(t *testing.T, it *Iterator, offsets ...uint64) {
+	t.Helper()
+	for _, off := range offsets {
+		record, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+		require.Equal(t, fmt.Sprintf("record %d", off), string(record.Value))
+	}
+}
+
+func testIterateSegments(t *testing.T, log *Log) {
+	it := iterator(t, log, 0)
+	requireNext(t, it, 0, 1, 2, 3, 4, 5, 6)
+	_, err := it.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func testIterateEncoded(t *testing.T, log *Log) {
+	require.NoError(t, log.Compact(time.Now()))
+	it := iterator(t, log, 2)
+	for _, want := range []uint64{2, 4, 5, 6} {
+		p, err := it.NextEncoded()
+		require.NoError(t, err)
+		record := &logv1.Record{}
+		require.NoError(t, proto.Unmarshal(p, record))
+		require.Equal(t, want, record.Offset)
+		require.Equal(t, fmt.Sprintf("record %d", want), string(record.Value))
+		require.Equal(t, want+1, it.Offset())
+	}
+	_, err := it.NextEncoded()
+	require.Equal(t, io.EOF, err)
+}
+
+func testIterateFrom(t *testing.T, log *Log) {
+	requireNext(t, iterator(t, log, 4), 4, 5, 6)
+
+	_, err := iterator(t, log, 7).Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func testIterateAppend(t *testing.T, log *Log) {
+	it := iterator(t, log, 5)
+	requireNext(t, it, 5, 6)
+	_, err := it.Next()
+	require.Equal(t, io.EOF, err)
+
+	for i := 7; i < 10; i++ {
+		_, err := log.Append(&logv1.Record{
+			Value: []byte(fmt.Sprintf("record %d", i)),
+		})
+		require.NoError(t, err)
+	}
+	requireNext(t, it, 7, 8, 9)
+}
+
+func testIterateWait(t *testing.T, log *Log) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := iterator(t, log, 6, WithWait(ctx))
+	requireNext(t, it, 6)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = log.Append(&logv1.Record{Value: []byte("record 7")})
+	}()
+	requireNext(t, it, 7)
+
+	cancel()
+	_, err := it.Next()
+	require.Equal(t, context.Canceled, err)
+}
+
+func testIterateTruncated(t *testing.T, log *Log) {
+	it := iterator(t, log, 0)
+	requireNext(t, it, 0, 1)
+
+	require.NoError(t, log.Truncate(2))
+	_, err := it.Next()
+	require.Equal(t, ErrOffsetTruncated{Offset: 2, Lowest: 3}, err)
+
+	_, err = iterator(t, log, 1).Next()
+	require.Equal(t, ErrOffsetTruncated{Offset: 1, Lowest: 3}, err)
+}
+
+func testIterateCompacted(t *testing.T, log *Log) {
+	it := iterator(t, log, 0)
+	requireNext(t, it, 0)
+
+	// The records 1 and 3 are superseded by the record 6.
+	require.NoError(t, log.Compact(time.Now()))
+	_, err := log.Read(3)
+	require.Equal(t, ErrOffsetCompacted{Offset: 3, Next: 4}, err)
+
+	requireNext(t, it, 2, 4, 5, 6)
+	requireNext(t, iterator(t, log, 3), 4, 5, 6)
+}
+
+func testIterateClosed(t *testing.T, log *Log) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := iterator(t, log, 7, WithWait(ctx))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = log.Close()
+	}()
+	_, err := it.Next()
+	require.Equal(t, io.EOF, err)
+
+	_, err = log.Iterator(0)
+	require.Equal(t, ErrLogClosed{}, err)
+}
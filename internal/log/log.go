@@ -1,15 +1,26 @@
 package log
 
 import (
+	"container/list"
+	"context"
 	logv1 "distributed-systems/gen/log/v1"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Log struct {
@@ -20,12 +31,39 @@ type Log struct {
 
 	activeSegment *segment
 	segments      []*segment
+	// archived are the segments offloaded to the archive, which precede the
+	// local segments.
+	archived []ArchivedSegment
+	// startOffset is the lowest offset retained by Retain. The records below
+	// it are not readable even if their segment is kept.
+	startOffset uint64
+
+	// cache holds the segments fetched from the archive, the most recently
+	// used last.
+	cache   []*segment
+	cacheMu sync.Mutex
+
+	// openSegments are the sealed segments whose files are open, the most
+	// recently used first.
+	openSegments list.List
+	openMu       sync.Mutex
+
+	// compactMu prevents segments from being removed while being compacted.
+	compactMu sync.Mutex
+
+	// unsynced is the number of records appended to the active segment since
+	// its last sync.
+	unsynced uint64
+
+	// appended is closed when records are appended, to wake up the waiting
+	// iterators. It is nil once the log is closed.
+	appended chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
 }
 
 func NewLog(dir string, c Config) (*Log, error) {
-	if c.Segment.MaxIndexBytes == 0 {
-		c.Segment.MaxIndexBytes = 1024
-	}
 	if c.Segment.MaxStoreBytes == 0 {
 		c.Segment.MaxStoreBytes = 1024
 	}
@@ -33,35 +71,100 @@ func NewLog(dir string, c Config) (*Log, error) {
 		Dir:    dir,
 		Config: c,
 	}
-	return l, l.setup()
+	if err := l.setup(); err != nil {
+		return nil, err
+	}
+	l.startBackground()
+	return l, nil
 }
 
 func (l *Log) setup() error {
-	files, err := os.ReadDir(l.Dir)
-	if err != nil {
+	l.segments, l.activeSegment = nil, nil
+	l.appended = make(chan struct{})
+	// The snapshots do not survive the log.
+	if err := os.RemoveAll(path.Join(l.Dir, snapshotDir)); err != nil {
 		return fmt.Errorf("setup: %w", err)
 	}
-	var baseOffsets []uint64
-	for _, file := range files {
-		offStr := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		off, _ := strconv.ParseUint(offStr, 10, 0)
-		baseOffsets = append(baseOffsets, off)
+	baseOffsets, err := readBaseOffsets(l.Dir)
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
 	}
-	slices.Sort(baseOffsets)
-	for i := 0; i < len(baseOffsets); i++ {
-		if err = l.newSegment(baseOffsets[i]); err != nil {
+	for _, off := range baseOffsets {
+		if err = l.newSegment(off); err != nil {
 			return err
 		}
-		// baseOffset contains dup for index and store so we skip
-		// the dup
-		i++
 	}
 	if l.segments == nil {
 		if err := l.newSegment(l.Config.Segment.InitialOffset); err != nil {
 			return err
 		}
+	} else if err := l.activeSegment.recover(); err != nil {
+		// Only the last segment may have been interrupted while being written.
+		return err
 	}
-	return nil
+	if err := l.loadStartOffset(); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	return l.loadArchived()
+}
+
+// readBaseOffsets returns the sorted base offsets of the segments in dir.
+//
+// A segment is listed even if either its store or its index is missing.
+func readBaseOffsets(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var baseOffsets []uint64
+	for _, file := range files {
+		ext := path.Ext(file.Name())
+		if ext != ".store" && ext != ".index" {
+			continue
+		}
+		offStr := strings.TrimSuffix(file.Name(), ext)
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		if err != nil {
+			continue
+		}
+		baseOffsets = append(baseOffsets, off)
+	}
+	slices.Sort(baseOffsets)
+	return slices.Compact(baseOffsets), nil
+}
+
+// RebuildIndex regenerates the index of every segment in dir from its store.
+//
+// The segment files are rebuilt directly, without opening the log, and the
+// errors of every segment are returned.
+func RebuildIndex(dir string, c Config) error {
+	baseOffsets, err := readBaseOffsets(dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, off := range baseOffsets {
+		if err := rebuildIndex(dir, off, c); err != nil {
+			errs = append(errs, fmt.Errorf("segment %d: %w", off, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rebuildIndex regenerates the index of the segment at baseOffset from its
+// store.
+func rebuildIndex(dir string, baseOffset uint64, c Config) error {
+	s := &segment{
+		baseOffset: baseOffset,
+		config:     c,
+		dir:        dir,
+	}
+	if err := s.open(os.O_CREATE); err != nil {
+		return err
+	}
+	s.index.Truncate(0)
+	err := s.recover()
+	return errors.Join(err, s.Close())
 }
 
 func (l *Log) newSegment(off uint64) error {
@@ -69,46 +172,529 @@ func (l *Log) newSegment(off uint64) error {
 	if err != nil {
 		return err
 	}
+	sealed := l.activeSegment
 	l.segments = append(l.segments, s)
 	l.activeSegment = s
+	if sealed == nil {
+		return nil
+	}
+	if err := sealed.seal(); err != nil {
+		return err
+	}
+	return l.touch(sealed)
+}
+
+// segmentFor returns the local segment containing off, or nil.
+//
+// l.mu must be held.
+func (l *Log) segmentFor(off uint64) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].baseOffset > off
+	})
+	if i == 0 {
+		return nil
+	}
+	s := l.segments[i-1]
+	if off >= s.nextOffset {
+		return nil
+	}
+	return s
+}
+
+// pin opens the segment if it is cold, and keeps it open until unpin is
+// called.
+func (l *Log) pin(s *segment) (unpin func(), err error) {
+	for {
+		if err := l.touch(s); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		if !s.closed {
+			return s.mu.RUnlock, nil
+		}
+		// Closed again by concurrent reads of other segments.
+		s.mu.RUnlock()
+	}
+}
+
+// touch opens the sealed segment if it is cold and marks it as the most
+// recently used one. The least recently used segments past
+// Segment.MaxOpenSegments are closed.
+//
+// It does nothing for the active segment, which is always open.
+func (l *Log) touch(s *segment) error {
+	if !s.sealed.Load() {
+		return nil
+	}
+	l.openMu.Lock()
+	defer l.openMu.Unlock()
+	if s.lru != nil {
+		l.openSegments.MoveToFront(s.lru)
+		return nil
+	}
+	s.mu.Lock()
+	err := s.reopen()
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("reopen segment %d: %w", s.baseOffset, err)
+	}
+	s.lru = l.openSegments.PushFront(s)
+	limit := l.Config.Segment.MaxOpenSegments
+	for limit > 0 && l.openSegments.Len() > limit {
+		cold := l.openSegments.Remove(l.openSegments.Back()).(*segment)
+		cold.lru = nil
+		cold.mu.Lock()
+		err := cold.Close()
+		cold.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("close segment %d: %w", cold.baseOffset, err)
+		}
+	}
+	return nil
+}
+
+// removeSegment removes the files of a segment leaving the log.
+func (l *Log) removeSegment(s *segment) error {
+	l.untrack(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Remove()
+}
+
+// untrack forgets a segment which is removed or becomes active again.
+func (l *Log) untrack(s *segment) {
+	l.openMu.Lock()
+	defer l.openMu.Unlock()
+	if s.lru != nil {
+		l.openSegments.Remove(s.lru)
+		s.lru = nil
+	}
+}
+
+// startBackground starts the background loops enabled by the configuration.
+func (l *Log) startBackground() {
+	l.done = make(chan struct{})
+	l.every(l.Config.Retention.CheckInterval, l.retain)
+	l.every(l.Config.Compaction.CheckInterval, l.compact)
+	l.every(l.Config.Tiering.CheckInterval, l.offload)
+	if l.Config.Segment.SyncPolicy.Mode == SyncEveryInterval {
+		l.every(l.Config.Segment.SyncPolicy.Interval, l.syncInterval)
+	}
+	openLogs.Add(context.Background(), 1, l.syncPolicyAttributes())
+}
+
+// every runs fn at the given interval until the background loops are
+// stopped. It does nothing if interval is zero.
+func (l *Log) every(interval time.Duration, fn func(now time.Time)) {
+	if interval == 0 {
+		return
+	}
+	l.wg.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	}(l.done)
+}
+
+// stopBackground stops the background loops and waits for them to exit.
+func (l *Log) stopBackground() {
+	if l.done == nil {
+		return
+	}
+	close(l.done)
+	l.done = nil
+	l.wg.Wait()
+	openLogs.Add(context.Background(), -1, l.syncPolicyAttributes())
+}
+
+func (l *Log) syncPolicyAttributes() metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("sync_policy", l.Config.Segment.SyncPolicy.String()),
+	)
+}
+
+// maybeSync syncs the active segment if required by the sync policy, after n
+// records were appended to it. l.mu must be held.
+func (l *Log) maybeSync(n int) error {
+	p := l.Config.Segment.SyncPolicy
+	l.unsynced += uint64(n)
+	if p.Mode == SyncAlways || p.Mode == SyncEveryRecords && l.unsynced >= p.Records {
+		return l.syncActive()
+	}
+	return nil
+}
+
+// syncActive syncs the active segment. l.mu must be held.
+func (l *Log) syncActive() error {
+	if l.unsynced == 0 {
+		return nil
+	}
+	if err := l.activeSegment.Sync(); err != nil {
+		return fmt.Errorf("sync segment %d: %w", l.activeSegment.baseOffset, err)
+	}
+	l.unsynced = 0
+	segmentSyncs.Add(context.Background(), 1, l.syncPolicyAttributes())
 	return nil
 }
 
+// syncInterval syncs the active segment for the SyncEveryInterval policy.
+func (l *Log) syncInterval(time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.syncActive(); err != nil {
+		slog.Error("sync failed", "dir", l.Dir, "error", err)
+	}
+}
+
+// roll seals the active segment, syncing it unless the sync policy is
+// SyncNever and reporting its compression ratio, and creates a new segment at
+// off. l.mu must be held.
+func (l *Log) roll(off uint64) error {
+	if l.Config.Segment.SyncPolicy.Mode != SyncNever {
+		if err := l.syncActive(); err != nil {
+			return err
+		}
+	}
+	l.unsynced = 0
+	segmentCompressionRatio.Record(
+		context.Background(),
+		l.activeSegment.store.CompressionRatio(),
+		metric.WithAttributes(
+			attribute.String("codec", l.Config.Segment.Compression.String()),
+		),
+	)
+	return l.newSegment(off)
+}
+
+// Append appends the record to the log and returns its offset.
+//
+// The append time of the record is set if missing.
 func (l *Log) Append(record *logv1.Record) (uint64, error) {
+	if record.AppendTime == nil {
+		record.AppendTime = timestamppb.Now()
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if l.closed() {
+		return 0, ErrLogClosed{}
+	}
 	off, err := l.activeSegment.Append(record)
 	if err != nil {
 		return 0, err
 	}
+	l.notify()
+	if err := l.maybeSync(1); err != nil {
+		return 0, err
+	}
 	if l.activeSegment.IsMaxed() {
-		if err := l.newSegment(off + 1); err != nil {
+		if err := l.roll(off + 1); err != nil {
 			return 0, err
 		}
 	}
 	return off, nil
 }
 
-func (l *Log) Read(off uint64) (*logv1.Record, error) {
+// AppendBatch appends the records to the log and returns the offsets of the
+// first and the last one.
+//
+// The batch is written to a single segment, unless it is bigger than a whole
+// segment, and the segment is rolled over before or after the batch, never
+// in the middle. The sync policy is applied once per batch. If a record fails
+// to be written, the whole batch is discarded.
+func (l *Log) AppendBatch(records []*logv1.Record) (first, last uint64, err error) {
+	if len(records) == 0 {
+		return 0, 0, errors.New("append batch: empty batch")
+	}
+	now := timestamppb.Now()
+	for _, record := range records {
+		if record.AppendTime == nil {
+			record.AppendTime = now
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed() {
+		return 0, 0, ErrLogClosed{}
+	}
+
+	s := l.activeSegment
+	if s.nextOffset > s.baseOffset && s.index.Room() < uint64(len(records)) {
+		if err := l.roll(s.nextOffset); err != nil {
+			return 0, 0, err
+		}
+	}
+	n, m := len(l.segments), l.activeSegment.mark()
+	first = l.activeSegment.nextOffset
+	for _, record := range records {
+		if l.activeSegment.index.Room() == 0 {
+			err = l.roll(l.activeSegment.nextOffset)
+		}
+		if err == nil {
+			last, err = l.activeSegment.Append(record)
+		}
+		if err != nil {
+			return 0, 0, errors.Join(err, l.rollback(n, m))
+		}
+	}
+	l.notify()
+	if err := l.maybeSync(len(records)); err != nil {
+		return 0, 0, err
+	}
+	if l.activeSegment.IsMaxed() {
+		if err := l.roll(last + 1); err != nil {
+			return 0, 0, err
+		}
+	}
+	return first, last, nil
+}
+
+// closed returns whether the log is closed. l.mu must be held.
+func (l *Log) closed() bool {
+	return l.appended == nil
+}
+
+// notify wakes up the iterators waiting for records. l.mu must be held.
+func (l *Log) notify() {
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// rollback removes the segments created after the n-th one and rolls the
+// n-th segment back to the mark.
+func (l *Log) rollback(n int, m segmentMark) error {
+	for _, s := range l.segments[n:] {
+		if err := l.removeSegment(s); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[:n]
+	s := l.segments[n-1]
+	l.activeSegment = s
+	// The segment may have been sealed by the batch.
+	l.untrack(s)
+	s.sealed.Store(false)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.unseal()
+	if err := s.reopen(); err != nil {
+		return err
+	}
+	return s.rollback(m)
+}
+
+// Mark is the state of a log before records are appended, used to roll them
+// back.
+type Mark struct {
+	baseOffset uint64
+	segment    segmentMark
+}
+
+// Mark returns the state of the log before the next append.
+func (l *Log) Mark() Mark {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	var s *segment
-	for _, segment := range l.segments {
-		if segment.baseOffset <= off && off < segment.nextOffset {
-			s = segment
-			break
+	return Mark{
+		baseOffset: l.activeSegment.baseOffset,
+		segment:    l.activeSegment.mark(),
+	}
+}
+
+// Rollback discards the records appended since the mark, which must have
+// been taken after the last append to be kept.
+//
+// It lets several logs be appended to atomically, by rolling back the
+// appended logs if another one fails.
+func (l *Log) Rollback(m Mark) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed() {
+		return ErrLogClosed{}
+	}
+	n := slices.IndexFunc(l.segments, func(s *segment) bool {
+		return s.baseOffset == m.baseOffset
+	})
+	if n < 0 {
+		return fmt.Errorf("rollback to %d: segment not found", m.segment.nextOffset)
+	}
+	if n == len(l.segments)-1 && l.activeSegment.nextOffset == m.segment.nextOffset {
+		return nil
+	}
+	return l.rollback(n+1, m.segment)
+}
+
+// AppendAt appends a record at its own offset, which must not be lower than
+// the next offset of the log.
+//
+// It is used to restore compacted logs, which may have holes.
+func (l *Log) AppendAt(record *logv1.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed() {
+		return ErrLogClosed{}
+	}
+	if record.Offset < l.activeSegment.nextOffset {
+		return fmt.Errorf(
+			"append at %d: offset is lower than the next offset %d",
+			record.Offset,
+			l.activeSegment.nextOffset,
+		)
+	}
+	if err := l.activeSegment.write(record); err != nil {
+		return err
+	}
+	l.notify()
+	if err := l.maybeSync(1); err != nil {
+		return err
+	}
+	if l.activeSegment.IsMaxed() {
+		return l.roll(record.Offset + 1)
+	}
+	return nil
+}
+
+// Read returns the record at the given offset.
+//
+// Records of offloaded segments are fetched from the archive.
+func (l *Log) Read(off uint64) (*logv1.Record, error) {
+	l.mu.RLock()
+	if l.closed() {
+		l.mu.RUnlock()
+		return nil, ErrLogClosed{}
+	}
+	if off < l.startOffset {
+		l.mu.RUnlock()
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	if s := l.segmentFor(off); s != nil {
+		defer l.mu.RUnlock()
+		unpin, err := l.pin(s)
+		if err != nil {
+			return nil, err
 		}
+		defer unpin()
+		return s.Read(off)
 	}
-	if s == nil || s.nextOffset <= off {
+	baseOffset, ok := l.archivedBaseOffset(off)
+	l.mu.RUnlock()
+	if !ok {
 		return nil, ErrOffsetOutOfRange{Offset: off}
 	}
-	return s.Read(off)
+	// The archive is not accessed with the lock held so that appends are not
+	// blocked.
+	return l.readArchived(baseOffset, off)
+}
+
+// ReadEncoded returns the encoded record at the given offset, so that it can
+// be sent without being decoded and encoded again.
+//
+// The record is a copy, and not a view of the memory map of its segment,
+// which may be unmapped as soon as the segment is unpinned.
+func (l *Log) ReadEncoded(off uint64) ([]byte, error) {
+	l.mu.RLock()
+	if l.closed() {
+		l.mu.RUnlock()
+		return nil, ErrLogClosed{}
+	}
+	if off < l.startOffset {
+		l.mu.RUnlock()
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	if s := l.segmentFor(off); s != nil {
+		defer l.mu.RUnlock()
+		unpin, err := l.pin(s)
+		if err != nil {
+			return nil, err
+		}
+		defer unpin()
+		return s.ReadEncoded(off)
+	}
+	l.mu.RUnlock()
+	// The offloaded records are decoded and encoded again.
+	record, err := l.Read(off)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(record)
+}
+
+// OffsetForTime returns the offset of the first record appended at or after
+// t, or the next offset if there is none.
+//
+// The segments are searched by their last append time, and the archive is
+// searched if t is not after the first append time of the local segments.
+func (l *Log) OffsetForTime(t time.Time) (uint64, error) {
+	l.mu.RLock()
+	if l.closed() {
+		l.mu.RUnlock()
+		return 0, ErrLogClosed{}
+	}
+	start := l.startOffset
+	var archived []ArchivedSegment
+	if t.UnixNano() <= l.segments[0].minTime.Load() {
+		archived = slices.Clone(l.archived)
+	}
+	l.mu.RUnlock()
+	if len(archived) > 0 {
+		// The archive is not accessed with the lock held so that appends
+		// are not blocked.
+		off, err := l.archivedOffsetForTime(archived, t)
+		if err == nil {
+			return max(off, start), nil
+		}
+		// The archived segments may be removed by the retention in the
+		// meantime.
+		if err != io.EOF && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed() {
+		return 0, ErrLogClosed{}
+	}
+	// The active segment, which may be empty, is searched last.
+	ts := t.UnixNano()
+	i := sort.Search(len(l.segments)-1, func(i int) bool {
+		return l.segments[i].maxTime.Load() >= ts
+	})
+	s := l.segments[i]
+	unpin, err := l.pin(s)
+	if err != nil {
+		return 0, err
+	}
+	defer unpin()
+	off, err := s.OffsetForTime(t)
+	if err == io.EOF {
+		return l.activeSegment.nextOffset, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return max(off, l.startOffset), nil
 }
 
 func (l *Log) Close() error {
+	l.stopBackground()
+	if err := l.closeCache(); err != nil {
+		return err
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if l.appended != nil {
+		close(l.appended)
+		l.appended = nil
+	}
 	for _, segment := range l.segments {
+		l.untrack(segment)
 		if err := segment.Close(); err != nil {
 			return err
 		}
@@ -116,24 +702,57 @@ func (l *Log) Close() error {
 	return nil
 }
 
+// Remove closes the log and removes its directory.
+//
+// The snapshots not closed yet are kept until closed.
 func (l *Log) Remove() error {
 	if err := l.Close(); err != nil {
 		return err
 	}
-	return os.RemoveAll(l.Dir)
+	entries, err := os.ReadDir(l.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == snapshotDir {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(l.Dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	removeEmpty(path.Join(l.Dir, snapshotDir), l.Dir)
+	return nil
 }
 
 func (l *Log) Reset() error {
 	if err := l.Remove(); err != nil {
 		return err
 	}
-	return l.setup()
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+	if err := l.setup(); err != nil {
+		return err
+	}
+	l.startBackground()
+	return nil
 }
 
+// LowestOffset returns the lowest offset of the log, including the offloaded
+// segments.
 func (l *Log) LowestOffset() (uint64, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.segments[0].baseOffset, nil
+	return l.lowestOffset(), nil
+}
+
+// lowestOffset returns the lowest offset of the log. l.mu must be held.
+func (l *Log) lowestOffset() uint64 {
+	if len(l.archived) > 0 {
+		return max(l.archived[0].BaseOffset, l.startOffset)
+	}
+	return max(l.segments[0].baseOffset, l.startOffset)
 }
 
 func (l *Log) HighestOffset() (uint64, error) {
@@ -146,14 +765,66 @@ func (l *Log) HighestOffset() (uint64, error) {
 	return off - 1, nil
 }
 
-// Truncate removes all segments whose highest offset is lower than lowest.
+// NextOffset returns the offset of the next appended record.
+func (l *Log) NextOffset() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.activeSegment.nextOffset
+}
+
+// Offsets returns the lowest offset of the log and the offset of the next
+// appended record, read together.
+func (l *Log) Offsets() (lowest, next uint64, err error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lowestOffset(), l.activeSegment.nextOffset, nil
+}
+
+// WaitForOffset blocks until the record at off is appended, or ctx is done.
+//
+// It returns ErrOffsetTruncated if off is lower than the lowest offset of the
+// log, and io.EOF once the log is closed.
+func (l *Log) WaitForOffset(ctx context.Context, off uint64) error {
+	for {
+		l.mu.RLock()
+		appended := l.appended
+		if appended == nil {
+			l.mu.RUnlock()
+			return io.EOF
+		}
+		lowest, next := l.lowestOffset(), l.activeSegment.nextOffset
+		l.mu.RUnlock()
+		switch {
+		case off < lowest:
+			return ErrOffsetTruncated{Offset: off, Lowest: lowest}
+		case off < next:
+			return nil
+		}
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Truncate removes all segments whose highest offset is lower than or equal
+// to lowest. The active segment is kept, so that the offsets are not reused.
 func (l *Log) Truncate(lowest uint64) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if l.closed() {
+		return ErrLogClosed{}
+	}
+	if _, _, err := l.removeArchived(lowest); err != nil {
+		return err
+	}
 	var segments []*segment
 	for _, s := range l.segments {
-		if s.nextOffset <= lowest+1 {
-			if err := s.Remove(); err != nil {
+		if s != l.activeSegment && s.nextOffset <= lowest+1 {
+			if err := l.removeSegment(s); err != nil {
 				return err
 			}
 			continue
@@ -165,23 +836,46 @@ func (l *Log) Truncate(lowest uint64) error {
 }
 
 // Reader returns a new io.Reader to read the whole log.
+//
+// The frames are read as stored, so compressed records stay compressed.
+// ReadFrame decompresses them. The offloaded segments are not read, and the
+// read fails if a segment is removed from the log before it is read.
 func (l *Log) Reader() io.Reader {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	readers := make([]io.Reader, len(l.segments))
 	for i, segment := range l.segments {
-		readers[i] = &originReader{segment.store, 0}
+		readers[i] = &originReader{l, segment, 0}
 	}
 	return io.MultiReader(readers...)
 }
 
+// errSegmentRemoved is returned by the Reader when the segment it reads was
+// removed from the log.
+var errSegmentRemoved = errors.New("segment removed")
+
 type originReader struct {
-	*store
-	off int64
+	log     *Log
+	segment *segment
+	off     int64
 }
 
 func (o *originReader) Read(p []byte) (int, error) {
-	n, err := o.ReadAt(p, o.off)
+	l := o.log
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed() {
+		return 0, ErrLogClosed{}
+	}
+	if !l.isCurrent(o.segment) {
+		return 0, fmt.Errorf("segment %d: %w", o.segment.baseOffset, errSegmentRemoved)
+	}
+	unpin, err := l.pin(o.segment)
+	if err != nil {
+		return 0, err
+	}
+	defer unpin()
+	n, err := o.segment.store.ReadAt(p, o.off)
 	o.off += int64(n)
 	return n, err
 }
@@ -1,13 +1,20 @@
 package log
 
 import (
+	"bytes"
+	"context"
 	logv1 "distributed-systems/gen/log/v1"
+	"fmt"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestLog(t *testing.T) {
@@ -19,6 +26,15 @@ func TestLog(t *testing.T) {
 		"init with existing segments":       testInitExisting,
 		"reader":                            testReader,
 		"truncate":                          testTruncate,
+		"corrupt record error":              testCorruptRecordErr,
+		"rebuild missing index":             testRebuildMissingIndex,
+		"rebuild mismatched index":          testRebuildMismatchedIndex,
+		"offset for time":                   testOffsetForTime,
+		"append batch":                      testAppendBatch,
+		"rebuild missing time index":        testRebuildMissingTimeIndex,
+		"read encoded":                      testReadEncoded,
+		"wait for offset":                   testWaitForOffset,
+		"rollback to mark":                  testRollback,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			dir, err := os.MkdirTemp("", "store-test")
@@ -96,8 +112,10 @@ func testReader(t *testing.T, log *Log) {
 	b, err := io.ReadAll(reader)
 	require.NoError(t, err)
 
+	p, err := ReadFrame(bytes.NewReader(b))
+	require.NoError(t, err)
 	read := &logv1.Record{}
-	err = proto.Unmarshal(b[LenWidth:], read)
+	err = proto.Unmarshal(p, read)
 	require.NoError(t, err)
 	require.Equal(t, r.Value, read.Value)
 }
@@ -116,4 +134,605 @@ func testTruncate(t *testing.T, log *Log) {
 
 	_, err = log.Read(0)
 	require.Error(t, err)
+
+	lowest, next, err := log.Offsets()
+	require.NoError(t, err)
+	require.NotZero(t, lowest)
+	require.Equal(t, uint64(3), next)
+}
+
+func testCorruptRecordErr(t *testing.T, log *Log) {
+	r := &logv1.Record{
+		Value: []byte("hello world"),
+	}
+	off, err := log.Append(r)
+	require.NoError(t, err)
+
+	// Flip the last bit of the record on disk.
+	s := log.segments[0]
+	require.NoError(t, s.store.buf.Flush())
+	f, err := os.OpenFile(s.store.Name(), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, int64(s.store.size-1))
+	require.NoError(t, err)
+	b[0] ^= 1
+	_, err = f.WriteAt(b, int64(s.store.size-1))
+	require.NoError(t, err)
+
+	read, err := log.Read(off)
+	require.Nil(t, read)
+	var errCorrupt ErrCorruptRecord
+	require.ErrorAs(t, err, &errCorrupt)
+	require.Equal(t, off, errCorrupt.Offset)
+	require.Equal(t, s.baseOffset, errCorrupt.Segment)
+}
+
+func testRebuildMissingIndex(t *testing.T, o *Log) {
+	r := &logv1.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := o.Append(r)
+		require.NoError(t, err)
+	}
+	require.NoError(t, o.Close())
+	indexes, err := filepath.Glob(path.Join(o.Dir, "*.index"))
+	require.NoError(t, err)
+	for _, index := range indexes {
+		require.NoError(t, os.Remove(index))
+	}
+
+	n, err := NewLog(o.Dir, o.Config)
+	require.NoError(t, err)
+	defer n.Close()
+
+	off, err := n.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+	for i := uint64(0); i < 3; i++ {
+		read, err := n.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, r.Value, read.Value)
+	}
+}
+
+func testRebuildMismatchedIndex(t *testing.T, o *Log) {
+	r := &logv1.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := o.Append(r)
+		require.NoError(t, err)
+	}
+	require.NoError(t, o.Close())
+
+	// Scramble the position of the first entry of the first index, which the
+	// consistency check cannot see.
+	f, err := os.OpenFile(path.Join(o.Dir, "0.index"), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff}, int64(headerWidth+offWidth))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, RebuildIndex(o.Dir, o.Config))
+	require.Error(t, RebuildIndex(path.Join(o.Dir, "missing"), o.Config))
+
+	n, err := NewLog(o.Dir, o.Config)
+	require.NoError(t, err)
+	defer n.Close()
+	for i := uint64(0); i < 3; i++ {
+		read, err := n.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, r.Value, read.Value)
+	}
+}
+
+func testReadEncoded(t *testing.T, log *Log) {
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	// Every record fills a segment: they are all sealed and mapped.
+	require.Len(t, log.segments, 4)
+	for _, s := range log.segments[:3] {
+		require.NotNil(t, s.store.mapping.Load())
+	}
+	require.Nil(t, log.activeSegment.store.mapping.Load())
+
+	var records [][]byte
+	for off := uint64(0); off < 3; off++ {
+		record, err := log.ReadEncoded(off)
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+	_, err := log.ReadEncoded(3)
+	var errOOR ErrOffsetOutOfRange
+	require.ErrorAs(t, err, &errOOR)
+
+	// The records are copied out of the maps, which are unmapped on close.
+	require.NoError(t, log.Close())
+	for off, record := range records {
+		read := &logv1.Record{}
+		require.NoError(t, proto.Unmarshal(record, read))
+		require.Equal(t, []byte("hello world"), read.Value)
+		require.Equal(t, uint64(off), read.Offset)
+	}
+}
+
+func testAppendBatch(t *testing.T, log *Log) {
+	_, err := log.Append(&logv1.Record{Value: []byte("single")})
+	require.NoError(t, err)
+
+	records := []*logv1.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+		{Value: []byte("third")},
+	}
+	first, last, err := log.AppendBatch(records)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	require.Equal(t, uint64(3), last)
+
+	// The batch is not split, even though it exceeds MaxStoreBytes.
+	s := log.segments[len(log.segments)-2]
+	require.Equal(t, first, s.baseOffset)
+	require.Equal(t, last+1, s.nextOffset)
+	require.Equal(t, last+1, log.activeSegment.baseOffset)
+
+	for i, record := range records {
+		read, err := log.Read(first + uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, record.Value, read.Value)
+		require.NotNil(t, read.AppendTime)
+	}
+
+	_, _, err = log.AppendBatch(nil)
+	require.Error(t, err)
+}
+
+func testOffsetForTime(t *testing.T, log *Log) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&logv1.Record{
+			Value:      []byte("hello world"),
+			AppendTime: timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+
+	for _, tt := range []struct {
+		t    time.Time
+		want uint64
+	}{
+		{t: start.Add(-time.Hour), want: 0},
+		{t: start, want: 0},
+		{t: start.Add(90 * time.Second), want: 2},
+		{t: start.Add(4 * time.Minute), want: 4},
+		{t: start.Add(time.Hour), want: 5},
+	} {
+		off, err := log.OffsetForTime(tt.t)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, off, tt.t)
+	}
+}
+
+func testRebuildMissingTimeIndex(t *testing.T, o *Log) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := o.Append(&logv1.Record{
+			Value:      []byte("hello world"),
+			AppendTime: timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, o.Close())
+	indexes, err := filepath.Glob(path.Join(o.Dir, "*.timeindex"))
+	require.NoError(t, err)
+	for _, index := range indexes {
+		require.NoError(t, os.Remove(index))
+	}
+
+	n, err := NewLog(o.Dir, o.Config)
+	require.NoError(t, err)
+	defer n.Close()
+
+	off, err := n.OffsetForTime(start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+}
+
+func TestAppendBatchBiggerThanSegment(t *testing.T) {
+	dir, err := os.MkdirTemp("", "append-batch-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = entryWidth * 2
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	_, err = log.Append(&logv1.Record{Value: []byte("single")})
+	require.NoError(t, err)
+
+	records := make([]*logv1.Record, 5)
+	for i := range records {
+		records[i] = &logv1.Record{Value: []byte("hello world")}
+	}
+	first, last, err := log.AppendBatch(records)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	require.Equal(t, uint64(5), last)
+
+	// The batch starts a new segment and spans as many as needed.
+	var baseOffsets []uint64
+	for _, s := range log.segments {
+		baseOffsets = append(baseOffsets, s.baseOffset)
+	}
+	require.Equal(t, []uint64{0, 1, 3, 5}, baseOffsets)
+	for off := first; off <= last; off++ {
+		_, err := log.Read(off)
+		require.NoError(t, err)
+	}
+}
+
+func TestLogCompression(t *testing.T) {
+	dir, err := os.MkdirTemp("", "compression-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	value := bytes.Repeat([]byte("hello world "), 16)
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	_, err = log.Append(&logv1.Record{Value: value})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	// Reopen the same log with compression: the log is mixed.
+	c.Segment.Compression = CodecZstd
+	log, err = NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	_, err = log.Append(&logv1.Record{Value: value})
+	require.NoError(t, err)
+	require.Greater(t, log.activeSegment.store.CompressionRatio(), float64(1))
+
+	for off := uint64(0); off < 2; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, value, read.Value)
+	}
+
+	// The reader carries the frames as stored.
+	r := log.Reader()
+	for off := uint64(0); off < 2; off++ {
+		p, err := ReadFrame(r)
+		require.NoError(t, err)
+		read := &logv1.Record{}
+		require.NoError(t, proto.Unmarshal(p, read))
+		require.Equal(t, off, read.Offset)
+		require.Equal(t, value, read.Value)
+	}
+	_, err = ReadFrame(r)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestMaxOpenSegments(t *testing.T) {
+	dir, err := os.MkdirTemp("", "open-segments-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Each segment holds 1 record.
+	c := Config{}
+	c.Segment.MaxIndexBytes = entryWidth
+	c.Segment.MaxOpenSegments = 2
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.Len(t, log.segments, 11)
+
+	open := func() (n int) {
+		for _, s := range log.segments {
+			if !s.closed {
+				n++
+			}
+		}
+		return n
+	}
+	// The sealed segments and the active one.
+	require.Equal(t, 3, open())
+
+	for off := uint64(0); off < 10; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+		require.Equal(t, 3, open())
+	}
+	require.False(t, log.segments[8].closed)
+	require.False(t, log.segments[9].closed)
+
+	// The cold segments are reopened at startup only if needed.
+	require.NoError(t, log.Close())
+	log, err = NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	require.Equal(t, 3, open())
+	for off := uint64(0); off < 10; off++ {
+		_, err := log.Read(off)
+		require.NoError(t, err)
+	}
+	r := log.Reader()
+	for off := uint64(0); off < 10; off++ {
+		p, err := ReadFrame(r)
+		require.NoError(t, err)
+		read := &logv1.Record{}
+		require.NoError(t, proto.Unmarshal(p, read))
+		require.Equal(t, off, read.Offset)
+	}
+
+	// A cold segment removed before it is read is not created again.
+	r = log.Reader()
+	require.NoError(t, log.Retain(0))
+	_, err = ReadFrame(r)
+	require.ErrorIs(t, err, errSegmentRemoved)
+	_, err = os.Stat(path.Join(dir, "0.store"))
+	require.True(t, os.IsNotExist(err))
+}
+
+// benchmarkLog returns a log of n segments of one record each.
+func benchmarkLog(b *testing.B, n int, c Config) *Log {
+	dir, err := os.MkdirTemp("", "log-bench")
+	require.NoError(b, err)
+	b.Cleanup(func() { os.RemoveAll(dir) })
+
+	c.Segment.MaxIndexBytes = entryWidth
+	log, err := NewLog(dir, c)
+	require.NoError(b, err)
+	b.Cleanup(func() { log.Close() })
+	for i := 0; i < n; i++ {
+		_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(b, err)
+	}
+	return log
+}
+
+func BenchmarkSegmentLookup(b *testing.B) {
+	c := Config{}
+	c.Segment.MaxOpenSegments = 100
+	log := benchmarkLog(b, 10000, c)
+	n := uint64(len(log.segments) - 1)
+
+	b.Run("linear scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			off := uint64(i) % n
+			var s *segment
+			for _, segment := range log.segments {
+				if segment.baseOffset <= off && off < segment.nextOffset {
+					s = segment
+					break
+				}
+			}
+			if s == nil {
+				b.Fatal("segment not found")
+			}
+		}
+	})
+	b.Run("binary search", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if log.segmentFor(uint64(i)%n) == nil {
+				b.Fatal("segment not found")
+			}
+		}
+	})
+}
+
+func BenchmarkLogRead(b *testing.B) {
+	// The reads cycle through the segments, so that a limit lower than the
+	// number of segments reopens a segment on every read.
+	for _, maxOpen := range []int{0, 100} {
+		b.Run(fmt.Sprintf("max open segments %d", maxOpen), func(b *testing.B) {
+			c := Config{}
+			c.Segment.MaxOpenSegments = maxOpen
+			log := benchmarkLog(b, 1000, c)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := log.Read(uint64(i) % 1000); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy SyncPolicy
+		// unsynced is the number of unsynced records after each append.
+		unsynced []uint64
+	}{
+		{policy: SyncPolicy{Mode: SyncNever}, unsynced: []uint64{1, 2, 3}},
+		{policy: SyncPolicy{Mode: SyncAlways}, unsynced: []uint64{0, 0, 0}},
+		{
+			policy:   SyncPolicy{Mode: SyncEveryRecords, Records: 2},
+			unsynced: []uint64{1, 0, 1},
+		},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "sync-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			c.Segment.SyncPolicy = tt.policy
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			for _, want := range tt.unsynced {
+				_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+				require.Equal(t, want, log.unsynced)
+			}
+		})
+	}
+
+	t.Run("every interval", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "sync-test")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		c := Config{}
+		c.Segment.SyncPolicy = SyncPolicy{
+			Mode:     SyncEveryInterval,
+			Interval: 10 * time.Millisecond,
+		}
+		log, err := NewLog(dir, c)
+		require.NoError(t, err)
+		defer log.Close()
+
+		_, err = log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			log.mu.RLock()
+			defer log.mu.RUnlock()
+			return log.unsynced == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestLogRecovery(t *testing.T) {
+	// Arrange: a log closed cleanly.
+	dir, err := os.MkdirTemp("", "log-recovery-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Close())
+	store, err := os.ReadFile(path.Join(dir, "0.store"))
+	require.NoError(t, err)
+	index, err := os.ReadFile(path.Join(dir, "0.index"))
+	require.NoError(t, err)
+	var ends []int
+	for i := headerWidth + entryWidth; i < uint64(len(index)); i += entryWidth {
+		ends = append(ends, int(Encoding.Uint64(index[i+offWidth:i+entryWidth])))
+	}
+	ends = append(ends, len(store))
+
+	// crash simulates a crash that left the given files on disk, with the
+	// index never truncated back to its true size.
+	crash := func(t *testing.T, store, index []byte) *Log {
+		dir, err := os.MkdirTemp("", "log-recovery-test")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = os.RemoveAll(dir) })
+		require.NoError(t, os.WriteFile(path.Join(dir, "0.store"), store, 0644))
+		padded := make([]byte, headerWidth+indexGrowth)
+		copy(padded, index)
+		require.NoError(t, os.WriteFile(path.Join(dir, "0.index"), padded, 0644))
+		l, err := NewLog(dir, log.Config)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+		return l
+	}
+	assertRecovered := func(t *testing.T, l *Log, complete int) {
+		for i := 0; i < complete; i++ {
+			_, err := l.Read(uint64(i))
+			require.NoError(t, err)
+		}
+		_, err := l.Read(uint64(complete))
+		require.ErrorAs(t, err, &ErrOffsetOutOfRange{})
+
+		// The log must be writable right after the last complete record.
+		off, err := l.Append(&logv1.Record{Value: []byte("after crash")})
+		require.NoError(t, err)
+		require.Equal(t, uint64(complete), off)
+		read, err := l.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, []byte("after crash"), read.Value)
+	}
+
+	t.Run("torn store", func(t *testing.T) {
+		for cut := 0; cut <= len(store); cut++ {
+			complete := 0
+			for complete < len(ends) && ends[complete] <= cut {
+				complete++
+			}
+			l := crash(t, store[:cut], index)
+			assertRecovered(t, l, complete)
+		}
+	})
+
+	t.Run("torn index", func(t *testing.T) {
+		for cut := 0; cut <= len(index); cut++ {
+			l := crash(t, store, index[:cut])
+			// The index is rebuilt from the store.
+			assertRecovered(t, l, len(ends))
+		}
+	})
+}
+
+func testWaitForOffset(t *testing.T, log *Log) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.WaitForOffset(ctx, 2))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = log.Append(&logv1.Record{Value: []byte("hello world")})
+	}()
+	require.NoError(t, log.WaitForOffset(ctx, 3))
+
+	require.NoError(t, log.Truncate(1))
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, ErrOffsetTruncated{Offset: 0, Lowest: lowest}, log.WaitForOffset(ctx, 0))
+
+	timeout, cancelTimeout := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelTimeout()
+	require.Equal(t, context.DeadlineExceeded, log.WaitForOffset(timeout, 4))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = log.Close()
+	}()
+	require.Equal(t, io.EOF, log.WaitForOffset(ctx, 4))
+}
+
+func testRollback(t *testing.T, log *Log) {
+	r := &logv1.Record{Value: []byte("hello world")}
+	_, err := log.Append(r)
+	require.NoError(t, err)
+
+	// The batch spans several segments.
+	m := log.Mark()
+	_, last, err := log.AppendBatch([]*logv1.Record{r, r, r})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), last)
+	require.NoError(t, log.Rollback(m))
+
+	require.Equal(t, uint64(1), log.NextOffset())
+	_, err = log.Read(1)
+	require.Equal(t, ErrOffsetOutOfRange{Offset: 1}, err)
+	off, err := log.Append(r)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+	read, err := log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, r.Value, read.Value)
 }
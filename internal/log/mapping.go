@@ -0,0 +1,38 @@
+package log
+
+import (
+	"io"
+	"syscall"
+)
+
+// mapping is a read-only memory map of a sealed store.
+//
+// The records read from the map alias it: they are copied before the segment
+// is unpinned.
+type mapping struct {
+	data []byte
+}
+
+func newMapping(fd int, size int) (*mapping, error) {
+	data, err := syscall.Mmap(fd, 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mapping{data: data}, nil
+}
+
+// unmap unmaps the store.
+func (m *mapping) unmap() {
+	_ = syscall.Munmap(m.data)
+}
+
+// frame returns the record of the frame at the given position.
+//
+// The record aliases the map unless it is compressed.
+func (m *mapping) frame(pos uint64) ([]byte, error) {
+	if pos >= uint64(len(m.data)) {
+		return nil, io.EOF
+	}
+	p, _, err := parseFrame(m.data[pos:])
+	return p, err
+}
@@ -0,0 +1,110 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MemoryLog is a CommitLog keeping its records in memory.
+type MemoryLog struct {
+	mu sync.RWMutex
+	// records are the records from the offset base.
+	records []*logv1.Record
+	base    uint64
+	closed  bool
+}
+
+func NewMemoryLog(c Config) *MemoryLog {
+	return &MemoryLog{base: c.Segment.InitialOffset}
+}
+
+// Append appends the record to the log and returns its offset.
+//
+// The append time of the record is set if missing.
+func (l *MemoryLog) Append(record *logv1.Record) (uint64, error) {
+	if record.AppendTime == nil {
+		record.AppendTime = timestamppb.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrLogClosed{}
+	}
+	record.Offset = l.base + uint64(len(l.records))
+	l.records = append(l.records, proto.Clone(record).(*logv1.Record))
+	return record.Offset, nil
+}
+
+func (l *MemoryLog) Read(off uint64) (*logv1.Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return nil, ErrLogClosed{}
+	}
+	if off < l.base || off >= l.base+uint64(len(l.records)) {
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	return proto.Clone(l.records[off-l.base]).(*logv1.Record), nil
+}
+
+// OffsetForTime returns the offset of the first record appended at or after
+// t, or the next offset if there is none.
+func (l *MemoryLog) OffsetForTime(t time.Time) (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return 0, ErrLogClosed{}
+	}
+	for _, record := range l.records {
+		if record.AppendTime != nil && !record.AppendTime.AsTime().Before(t) {
+			return record.Offset, nil
+		}
+	}
+	return l.base + uint64(len(l.records)), nil
+}
+
+func (l *MemoryLog) LowestOffset() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.base, nil
+}
+
+func (l *MemoryLog) HighestOffset() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	off := l.base + uint64(len(l.records))
+	if off == 0 {
+		return 0, nil
+	}
+	return off - 1, nil
+}
+
+// Truncate removes the records whose offset is lower than or equal to lowest.
+func (l *MemoryLog) Truncate(lowest uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrLogClosed{}
+	}
+	if lowest < l.base {
+		return nil
+	}
+	n := min(lowest-l.base+1, uint64(len(l.records)))
+	l.records = l.records[n:]
+	l.base += n
+	return nil
+}
+
+// Close releases the records. The log returns ErrLogClosed afterwards.
+func (l *MemoryLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base += uint64(len(l.records))
+	l.records = nil
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var meter = otel.Meter("distributed-systems/internal/log")
+
+var (
+	retentionReclaimedBytes, _ = meter.Int64Counter(
+		"log.retention.reclaimed",
+		metric.WithDescription("Bytes reclaimed by the retention policy."),
+		metric.WithUnit("By"),
+	)
+	retentionRemovedSegments, _ = meter.Int64Counter(
+		"log.retention.removed_segments",
+		metric.WithDescription("Segments removed by the retention policy."),
+		metric.WithUnit("{segment}"),
+	)
+	compactionRemovedRecords, _ = meter.Int64Counter(
+		"log.compaction.removed_records",
+		metric.WithDescription("Records removed by the log compaction."),
+		metric.WithUnit("{record}"),
+	)
+	compactionReclaimedBytes, _ = meter.Int64Counter(
+		"log.compaction.reclaimed",
+		metric.WithDescription("Bytes reclaimed by the log compaction."),
+		metric.WithUnit("By"),
+	)
+	tieringOffloadedSegments, _ = meter.Int64Counter(
+		"log.tiering.offloaded_segments",
+		metric.WithDescription("Segments offloaded to the archive."),
+		metric.WithUnit("{segment}"),
+	)
+	tieringOffloadedBytes, _ = meter.Int64Counter(
+		"log.tiering.offloaded",
+		metric.WithDescription("Bytes offloaded to the archive."),
+		metric.WithUnit("By"),
+	)
+	tieringFetchedSegments, _ = meter.Int64Counter(
+		"log.tiering.fetched_segments",
+		metric.WithDescription("Segments fetched from the archive."),
+		metric.WithUnit("{segment}"),
+	)
+	segmentSyncs, _ = meter.Int64Counter(
+		"log.segment.syncs",
+		metric.WithDescription("Syncs of segments to stable storage."),
+		metric.WithUnit("{sync}"),
+	)
+	segmentCompressionRatio, _ = meter.Float64Histogram(
+		"log.segment.compression_ratio",
+		metric.WithDescription("Compression ratio of the sealed segments."),
+		metric.WithUnit("1"),
+	)
+	openLogs, _ = meter.Int64UpDownCounter(
+		"log.open",
+		metric.WithDescription("Open logs, by sync policy."),
+		metric.WithUnit("{log}"),
+	)
+)
@@ -0,0 +1,338 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"distributed-systems/internal/raftpebble"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// Prefixes of the keys of the pebble log.
+	prefixRecord = []byte{'r'}
+	prefixTime   = []byte{'t'}
+	// keyLowest holds the lowest offset once truncated, so that the offsets
+	// are not reused after the log is emptied.
+	keyLowest = []byte("m/lowest")
+)
+
+// PebbleLog is a CommitLog storing its records in a pebble db.
+//
+// The records are stored under their offset. Like the time index of the
+// segments, the offsets are also stored under their append time when it is
+// greater than the last one.
+//
+// The sync policy applies to the write-ahead log of the db: the writes are
+// synced as the appends of the active segment would be.
+type PebbleLog struct {
+	db     *pebble.DB
+	policy SyncPolicy
+
+	mu sync.RWMutex
+	// lowest is the offset of the first record, and next the offset of the
+	// next appended one.
+	lowest, next uint64
+	// lastTime is the last indexed append time.
+	lastTime int64
+	// unsynced is the number of records appended since the last synced
+	// write.
+	unsynced uint64
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewPebbleLog(dir string, c Config) (*PebbleLog, error) {
+	opts := []raftpebble.Option{
+		raftpebble.WithDbDirPath(dir),
+		raftpebble.WithLogger(pebble.DefaultLogger),
+	}
+	if !c.Pebble.IsEmpty() {
+		opts = append(opts, raftpebble.WithConfig(c.Pebble))
+	}
+	db, err := raftpebble.Open(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("open pebble: %w", err)
+	}
+	l := &PebbleLog{
+		db:     db,
+		policy: c.Segment.SyncPolicy,
+		lowest: c.Segment.InitialOffset,
+		next:   c.Segment.InitialOffset,
+	}
+	if err := l.setup(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if l.policy.Mode == SyncEveryInterval && l.policy.Interval > 0 {
+		l.startSync()
+	}
+	return l, nil
+}
+
+// startSync starts the loop syncing the write-ahead log every interval, for
+// SyncEveryInterval.
+func (l *PebbleLog) startSync() {
+	l.done = make(chan struct{})
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+				l.mu.Lock()
+				err := l.db.LogData(nil, pebble.Sync)
+				l.unsynced = 0
+				l.mu.Unlock()
+				if err != nil {
+					slog.Error("sync failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// syncWrite returns whether the write of n records is synced, as required by
+// the sync policy. l.mu must be held.
+func (l *PebbleLog) syncWrite(n int) bool {
+	l.unsynced += uint64(n)
+	p := l.policy
+	if p.Mode == SyncAlways || p.Mode == SyncEveryRecords && l.unsynced >= p.Records {
+		l.unsynced = 0
+		return true
+	}
+	return false
+}
+
+// setup reads the bounds of the log from the db.
+func (l *PebbleLog) setup() error {
+	p, closer, err := l.db.Get(keyLowest)
+	switch {
+	case err == nil:
+		l.lowest = Encoding.Uint64(p)
+		l.next = l.lowest
+		_ = closer.Close()
+	case !errors.Is(err, pebble.ErrNotFound):
+		return err
+	}
+	iter, err := l.db.NewIter(prefixBounds(prefixRecord))
+	if err != nil {
+		return err
+	}
+	if iter.First() {
+		l.lowest = Encoding.Uint64(iter.Key()[len(prefixRecord):])
+	}
+	if iter.Last() {
+		l.next = Encoding.Uint64(iter.Key()[len(prefixRecord):]) + 1
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	iter, err = l.db.NewIter(prefixBounds(prefixTime))
+	if err != nil {
+		return err
+	}
+	if iter.Last() {
+		l.lastTime = int64(Encoding.Uint64(iter.Key()[len(prefixTime):]))
+	}
+	return iter.Close()
+}
+
+// Append appends the record to the log and returns its offset.
+//
+// The append time of the record is set if missing.
+func (l *PebbleLog) Append(record *logv1.Record) (uint64, error) {
+	if record.AppendTime == nil {
+		record.AppendTime = timestamppb.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrLogClosed{}
+	}
+	record.Offset = l.next
+	p, err := proto.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	b := l.db.NewBatch()
+	defer b.Close()
+	if err := b.Set(pebbleKey(prefixRecord, record.Offset), p, nil); err != nil {
+		return 0, err
+	}
+	ts := record.AppendTime.AsTime().UnixNano()
+	if ts > l.lastTime {
+		off := Encoding.AppendUint64(nil, record.Offset)
+		if err := b.Set(timeKey(ts), off, nil); err != nil {
+			return 0, err
+		}
+	}
+	if err := b.Commit(&pebble.WriteOptions{Sync: l.syncWrite(1)}); err != nil {
+		return 0, err
+	}
+	l.lastTime = max(l.lastTime, ts)
+	l.next++
+	return record.Offset, nil
+}
+
+func (l *PebbleLog) Read(off uint64) (*logv1.Record, error) {
+	// The lock is held while reading so that the db is not closed meanwhile.
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return nil, ErrLogClosed{}
+	}
+	if off < l.lowest || off >= l.next {
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	p, closer, err := l.db.Get(pebbleKey(prefixRecord, off))
+	if errors.Is(err, pebble.ErrNotFound) {
+		// Truncated in the meantime.
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var record logv1.Record
+	if err := proto.Unmarshal(p, &record); err != nil {
+		return nil, ErrCorruptRecord{Offset: off}
+	}
+	return &record, nil
+}
+
+// OffsetForTime returns the offset of the first record appended at or after
+// t, or the next offset if there is none.
+func (l *PebbleLog) OffsetForTime(t time.Time) (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return 0, ErrLogClosed{}
+	}
+	iter, err := l.db.NewIter(prefixBounds(prefixTime))
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+	if !iter.SeekGE(timeKey(t.UnixNano())) {
+		return l.next, iter.Error()
+	}
+	// The time of the first records kept may be the time of truncated ones.
+	return max(Encoding.Uint64(iter.Value()), l.lowest), nil
+}
+
+func (l *PebbleLog) LowestOffset() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lowest, nil
+}
+
+func (l *PebbleLog) HighestOffset() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.next == 0 {
+		return 0, nil
+	}
+	return l.next - 1, nil
+}
+
+// Truncate removes the records whose offset is lower than or equal to lowest.
+//
+// The times of the removed records are removed too, but for the time of the
+// first records kept.
+func (l *PebbleLog) Truncate(lowest uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrLogClosed{}
+	}
+	if lowest < l.lowest {
+		return nil
+	}
+	end := min(lowest+1, l.next)
+	b := l.db.NewBatch()
+	defer b.Close()
+	err := b.DeleteRange(
+		pebbleKey(prefixRecord, l.lowest),
+		pebbleKey(prefixRecord, end),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	// The last time under end is the time of the records from its offset up
+	// to the offset of the next time, which may be kept.
+	iter, err := l.db.NewIter(prefixBounds(prefixTime))
+	if err != nil {
+		return err
+	}
+	var last []byte
+	for iter.First(); iter.Valid() && Encoding.Uint64(iter.Value()) <= end; iter.Next() {
+		last = slices.Clone(iter.Key())
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if last != nil {
+		if err := b.DeleteRange(timeKey(0), last, nil); err != nil {
+			return err
+		}
+	}
+	if err := b.Set(keyLowest, Encoding.AppendUint64(nil, end), nil); err != nil {
+		return err
+	}
+	if err := b.Commit(&pebble.WriteOptions{Sync: l.policy.Mode != SyncNever}); err != nil {
+		return err
+	}
+	l.lowest = end
+	return nil
+}
+
+// Close closes the db. It does nothing if the log is already closed.
+func (l *PebbleLog) Close() error {
+	if l.done != nil {
+		close(l.done)
+		l.wg.Wait()
+		l.done = nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.db.Close()
+}
+
+// pebbleKey returns the key of n under the prefix. The keys are big endian so
+// that they are sorted like n.
+func pebbleKey(prefix []byte, n uint64) []byte {
+	return Encoding.AppendUint64(append([]byte{}, prefix...), n)
+}
+
+// timeKey returns the key of the append time in Unix nanoseconds. The times
+// before 1970 are clamped to 0 so that they are sorted first.
+func timeKey(ts int64) []byte {
+	return pebbleKey(prefixTime, uint64(max(ts, 0)))
+}
+
+// prefixBounds returns the options of an iterator over the keys of the
+// prefix.
+func prefixBounds(prefix []byte) *pebble.IterOptions {
+	upper := append([]byte{}, prefix...)
+	upper[len(upper)-1]++
+	return &pebble.IterOptions{LowerBound: prefix, UpperBound: upper}
+}
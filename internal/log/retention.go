@@ -0,0 +1,193 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+)
+
+// startOffsetFile is the file, relative to the log directory, persisting the
+// lowest offset retained by Retain.
+const startOffsetFile = "start.offset"
+
+// RetentionOffset returns the offset up to which the sealed segments, local
+// or offloaded, are past the retention limits.
+//
+// It returns false if no segment should be deleted. The active segment is
+// never considered.
+func (l *Log) RetentionOffset(now time.Time) (uint64, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	r := l.Config.Retention
+
+	// The sealed segments, from the oldest one.
+	type sealed struct {
+		nextOffset, size uint64
+		modTime          time.Time
+	}
+	var (
+		segments []sealed
+		total    uint64
+	)
+	for i, s := range l.archived {
+		segments = append(segments, sealed{
+			nextOffset: l.archivedNextOffset(i),
+			size:       s.Size,
+			modTime:    s.ModTime,
+		})
+		total += s.Size
+	}
+	for _, s := range l.segments {
+		total += s.size()
+		if s == l.activeSegment {
+			continue
+		}
+		var modTime time.Time
+		if fi, err := os.Stat(s.store.Name()); err == nil {
+			modTime = fi.ModTime()
+		}
+		segments = append(segments, sealed{
+			nextOffset: s.nextOffset,
+			size:       s.size(),
+			modTime:    modTime,
+		})
+	}
+
+	lowest := l.lowestOffset()
+	records := l.activeSegment.nextOffset - lowest
+	last := -1
+	for i, s := range segments {
+		if records-(s.nextOffset-lowest) < r.MinRecords {
+			break
+		}
+		oversized := r.MaxBytes > 0 && total > r.MaxBytes
+		expired := r.MaxAge > 0 && !s.modTime.IsZero() && now.Sub(s.modTime) > r.MaxAge
+		if !oversized && !expired {
+			break
+		}
+		total -= s.size
+		last = i
+	}
+	if last < 0 {
+		return 0, false
+	}
+	return segments[last].nextOffset - 1, true
+}
+
+// Retain removes the records whose offset is lower than or equal to lowest,
+// and reports what was reclaimed.
+//
+// The sealed segments, local or offloaded, entirely below lowest are deleted.
+// The records of the segment containing lowest are kept on disk but are no
+// longer readable, so that the logs of every replica retain the same records
+// whatever their segment boundaries. Unlike Truncate, the active segment is
+// never removed.
+func (l *Log) Retain(lowest uint64) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var (
+		removed   int64
+		reclaimed uint64
+	)
+	defer func() {
+		if removed == 0 {
+			return
+		}
+		retentionRemovedSegments.Add(context.Background(), removed)
+		retentionReclaimedBytes.Add(context.Background(), int64(reclaimed))
+		slog.Info(
+			"retention removed segments",
+			"dir",
+			l.Dir,
+			"segments",
+			removed,
+			"bytes",
+			reclaimed,
+		)
+	}()
+	if start := min(lowest+1, l.activeSegment.nextOffset); start > l.startOffset {
+		if err := l.writeStartOffset(start); err != nil {
+			return err
+		}
+	}
+	var err error
+	removed, reclaimed, err = l.removeArchived(lowest)
+	if err != nil {
+		return err
+	}
+	for len(l.segments) > 1 && l.segments[0].nextOffset <= lowest+1 {
+		s := l.segments[0]
+		size := s.size()
+		if err := l.removeSegment(s); err != nil {
+			return err
+		}
+		l.segments = l.segments[1:]
+		removed++
+		reclaimed += size
+	}
+	return nil
+}
+
+// loadStartOffset reads the lowest offset retained by Retain, if any.
+//
+// l.mu must be held.
+func (l *Log) loadStartOffset() error {
+	l.startOffset = 0
+	b, err := os.ReadFile(path.Join(l.Dir, startOffsetFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case uint64(len(b)) != offWidth:
+		return fmt.Errorf("invalid %s: %d bytes", startOffsetFile, len(b))
+	}
+	l.startOffset = Encoding.Uint64(b)
+	return nil
+}
+
+// writeStartOffset persists the lowest offset retained by Retain, before
+// the records below it become unreadable.
+//
+// l.mu must be held.
+func (l *Log) writeStartOffset(off uint64) error {
+	name := path.Join(l.Dir, startOffsetFile)
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(Encoding.AppendUint64(nil, off)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	l.startOffset = off
+	return nil
+}
+
+// retain applies the retention policy.
+func (l *Log) retain(now time.Time) {
+	off, ok := l.RetentionOffset(now)
+	if !ok {
+		return
+	}
+	if err := l.Retain(off); err != nil {
+		slog.Error("retention failed", "dir", l.Dir, "error", err)
+	}
+}
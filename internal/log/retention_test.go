@@ -0,0 +1,145 @@
+package log
+
+import (
+	logv1 "distributed-systems/gen/log/v1"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"max bytes":               testRetentionMaxBytes,
+		"max age":                 testRetentionMaxAge,
+		"min records":             testRetentionMinRecords,
+		"active segment is kept":  testRetentionActiveSegment,
+		"background loop retains": testRetentionLoop,
+		"retained prefix":         testRetentionPrefix,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "retention-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// Each segment holds 2 records.
+			c := Config{}
+			c.Segment.MaxIndexBytes = entryWidth * 2
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			r := &logv1.Record{
+				Value: []byte("hello world"),
+			}
+			for i := 0; i < 6; i++ {
+				_, err := log.Append(r)
+				require.NoError(t, err)
+			}
+			// 3 sealed segments and 1 empty active segment.
+			require.Len(t, log.segments, 4)
+
+			fn(t, log)
+		})
+	}
+}
+
+func testRetentionMaxBytes(t *testing.T, log *Log) {
+	log.Config.Retention.MaxBytes = log.segments[1].size() + log.segments[2].size()
+
+	off, ok := log.RetentionOffset(time.Now())
+	require.True(t, ok)
+	require.Equal(t, uint64(1), off)
+
+	require.NoError(t, log.Retain(off))
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lowest)
+}
+
+func testRetentionMaxAge(t *testing.T, log *Log) {
+	log.Config.Retention.MaxAge = time.Hour
+
+	_, ok := log.RetentionOffset(time.Now())
+	require.False(t, ok)
+
+	off, ok := log.RetentionOffset(time.Now().Add(2 * time.Hour))
+	require.True(t, ok)
+	require.Equal(t, uint64(5), off)
+}
+
+func testRetentionMinRecords(t *testing.T, log *Log) {
+	log.Config.Retention.MaxAge = time.Hour
+	log.Config.Retention.MinRecords = 3
+
+	off, ok := log.RetentionOffset(time.Now().Add(2 * time.Hour))
+	require.True(t, ok)
+	require.Equal(t, uint64(1), off)
+}
+
+func testRetentionActiveSegment(t *testing.T, log *Log) {
+	require.NoError(t, log.Retain(100))
+
+	require.Len(t, log.segments, 1)
+	require.Equal(t, log.activeSegment, log.segments[0])
+	off, err := log.Append(&logv1.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+}
+
+func testRetentionLoop(t *testing.T, log *Log) {
+	require.NoError(t, log.Close())
+	c := log.Config
+	c.Retention.MaxBytes = 1
+	c.Retention.CheckInterval = 10 * time.Millisecond
+	n, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer n.Close()
+
+	require.Eventually(t, func() bool {
+		lowest, err := n.LowestOffset()
+		return err == nil && lowest == 6
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testRetentionPrefix(t *testing.T, log *Log) {
+	// Another replica of the log, with other segment boundaries.
+	c := Config{}
+	c.Segment.MaxIndexBytes = entryWidth * 3
+	other, err := NewLog(t.TempDir(), c)
+	require.NoError(t, err)
+	defer other.Close()
+	for i := 0; i < 6; i++ {
+		_, err := other.Append(&logv1.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	for _, l := range []*Log{log, other} {
+		require.NoError(t, l.Retain(2))
+		lowest, err := l.LowestOffset()
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), lowest)
+		_, err = l.Read(2)
+		require.Equal(t, ErrOffsetOutOfRange{Offset: 2}, err)
+		read, err := l.Read(3)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), read.Offset)
+		off, err := l.OffsetForTime(time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), off)
+	}
+
+	// The retained prefix survives a restart.
+	require.NoError(t, other.Close())
+	n, err := NewLog(other.Dir, other.Config)
+	require.NoError(t, err)
+	defer n.Close()
+	lowest, err := n.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	_, err = n.Read(2)
+	require.Equal(t, ErrOffsetOutOfRange{Offset: 2}, err)
+}
@@ -1,10 +1,19 @@
 package log
 
 import (
+	"container/list"
 	logv1 "distributed-systems/gen/log/v1"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"os"
 	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -12,85 +21,465 @@ import (
 type segment struct {
 	store                  *store
 	index                  *index
+	timeIndex              *timeIndex
 	baseOffset, nextOffset uint64
 	config                 Config
+	dir                    string
+
+	// mu guards the files of the segment, which are closed while the segment
+	// is cold.
+	mu     sync.RWMutex
+	closed bool
+	// sealed is set once the segment is no longer the active one.
+	sealed atomic.Bool
+	// lru is the element of the segment in the open segments of the log.
+	lru *list.Element
+	// minTime and maxTime are the first and last append times of the time
+	// index, in Unix nanoseconds, known even while the segment is cold.
+	// They are math.MaxInt64 and math.MinInt64 if no time is indexed.
+	minTime, maxTime atomic.Int64
 }
 
 func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	s := segment{
 		baseOffset: baseOffset,
 		config:     c,
+		dir:        dir,
+	}
+	if err := s.open(os.O_CREATE); err != nil {
+		return nil, err
+	}
+	if !s.isIndexConsistent() || !s.isTimeIndexConsistent() {
+		if err := s.recover(); err != nil {
+			return nil, fmt.Errorf("recover: %w", err)
+		}
+	}
+	if off, _, err := s.index.Read(-1); err != nil {
+		s.nextOffset = baseOffset
+	} else {
+		s.nextOffset = baseOffset + uint64(off) + 1
 	}
+	s.loadTimes()
+
+	return &s, nil
+}
+
+// loadTimes loads the first and last append times of the time index.
+func (s *segment) loadTimes() {
+	minTime, maxTime := int64(math.MaxInt64), int64(math.MinInt64)
+	if _, ts, err := s.timeIndex.Read(0); err == nil {
+		minTime = int64(ts)
+	}
+	if _, ts, err := s.timeIndex.Read(-1); err == nil {
+		maxTime = int64(ts)
+	}
+	s.minTime.Store(minTime)
+	s.maxTime.Store(maxTime)
+}
+
+// open opens the files of the segment, with the flag added to their flags:
+// they are created if it is os.O_CREATE.
+func (s *segment) open(flag int) error {
 	storeFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprintf("%d.store", baseOffset)),
-		os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		path.Join(s.dir, fmt.Sprintf("%d.store", s.baseOffset)),
+		flag|os.O_RDWR|os.O_APPEND,
 		0644,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("open store: %w", err)
+		return fmt.Errorf("open store: %w", err)
 	}
 	s.store, err = newStore(storeFile)
 	if err != nil {
-		return nil, fmt.Errorf("new store: %w", err)
+		return fmt.Errorf("new store: %w", err)
 	}
+	s.store.codec = s.config.Segment.Compression
 	indexFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprintf("%d.index", baseOffset)),
-		os.O_CREATE|os.O_RDWR,
+		path.Join(s.dir, fmt.Sprintf("%d.index", s.baseOffset)),
+		flag|os.O_RDWR,
 		0644,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("open index: %w", err)
+		return fmt.Errorf("open index: %w", err)
 	}
-	s.index, err = newIndex(indexFile, c)
+	s.index, err = newIndex(indexFile, s.config)
 	if err != nil {
-		return nil, fmt.Errorf("new index: %w", err)
+		return fmt.Errorf("new index: %w", err)
 	}
-	if off, _, err := s.index.Read(-1); err != nil {
-		s.nextOffset = baseOffset
-	} else {
-		s.nextOffset = baseOffset + uint64(off) + 1
+	timeIndexFile, err := os.OpenFile(
+		path.Join(s.dir, fmt.Sprintf("%d.timeindex", s.baseOffset)),
+		flag|os.O_RDWR,
+		0644,
+	)
+	if err != nil {
+		return fmt.Errorf("open time index: %w", err)
+	}
+	s.timeIndex, err = newTimeIndex(timeIndexFile, s.config)
+	if err != nil {
+		return fmt.Errorf("new time index: %w", err)
 	}
+	s.closed = false
+	if s.sealed.Load() {
+		return s.store.seal()
+	}
+	return nil
+}
 
-	return &s, nil
+// seal marks the segment as sealed: its store is mapped in memory and it must
+// not be appended to anymore.
+func (s *segment) seal() error {
+	s.sealed.Store(true)
+	return s.store.seal()
+}
+
+// reopen opens the files of a segment closed while cold.
+//
+// The files are not created again if the segment was removed meanwhile.
+func (s *segment) reopen() error {
+	if !s.closed {
+		return nil
+	}
+	return s.open(0)
 }
 
 func (s *segment) Append(record *logv1.Record) (uint64, error) {
-	cur := s.nextOffset
-	record.Offset = cur
+	record.Offset = s.nextOffset
+	if err := s.write(record); err != nil {
+		return 0, err
+	}
+	return record.Offset, nil
+}
+
+// write writes the record at its own offset, which must not be lower than the
+// next offset of the segment.
+func (s *segment) write(record *logv1.Record) error {
 	p, err := proto.Marshal(record)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	_, pos, err := s.store.Append(p)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if err = s.index.Write(uint32(s.nextOffset-uint64(s.baseOffset)), pos); err != nil {
-		return 0, err
+	off := record.Offset - s.baseOffset
+	if err = s.index.Write(off, pos); err != nil {
+		return err
+	}
+	if record.AppendTime != nil {
+		ts := record.AppendTime.AsTime().UnixNano()
+		if err = s.timeIndex.Append(off, ts); err != nil {
+			return err
+		}
+		s.minTime.CompareAndSwap(math.MaxInt64, ts)
+		if ts > s.maxTime.Load() {
+			s.maxTime.Store(ts)
+		}
 	}
-	s.nextOffset++
-	return cur, nil
+	s.nextOffset = record.Offset + 1
+	return nil
+}
+
+// segmentMark is the state of a segment before a batch of records, used to
+// roll the batch back.
+type segmentMark struct {
+	storeSize, indexSize, timeIndexSize, nextOffset uint64
+}
+
+func (s *segment) mark() segmentMark {
+	return segmentMark{
+		storeSize:     s.store.size,
+		indexSize:     s.index.size,
+		timeIndexSize: s.timeIndex.size,
+		nextOffset:    s.nextOffset,
+	}
+}
+
+// rollback discards the records written since the mark.
+func (s *segment) rollback(m segmentMark) error {
+	if err := s.store.Truncate(m.storeSize); err != nil {
+		return err
+	}
+	s.index.Truncate(m.indexSize / entryWidth)
+	s.timeIndex.Truncate(m.timeIndexSize / entryWidth)
+	s.nextOffset = m.nextOffset
+	s.loadTimes()
+	return nil
+}
+
+// Sync commits the segment to stable storage.
+func (s *segment) Sync() error {
+	if err := s.store.Sync(); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+	return s.timeIndex.Sync()
 }
 
 func (s *segment) Read(off uint64) (*logv1.Record, error) {
-	_, pos, err := s.index.Read(int64(off - s.baseOffset))
+	pos, err := s.position(off)
 	if err != nil {
 		return nil, err
 	}
 	p, err := s.store.Read(pos)
 	if err != nil {
-		return nil, err
+		return nil, s.readError(off, err)
 	}
 	var record logv1.Record
 	if err = proto.Unmarshal(p, &record); err != nil {
-		return nil, err
+		return nil, ErrCorruptRecord{Offset: off, Segment: s.baseOffset}
 	}
 	return &record, nil
 }
 
+// ReadEncoded returns a copy of the encoded record at off.
+func (s *segment) ReadEncoded(off uint64) ([]byte, error) {
+	pos, err := s.position(off)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.store.Read(pos)
+	if err != nil {
+		return nil, s.readError(off, err)
+	}
+	// The record of a sealed segment aliases its memory map.
+	return slices.Clone(p), nil
+}
+
+// position returns the position in the store of the record at off.
+func (s *segment) position(off uint64) (uint64, error) {
+	out, pos, err := s.index.Search(off - s.baseOffset)
+	if err != nil {
+		return 0, err
+	}
+	if next := s.baseOffset + uint64(out); next != off {
+		return 0, ErrOffsetCompacted{Offset: off, Next: next}
+	}
+	return pos, nil
+}
+
+// readError converts an error of the store reading the record at off.
+func (s *segment) readError(off uint64, err error) error {
+	if errors.Is(err, errChecksum) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrCorruptRecord{Offset: off, Segment: s.baseOffset}
+	}
+	return err
+}
+
+// each calls fn for every record of the segment, in order.
+func (s *segment) each(fn func(record *logv1.Record) error) error {
+	for k := int64(0); uint64(k) < s.index.size/entryWidth; k++ {
+		off, pos, err := s.index.Read(k)
+		if err != nil {
+			return err
+		}
+		record, _, err := s.readAt(pos)
+		if err != nil {
+			return ErrCorruptRecord{Offset: s.baseOffset + uint64(off), Segment: s.baseOffset}
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAt reads and decodes the record at the given position of the store,
+// and returns the size of its frame.
+func (s *segment) readAt(pos uint64) (*logv1.Record, uint64, error) {
+	p, n, err := s.frameAt(pos)
+	if err != nil {
+		return nil, 0, err
+	}
+	var record logv1.Record
+	if err := proto.Unmarshal(p, &record); err != nil {
+		return nil, 0, err
+	}
+	return &record, n, nil
+}
+
+// frameAt reads the encoded record at the given position of the store, and
+// returns the size of its frame. The record of a sealed segment aliases its
+// memory map.
+func (s *segment) frameAt(pos uint64) ([]byte, uint64, error) {
+	if pos >= s.store.size {
+		return nil, 0, io.EOF
+	}
+	var p []byte
+	var n uint64
+	var err error
+	if m := s.store.mapping.Load(); m != nil {
+		p, n, err = parseFrame(m.data[pos:])
+	} else {
+		r := io.NewSectionReader(s.store, int64(pos), int64(s.store.size-pos))
+		p, err = ReadFrame(r)
+		off, _ := r.Seek(0, io.SeekCurrent)
+		n = uint64(off)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return p, n, nil
+}
+
+// scan walks the store and returns the offsets and positions of the
+// consecutive valid records, and the position right after the last valid
+// record.
+//
+// A record is valid if its frame is complete, passes its checksum and holds
+// an offset greater than the previous one.
+func (s *segment) scan() (offsets, positions []uint64, end uint64) {
+	next := s.baseOffset
+	for end < s.store.size {
+		record, n, err := s.readAt(end)
+		if err != nil || record.Offset < next {
+			break
+		}
+		offsets = append(offsets, record.Offset)
+		positions = append(positions, end)
+		next = record.Offset + 1
+		end += n
+	}
+	return offsets, positions, end
+}
+
+// isIndexConsistent checks that the last entry of the index points to the
+// last record of the store.
+//
+// This is a cheap check which detects missing, short and most of the
+// mismatched indexes without scanning the store.
+func (s *segment) isIndexConsistent() bool {
+	if s.index.size%entryWidth != 0 {
+		return false
+	}
+	off, pos, err := s.index.Read(-1)
+	if err != nil {
+		return s.store.size == 0
+	}
+	record, n, err := s.readAt(pos)
+	if err != nil {
+		return false
+	}
+	return record.Offset == s.baseOffset+uint64(off) && pos+n == s.store.size
+}
+
+// isTimeIndexConsistent checks that the last entry of the time index matches
+// its record.
+func (s *segment) isTimeIndexConsistent() bool {
+	if s.timeIndex.size%entryWidth != 0 {
+		return false
+	}
+	off, ts, err := s.timeIndex.Read(-1)
+	if err != nil {
+		// Records without append time are not indexed.
+		if s.index.size == 0 {
+			return true
+		}
+		_, pos, err := s.index.Read(0)
+		if err != nil {
+			return false
+		}
+		record, _, err := s.readAt(pos)
+		return err == nil && record.AppendTime == nil
+	}
+	record, err := s.Read(s.baseOffset + uint64(off))
+	return err == nil && record.AppendTime != nil &&
+		record.AppendTime.AsTime().UnixNano() == int64(ts)
+}
+
+// recover truncates the store to the last complete and valid record,
+// discarding the torn writes left by a crash, and rebuilds the indexes from
+// the store if they disagree.
+func (s *segment) recover() error {
+	if err := s.recoverIndex(); err != nil {
+		return err
+	}
+	if s.isTimeIndexConsistent() {
+		return nil
+	}
+	slog.Warn("rebuilding time index", "segment", s.baseOffset)
+	s.timeIndex.Truncate(0)
+	err := s.each(func(record *logv1.Record) error {
+		if record.AppendTime == nil {
+			return nil
+		}
+		return s.timeIndex.Append(
+			record.Offset-s.baseOffset,
+			record.AppendTime.AsTime().UnixNano(),
+		)
+	})
+	s.loadTimes()
+	return err
+}
+
+// recoverIndex truncates the store to the last complete and valid record and
+// rebuilds the index from the store if they disagree.
+func (s *segment) recoverIndex() error {
+	offsets, positions, end := s.scan()
+	if end < s.store.size {
+		slog.Warn(
+			"discarding torn writes",
+			"segment",
+			s.baseOffset,
+			"store_bytes",
+			s.store.size-end,
+		)
+		if err := s.store.Truncate(end); err != nil {
+			return fmt.Errorf("truncate store: %w", err)
+		}
+	}
+	s.nextOffset = s.baseOffset
+	if len(offsets) > 0 {
+		s.nextOffset = offsets[len(offsets)-1] + 1
+	}
+	var n int
+	for ; n < len(positions); n++ {
+		off, pos, err := s.index.Read(int64(n))
+		if err != nil || s.baseOffset+uint64(off) != offsets[n] || pos != positions[n] {
+			break
+		}
+	}
+	if n == len(positions) && s.index.size == uint64(n)*entryWidth {
+		return nil
+	}
+	slog.Warn(
+		"rebuilding index",
+		"segment",
+		s.baseOffset,
+		"valid_entries",
+		n,
+		"entries",
+		len(positions),
+	)
+	s.index.Truncate(uint64(n))
+	for ; n < len(positions); n++ {
+		if err := s.index.Write(offsets[n]-s.baseOffset, positions[n]); err != nil {
+			return fmt.Errorf("write index: %w", err)
+		}
+	}
+	return nil
+}
+
+// OffsetForTime returns the offset of the first record appended at or after
+// t.
+//
+// It returns io.EOF if every record was appended before t.
+func (s *segment) OffsetForTime(t time.Time) (uint64, error) {
+	off, err := s.timeIndex.Lookup(t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return s.baseOffset + uint64(off), nil
+}
+
+// size returns the size of the segment on disk.
+func (s *segment) size() uint64 {
+	return s.store.size + s.index.size + s.timeIndex.size
+}
+
 func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes ||
-		s.index.size >= s.config.Segment.MaxIndexBytes
+		s.index.Room() == 0
 }
 
 func (s *segment) Remove() error {
@@ -100,13 +489,25 @@ func (s *segment) Remove() error {
 	if err := os.Remove(s.index.Name()); err != nil {
 		return err
 	}
+	if err := os.Remove(s.timeIndex.Name()); err != nil {
+		return err
+	}
 	return os.Remove(s.store.Name())
 }
 
+// Close closes the files of the segment. It does nothing if the segment is
+// already closed.
 func (s *segment) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
 	if err := s.index.Close(); err != nil {
 		return err
 	}
+	if err := s.timeIndex.Close(); err != nil {
+		return err
+	}
 	return s.store.Close()
 }
 
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// snapshotDir is the directory, relative to the log directory, in which the
+// snapshots link or copy the stores of the segments.
+const snapshotDir = ".snapshots"
+
+// Snapshot is a point-in-time copy of the local segments of a log.
+//
+// The sealed stores are hard linked when the snapshot is taken, so that the
+// snapshot is not affected by the segments removed or rewritten by the
+// retention, the compaction or the tiering. The active store is copied, since
+// it is truncated in place by Rollback and Truncate.
+type Snapshot struct {
+	// Low is the lowest offset of the log when the snapshot was taken.
+	Low uint64
+	// High is the next offset of the log when the snapshot was taken.
+	High uint64
+
+	dir   string
+	files []snapshotFile
+	// r reads the current file, which is opened lazily so that a snapshot
+	// does not hold a file descriptor per segment.
+	r *os.File
+	n int64
+}
+
+type snapshotFile struct {
+	name string
+	size int64
+}
+
+var _ io.ReadCloser = (*Snapshot)(nil)
+
+// Snapshot returns a snapshot of the local segments of the log, up to the
+// last appended record. The offloaded segments are not included.
+//
+// Like Reader, the snapshot reads the frames as stored. It must be closed to
+// release the links and the copy.
+func (l *Log) Snapshot() (*Snapshot, error) {
+	root := path.Join(l.Dir, snapshotDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(root, "snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{dir: dir}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// The buffered records of the active segment must reach the linked file.
+	if err := l.activeSegment.store.Flush(); err != nil {
+		_ = snapshot.Close()
+		return nil, err
+	}
+	snapshot.Low, snapshot.High = l.lowestOffset(), l.activeSegment.nextOffset
+	for _, s := range l.segments {
+		if s.store.size == 0 {
+			continue
+		}
+		name := path.Join(dir, filepath.Base(s.store.Name()))
+		if s == l.activeSegment {
+			err = copyStore(s.store, name)
+		} else {
+			err = os.Link(s.store.Name(), name)
+		}
+		if err != nil {
+			_ = snapshot.Close()
+			return nil, err
+		}
+		snapshot.files = append(snapshot.files, snapshotFile{
+			name: name,
+			size: int64(s.store.size),
+		})
+	}
+	return snapshot, nil
+}
+
+// copyStore copies the frames of the store to a new file.
+func copyStore(s *store, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.NewSectionReader(s, 0, int64(s.size)))
+	return errors.Join(err, f.Close())
+}
+
+// Size returns the size of the frames of the snapshot, before it is read.
+func (s *Snapshot) Size() uint64 {
+	var size int64
+	for _, f := range s.files {
+		size += f.size
+	}
+	return uint64(size)
+}
+
+// Read reads the frames of the snapshot, segment after segment.
+func (s *Snapshot) Read(p []byte) (int, error) {
+	for len(s.files) > 0 {
+		f := s.files[0]
+		if s.r == nil {
+			r, err := os.Open(f.name)
+			if err != nil {
+				return 0, err
+			}
+			s.r, s.n = r, 0
+		}
+		if s.n < f.size {
+			if int64(len(p)) > f.size-s.n {
+				p = p[:f.size-s.n]
+			}
+			n, err := s.r.ReadAt(p, s.n)
+			s.n += int64(n)
+			if err == io.EOF {
+				err = nil
+				if s.n < f.size {
+					err = io.ErrUnexpectedEOF
+				}
+			}
+			return n, err
+		}
+		// The records appended to the active store afterwards are ignored.
+		if err := s.r.Close(); err != nil {
+			return 0, err
+		}
+		s.r = nil
+		s.files = s.files[1:]
+	}
+	return 0, io.EOF
+}
+
+// Close releases the snapshot and removes its links.
+func (s *Snapshot) Close() error {
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	s.files = nil
+	if err := os.RemoveAll(s.dir); err != nil {
+		return err
+	}
+	// The log may have been removed while the snapshot was open.
+	root := filepath.Dir(s.dir)
+	removeEmpty(root, filepath.Dir(root))
+	return nil
+}
+
+// removeEmpty removes the directories in order, until one is not empty.
+func removeEmpty(dirs ...string) {
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"bytes"
+	logv1 "distributed-systems/gen/log/v1"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSnapshot(t *testing.T) {
+	// Arrange: segments of 3 records.
+	dir, err := os.MkdirTemp("", "snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Segment.MaxIndexBytes = entryWidth * 3
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendKeys := func(keys ...string) {
+		for _, key := range keys {
+			_, err := log.Append(&logv1.Record{Key: []byte(key), Value: []byte("value")})
+			require.NoError(t, err)
+		}
+	}
+	appendKeys("a", "b", "a", "c", "d")
+
+	// Act
+	snapshot, err := log.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), snapshot.High)
+
+	// The log changes under the snapshot.
+	appendKeys("b", "e")
+	require.NoError(t, log.Compact(time.Now()))
+	require.NoError(t, log.Truncate(2))
+
+	// Assert: the snapshot holds exactly the records 0 to 4.
+	size := snapshot.Size()
+	b, err := io.ReadAll(snapshot)
+	require.NoError(t, err)
+	require.Equal(t, size, uint64(len(b)))
+	r := bytes.NewReader(b)
+	for off := uint64(0); off < 5; off++ {
+		p, err := ReadFrame(r)
+		require.NoError(t, err)
+		record := &logv1.Record{}
+		require.NoError(t, proto.Unmarshal(p, record))
+		require.Equal(t, off, record.Offset)
+	}
+	_, err = ReadFrame(r)
+	require.Equal(t, io.EOF, err)
+
+	// The links are removed once the snapshot is closed.
+	entries, err := os.ReadDir(path.Join(dir, snapshotDir))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NoError(t, snapshot.Close())
+	_, err = os.Stat(path.Join(dir, snapshotDir))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSnapshotRollback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	defer log.Close()
+	m := log.Mark()
+	_, err = log.Append(&logv1.Record{Value: []byte("first")})
+	require.NoError(t, err)
+
+	// The active store is rewritten in place under the snapshot.
+	snapshot, err := log.Snapshot()
+	require.NoError(t, err)
+	defer snapshot.Close()
+	require.NoError(t, log.Rollback(m))
+	_, err = log.Append(&logv1.Record{Value: []byte("other")})
+	require.NoError(t, err)
+
+	p, err := ReadFrame(snapshot)
+	require.NoError(t, err)
+	record := &logv1.Record{}
+	require.NoError(t, proto.Unmarshal(p, record))
+	require.Equal(t, "first", string(record.Value))
+}
+
+func TestSnapshotRemovedLog(t *testing.T) {
+	dir, err := os.MkdirTemp("", "snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	_, err = log.Append(&logv1.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	// The snapshot is still readable once the log is removed.
+	snapshot, err := log.Snapshot()
+	require.NoError(t, err)
+	require.NoError(t, log.Remove())
+	p, err := ReadFrame(snapshot)
+	require.NoError(t, err)
+	record := &logv1.Record{}
+	require.NoError(t, proto.Unmarshal(p, record))
+	require.Equal(t, "hello world", string(record.Value))
+
+	// The directory of the log is removed with the snapshot.
+	require.NoError(t, snapshot.Close())
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
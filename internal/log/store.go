@@ -3,17 +3,50 @@ package log
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 var (
 	Encoding = binary.BigEndian
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errChecksum = errors.New("checksum mismatch")
 )
 
 const (
+	// LenWidth is the width of the frame header.
+	//
+	// The first byte of the header is the frame version, the 7 remaining
+	// bytes are the length of the record.
 	LenWidth = 8
+	// CRCWidth is the width of the CRC32C checksum following the header of a
+	// versioned frame.
+	CRCWidth = 4
+
+	// frameV0 is the legacy frame: an 8 bytes length followed by the record.
+	//
+	// Since records are never bigger than 2^56 bytes, the first byte of a
+	// legacy frame is always 0.
+	frameV0 byte = 0
+	// frameV1 is a frame with a CRC32C checksum of the header and the record.
+	frameV1 byte = 1
+	// frameV2 is a frame with a CRC32C checksum whose record is compressed.
+	//
+	// The second byte of the header is the codec, the 6 remaining bytes are
+	// the length of the compressed record.
+	frameV2 byte = 2
+
+	frameVersion  = frameV1
+	lenMask       = 1<<56 - 1
+	lenMaskV2     = 1<<48 - 1
+	maxFrameAlloc = 1 << 20
 )
 
 type store struct {
@@ -21,6 +54,15 @@ type store struct {
 	mu   sync.Mutex
 	buf  *bufio.Writer
 	size uint64
+
+	// codec is the compression codec of the appended records.
+	codec Codec
+	// rawBytes and storedBytes are the sizes of the records appended since
+	// the store was opened, before and after compression.
+	rawBytes, storedBytes uint64
+
+	// mapping is the read-only memory map of the store once sealed.
+	mapping atomic.Pointer[mapping]
 }
 
 func newStore(f *os.File) (*store, error) {
@@ -38,15 +80,35 @@ func newStore(f *os.File) (*store, error) {
 // Append writes the record to the store and returns the position at which the record was written.
 //
 // We manually pack the data.
-// The first 8 bytes will be the length of the record.
+// The first 8 bytes will be the version of the frame and the length of the record.
+// The next 4 bytes will be the checksum of the header and the record.
 // The rest will be the record itself.
+//
+// The record is compressed with the codec of the store, unless the
+// compressed record is not smaller.
 func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	version, codec := frameVersion, CodecNone
+	s.rawBytes += uint64(len(p))
+	if s.codec != CodecNone {
+		c, err := compress(s.codec, p)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(c) < len(p) {
+			p, version, codec = c, frameV2, s.codec
+		}
+	}
+	s.storedBytes += uint64(len(p))
+
 	pos = s.size
-	// Write the length of the record
-	if err = binary.Write(s.buf, Encoding, uint64(len(p))); err != nil {
+	header := make([]byte, LenWidth+CRCWidth)
+	Encoding.PutUint64(header[:LenWidth], encodeHeader(version, codec, uint64(len(p))))
+	Encoding.PutUint32(header[LenWidth:], checksum(header[:LenWidth], p))
+	// Write the header and the checksum
+	if _, err = s.buf.Write(header); err != nil {
 		return
 	}
 	// Write the record
@@ -54,38 +116,74 @@ func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
 	if err != nil {
 		return
 	}
-	w += LenWidth
+	w += len(header)
 	s.size += uint64(w)
 	return uint64(w), pos, nil
 }
 
+// seal maps the store in memory, so that it is read without locking nor
+// system calls. The store must not be appended to until unsealed.
+func (s *store) seal() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mapping.Load() != nil || s.size == 0 {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	m, err := newMapping(int(s.Fd()), int(s.size))
+	if err != nil {
+		return fmt.Errorf("mmap: %w", err)
+	}
+	s.mapping.Store(m)
+	return nil
+}
+
+// unseal unmaps the store.
+func (s *store) unseal() {
+	if m := s.mapping.Swap(nil); m != nil {
+		m.unmap()
+	}
+}
+
 // Read reads the record at the given position.
 //
-// We manually unpack the data.
-// The first 8 bytes will be the length of the record.
-// The rest will be the record itself.
+// Read returns errChecksum if the checksum does not match the record.
+//
+// The record of a sealed store aliases its map, unless the record is
+// compressed: it must not be used after the store is closed.
 func (s *store) Read(pos uint64) ([]byte, error) {
+	if m := s.mapping.Load(); m != nil {
+		return m.frame(pos)
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if err := s.buf.Flush(); err != nil {
 		return nil, err
 	}
-	size := make([]byte, LenWidth)
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
-		return nil, err
+	if pos >= s.size {
+		return nil, io.EOF
 	}
-	b := make([]byte, Encoding.Uint64(size))
-	if _, err := s.File.ReadAt(b, int64(pos+LenWidth)); err != nil {
-		return nil, err
-	}
-	return b, nil
+	return ReadFrame(io.NewSectionReader(s.File, int64(pos), int64(s.size-pos)))
 }
 
 // ReadAt reads len(p) bytes into p beginning at the byte offset off.
 //
 // This method is implemented to satisfy the io.ReaderAt interface.
 func (s *store) ReadAt(p []byte, off int64) (n int, err error) {
+	if m := s.mapping.Load(); m != nil {
+		if off >= int64(len(m.data)) {
+			return 0, io.EOF
+		}
+		n = copy(p, m.data[off:])
+		if n < len(p) {
+			err = io.EOF
+		}
+		return n, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -95,8 +193,57 @@ func (s *store) ReadAt(p []byte, off int64) (n int, err error) {
 	return s.File.ReadAt(p, off)
 }
 
+// Truncate discards everything after the given position.
+func (s *store) Truncate(size uint64) error {
+	s.unseal()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.File.Truncate(int64(size)); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// CompressionRatio returns the ratio between the size of the records appended
+// since the store was opened and their size once compressed.
+//
+// It returns 1 if no record was appended.
+func (s *store) CompressionRatio() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.storedBytes == 0 {
+		return 1
+	}
+	return float64(s.rawBytes) / float64(s.storedBytes)
+}
+
+// Flush writes the buffered records to the file.
+func (s *store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Flush()
+}
+
+// Sync flushes the buffered records and commits them to stable storage.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.File.Sync()
+}
+
 // Close closes the store.
 func (s *store) Close() error {
+	s.unseal()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -105,3 +252,132 @@ func (s *store) Close() error {
 	}
 	return s.File.Close()
 }
+
+// ReadFrame reads the next frame from r and returns the record it contains.
+//
+// We manually unpack the data.
+// The first 8 bytes will be the version of the frame and the length of the record.
+// If the frame is versioned, the next 4 bytes will be the checksum.
+// The rest will be the record itself, decompressed if needed.
+//
+// ReadFrame returns io.EOF if r is at the end of the stream, and
+// io.ErrUnexpectedEOF if the frame is incomplete.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, LenWidth)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	version, codec, size := decodeHeader(Encoding.Uint64(header))
+	switch version {
+	case frameV0:
+		return readN(r, size)
+	case frameV1, frameV2:
+		b, err := readN(r, CRCWidth+size)
+		if err != nil {
+			return nil, err
+		}
+		if Encoding.Uint32(b[:CRCWidth]) != checksum(header, b[CRCWidth:]) {
+			return nil, errChecksum
+		}
+		return decompress(codec, b[CRCWidth:])
+	default:
+		return nil, fmt.Errorf("unknown frame version %d: %w", version, errChecksum)
+	}
+}
+
+// WriteFrame writes the record to w in a frame read by ReadFrame, and returns
+// the size of the frame.
+func WriteFrame(w io.Writer, p []byte) (int, error) {
+	header := make([]byte, LenWidth+CRCWidth)
+	Encoding.PutUint64(header[:LenWidth], encodeHeader(frameVersion, CodecNone, uint64(len(p))))
+	Encoding.PutUint32(header[LenWidth:], checksum(header[:LenWidth], p))
+	n, err := w.Write(header)
+	if err != nil {
+		return n, err
+	}
+	m, err := w.Write(p)
+	return n + m, err
+}
+
+// parseFrame is ReadFrame for a frame held in memory, at the beginning of b.
+//
+// It returns the record, which aliases b unless compressed, and the size of
+// the frame.
+func parseFrame(b []byte) ([]byte, uint64, error) {
+	if len(b) == 0 {
+		return nil, 0, io.EOF
+	}
+	if len(b) < LenWidth {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	header := b[:LenWidth]
+	version, codec, size := decodeHeader(Encoding.Uint64(header))
+	switch version {
+	case frameV0:
+		if uint64(len(b)-LenWidth) < size {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return b[LenWidth : LenWidth+size], LenWidth + size, nil
+	case frameV1, frameV2:
+		if len(b) < LenWidth+CRCWidth || uint64(len(b)-LenWidth-CRCWidth) < size {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		end := LenWidth + CRCWidth + size
+		p := b[LenWidth+CRCWidth : end]
+		if Encoding.Uint32(b[LenWidth:]) != checksum(header, p) {
+			return nil, 0, errChecksum
+		}
+		p, err := decompress(codec, p)
+		return p, end, err
+	default:
+		return nil, 0, fmt.Errorf("unknown frame version %d: %w", version, errChecksum)
+	}
+}
+
+// readN reads exactly n bytes from r.
+//
+// The buffer is grown as the data comes so that a corrupted length does not
+// allocate more than what r can actually provide.
+func readN(r io.Reader, n uint64) ([]byte, error) {
+	if n <= maxFrameAlloc {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, noEOF(err)
+		}
+		return b, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+func encodeHeader(version byte, codec Codec, size uint64) uint64 {
+	if version < frameV2 {
+		return uint64(version)<<56 | size&lenMask
+	}
+	return uint64(version)<<56 | uint64(codec)<<48 | size&lenMaskV2
+}
+
+func decodeHeader(header uint64) (version byte, codec Codec, size uint64) {
+	version = byte(header >> 56)
+	if version < frameV2 {
+		return version, CodecNone, header & lenMask
+	}
+	return version, Codec(header >> 48), header & lenMaskV2
+}
+
+func checksum(header, p []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, crcTable), crcTable, p)
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
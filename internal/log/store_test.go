@@ -1,6 +1,9 @@
 package log
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"testing"
 
@@ -10,7 +13,7 @@ import (
 // Fixtures for the packed data.
 var (
 	write = []byte("write")
-	width = uint64(LenWidth + len(write))
+	width = uint64(LenWidth + CRCWidth + len(write))
 )
 
 func prepareStore() *store {
@@ -68,15 +71,23 @@ func testRead(t *testing.T, s *store) {
 func testReadAt(t *testing.T, s *store) {
 	t.Helper()
 	for i, off := uint64(1), int64(0); i < 4; i++ {
-		// Read size
+		// Read header
 		b := make([]byte, LenWidth)
 		n, err := s.ReadAt(b, off)
 		require.NoError(t, err)
 		require.Equal(t, LenWidth, n)
 		off += int64(n)
+		version, _, size := decodeHeader(Encoding.Uint64(b))
+		require.Equal(t, frameVersion, version)
+
+		// Read checksum
+		b = make([]byte, CRCWidth)
+		n, err = s.ReadAt(b, off)
+		require.NoError(t, err)
+		require.Equal(t, CRCWidth, n)
+		off += int64(n)
 
 		// Read record
-		size := Encoding.Uint64(b)
 		b = make([]byte, size)
 		n, err = s.ReadAt(b, off)
 		require.NoError(t, err)
@@ -84,3 +95,108 @@ func testReadAt(t *testing.T, s *store) {
 		off += int64(n)
 	}
 }
+
+func TestStoreSeal(t *testing.T) {
+	// Arrange
+	s := prepareStore()
+	defer deleteStore(s)
+	testAppend(t, s)
+
+	// Act
+	require.NoError(t, s.seal())
+
+	// Assert: the sealed store is read from its map.
+	m := s.mapping.Load()
+	require.NotNil(t, m)
+	require.Equal(t, int(3*width), len(m.data))
+	testRead(t, s)
+	testReadAt(t, s)
+	_, err := s.Read(3 * width)
+	require.Equal(t, io.EOF, err)
+
+	// The unsealed store is read from its file again.
+	s.unseal()
+	require.Nil(t, s.mapping.Load())
+	testRead(t, s)
+}
+
+func TestStoreCorruption(t *testing.T) {
+	// Arrange
+	s := prepareStore()
+	defer deleteStore(s)
+	_, pos, err := s.Append(write)
+	require.NoError(t, err)
+	require.NoError(t, s.buf.Flush())
+
+	// Act: flip a bit of the record
+	b := make([]byte, 1)
+	_, err = s.File.ReadAt(b, int64(pos+width-1))
+	require.NoError(t, err)
+	b[0] ^= 1
+	_, err = s.File.WriteAt(b, int64(pos+width-1))
+	require.NoError(t, err)
+
+	// Assert
+	_, err = s.Read(pos)
+	require.True(t, errors.Is(err, errChecksum))
+}
+
+func TestStoreLegacyFrame(t *testing.T) {
+	// Arrange: a frame without version nor checksum
+	s := prepareStore()
+	defer deleteStore(s)
+	b := make([]byte, LenWidth+len(write))
+	Encoding.PutUint64(b, uint64(len(write)))
+	copy(b[LenWidth:], write)
+	_, err := s.File.Write(b)
+	require.NoError(t, err)
+	s.size = uint64(len(b))
+
+	// Act
+	p, err := s.Read(0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, write, p)
+}
+
+func TestStoreCompression(t *testing.T) {
+	record := bytes.Repeat([]byte(`{"key":"value"}`), 64)
+	for _, codec := range []Codec{CodecSnappy, CodecZstd} {
+		t.Run(codec.String(), func(t *testing.T) {
+			// Arrange
+			s := prepareStore()
+			defer deleteStore(s)
+			s.codec = codec
+
+			// Act
+			n, pos, err := s.Append(record)
+			require.NoError(t, err)
+			// Incompressible records are stored as is.
+			_, small, err := s.Append(write)
+			require.NoError(t, err)
+
+			// Assert
+			require.Less(t, n, uint64(len(record)))
+			require.Greater(t, s.CompressionRatio(), float64(1))
+			b := make([]byte, LenWidth)
+			_, err = s.ReadAt(b, int64(pos))
+			require.NoError(t, err)
+			version, got, _ := decodeHeader(Encoding.Uint64(b))
+			require.Equal(t, frameV2, version)
+			require.Equal(t, codec, got)
+			_, err = s.ReadAt(b, int64(small))
+			require.NoError(t, err)
+			version, got, _ = decodeHeader(Encoding.Uint64(b))
+			require.Equal(t, frameV1, version)
+			require.Equal(t, CodecNone, got)
+
+			p, err := s.Read(pos)
+			require.NoError(t, err)
+			require.Equal(t, record, p)
+			p, err = s.Read(small)
+			require.NoError(t, err)
+			require.Equal(t, write, p)
+		})
+	}
+}
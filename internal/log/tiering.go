@@ -0,0 +1,374 @@
+package log
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"time"
+)
+
+// archiveCacheDir is the directory, relative to the log directory, in which
+// the segments fetched from the archive are cached.
+const archiveCacheDir = ".archive-cache"
+
+// loadArchived lists the archived segments preceding the local ones.
+//
+// l.mu must be held.
+func (l *Log) loadArchived() error {
+	l.archived = nil
+	if err := os.RemoveAll(path.Join(l.Dir, archiveCacheDir)); err != nil {
+		return err
+	}
+	a := l.Config.Tiering.Archive
+	if a == nil {
+		return nil
+	}
+	archived, err := a.List(context.Background())
+	if err != nil {
+		return fmt.Errorf("list archived segments: %w", err)
+	}
+	for _, s := range archived {
+		if s.BaseOffset < l.segments[0].baseOffset {
+			l.archived = append(l.archived, s)
+		}
+	}
+	return nil
+}
+
+// archivedNextOffset returns the offset following the i-th archived segment.
+//
+// l.mu must be held.
+func (l *Log) archivedNextOffset(i int) uint64 {
+	if i+1 < len(l.archived) {
+		return l.archived[i+1].BaseOffset
+	}
+	return l.segments[0].baseOffset
+}
+
+// archivedBaseOffset returns the base offset of the archived segment
+// containing off.
+//
+// l.mu must be held.
+func (l *Log) archivedBaseOffset(off uint64) (uint64, bool) {
+	if len(l.archived) == 0 || off < l.archived[0].BaseOffset ||
+		off >= l.segments[0].baseOffset {
+		return 0, false
+	}
+	i := sort.Search(len(l.archived), func(i int) bool {
+		return l.archived[i].BaseOffset > off
+	})
+	return l.archived[i-1].BaseOffset, true
+}
+
+// readArchived reads the record at off from the archived segment starting at
+// baseOffset, fetching the segment if it is not cached.
+func (l *Log) readArchived(baseOffset, off uint64) (*logv1.Record, error) {
+	var record *logv1.Record
+	err := l.withArchived(baseOffset, func(s *segment) error {
+		if off >= s.nextOffset {
+			return ErrOffsetOutOfRange{Offset: off}
+		}
+		var err error
+		record, err = s.Read(off)
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		// Removed by the retention in the meantime.
+		return nil, ErrOffsetOutOfRange{Offset: off}
+	}
+	return record, err
+}
+
+// withArchived calls fn with the archived segment starting at baseOffset,
+// fetching the segment if it is not cached.
+//
+// It returns an error wrapping os.ErrNotExist if the segment is no longer
+// archived.
+func (l *Log) withArchived(baseOffset uint64, fn func(s *segment) error) error {
+	l.cacheMu.Lock()
+	defer l.cacheMu.Unlock()
+	i := slices.IndexFunc(l.cache, func(s *segment) bool {
+		return s.baseOffset == baseOffset
+	})
+	var s *segment
+	if i >= 0 {
+		s = l.cache[i]
+		l.cache = slices.Delete(l.cache, i, i+1)
+	} else {
+		var err error
+		if s, err = l.fetchArchived(baseOffset); err != nil {
+			return fmt.Errorf("fetch segment %d: %w", baseOffset, err)
+		}
+		for len(l.cache) >= max(l.Config.Tiering.CacheSegments, 1) {
+			if err := l.cache[0].Remove(); err != nil {
+				return err
+			}
+			l.cache = l.cache[1:]
+		}
+	}
+	// The most recently used segment is the last one.
+	l.cache = append(l.cache, s)
+	return fn(s)
+}
+
+// archivedOffsetForTime returns the offset of the first archived record
+// appended at or after t, searching the archived segments by their last
+// append time.
+//
+// It returns io.EOF if every archived record was appended before t.
+func (l *Log) archivedOffsetForTime(archived []ArchivedSegment, t time.Time) (uint64, error) {
+	ts := t.UnixNano()
+	var err error
+	i := sort.Search(len(archived), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		err = l.withArchived(archived[i].BaseOffset, func(s *segment) error {
+			if s.maxTime.Load() < ts {
+				return io.EOF
+			}
+			return nil
+		})
+		if err == io.EOF {
+			err = nil
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if i == len(archived) {
+		return 0, io.EOF
+	}
+	var off uint64
+	err = l.withArchived(archived[i].BaseOffset, func(s *segment) error {
+		off, err = s.OffsetForTime(t)
+		return err
+	})
+	return off, err
+}
+
+// fetchArchived downloads the archived segment to the cache directory and
+// opens it.
+func (l *Log) fetchArchived(baseOffset uint64) (*segment, error) {
+	dir := path.Join(l.Dir, archiveCacheDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	storeName := path.Join(dir, fmt.Sprintf("%d.store", baseOffset))
+	indexName := path.Join(dir, fmt.Sprintf("%d.index", baseOffset))
+	remove := func() {
+		for _, name := range []string{storeName, indexName} {
+			_ = os.Remove(name)
+		}
+		_ = os.Remove(path.Join(dir, fmt.Sprintf("%d.timeindex", baseOffset)))
+	}
+	store, err := os.Create(storeName)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	index, err := os.Create(indexName)
+	if err != nil {
+		remove()
+		return nil, err
+	}
+	defer index.Close()
+	if err := l.Config.Tiering.Archive.Get(
+		context.Background(),
+		baseOffset,
+		store,
+		index,
+	); err != nil {
+		remove()
+		return nil, err
+	}
+	s, err := newSegment(dir, baseOffset, l.Config)
+	if err != nil {
+		remove()
+		return nil, err
+	}
+	if err := s.seal(); err != nil {
+		_ = s.Remove()
+		return nil, err
+	}
+	tieringFetchedSegments.Add(context.Background(), 1)
+	return s, nil
+}
+
+// removeArchived deletes the archived segments whose highest offset is lower
+// than or equal to lowest.
+//
+// l.mu must be held.
+func (l *Log) removeArchived(lowest uint64) (removed int64, reclaimed uint64, err error) {
+	a := l.Config.Tiering.Archive
+	for len(l.archived) > 0 && l.archivedNextOffset(0) <= lowest+1 {
+		s := l.archived[0]
+		if err := a.Delete(context.Background(), s.BaseOffset); err != nil {
+			return removed, reclaimed, err
+		}
+		l.archived = l.archived[1:]
+		removed++
+		reclaimed += s.Size
+		if err := l.evictCached(s.BaseOffset); err != nil {
+			return removed, reclaimed, err
+		}
+	}
+	return removed, reclaimed, nil
+}
+
+// evictCached removes the fetched copy of an archived segment, if any.
+func (l *Log) evictCached(baseOffset uint64) error {
+	l.cacheMu.Lock()
+	defer l.cacheMu.Unlock()
+	i := slices.IndexFunc(l.cache, func(s *segment) bool {
+		return s.baseOffset == baseOffset
+	})
+	if i < 0 {
+		return nil
+	}
+	s := l.cache[i]
+	l.cache = slices.Delete(l.cache, i, i+1)
+	return s.Remove()
+}
+
+// closeCache removes the fetched copies of the archived segments.
+func (l *Log) closeCache() error {
+	l.cacheMu.Lock()
+	defer l.cacheMu.Unlock()
+	for _, s := range l.cache {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	l.cache = nil
+	return nil
+}
+
+// Offload uploads the oldest sealed segments past the local limits to the
+// archive and removes them from the local disk.
+//
+// The active segment is never offloaded.
+func (l *Log) Offload(now time.Time) error {
+	if l.Config.Tiering.Archive == nil {
+		return nil
+	}
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+	for {
+		l.mu.RLock()
+		s := l.offloadCandidate(now)
+		l.mu.RUnlock()
+		if s == nil {
+			return nil
+		}
+		if err := l.offloadSegment(s); err != nil {
+			return fmt.Errorf("offload segment %d: %w", s.baseOffset, err)
+		}
+	}
+}
+
+// offloadCandidate returns the oldest local segment if it is sealed and past
+// the local limits, or nil.
+//
+// l.mu must be held.
+func (l *Log) offloadCandidate(now time.Time) *segment {
+	if len(l.segments) < 2 {
+		return nil
+	}
+	t := l.Config.Tiering
+	s := l.segments[0]
+	var total uint64
+	for _, s := range l.segments {
+		total += s.size()
+	}
+	if t.LocalMaxBytes > 0 && total > t.LocalMaxBytes {
+		return s
+	}
+	if t.LocalMaxAge > 0 {
+		if fi, err := os.Stat(s.store.Name()); err == nil && now.Sub(fi.ModTime()) > t.LocalMaxAge {
+			return s
+		}
+	}
+	return nil
+}
+
+// offloadSegment uploads the oldest local segment and removes it.
+func (l *Log) offloadSegment(s *segment) error {
+	unpin, err := l.pin(s)
+	if err != nil {
+		return err
+	}
+	err = s.Sync()
+	unpin()
+	if err != nil {
+		return err
+	}
+	// The segment may be closed by now: its file is stated by name.
+	fi, err := os.Stat(s.store.Name())
+	if err != nil {
+		return err
+	}
+	store, err := os.Open(s.store.Name())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	index, err := os.Open(s.index.Name())
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	archived := ArchivedSegment{
+		BaseOffset: s.baseOffset,
+		Size:       s.store.size + s.index.size,
+		ModTime:    fi.ModTime(),
+	}
+	// The index file may have room left: only its header and entries are
+	// uploaded.
+	if err := l.Config.Tiering.Archive.Put(
+		context.Background(),
+		archived,
+		io.NewSectionReader(store, 0, int64(s.store.size)),
+		io.NewSectionReader(index, 0, int64(headerWidth+s.index.size)),
+	); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := s.size()
+	if err := l.removeSegment(s); err != nil {
+		return err
+	}
+	l.segments = l.segments[1:]
+	l.archived = append(l.archived, archived)
+
+	tieringOffloadedSegments.Add(context.Background(), 1)
+	tieringOffloadedBytes.Add(context.Background(), int64(archived.Size))
+	slog.Info(
+		"offloaded segment",
+		"dir",
+		l.Dir,
+		"segment",
+		s.baseOffset,
+		"bytes",
+		size,
+	)
+	return nil
+}
+
+// offload runs the offloading of the sealed segments.
+func (l *Log) offload(now time.Time) {
+	if err := l.Offload(now); err != nil {
+		slog.Error("offloading failed", "dir", l.Dir, "error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"context"
+	logv1 "distributed-systems/gen/log/v1"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiering(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"read offloaded records":    testTieringRead,
+		"reopen with offloaded log": testTieringReopen,
+		"retention removes archive": testTieringRetention,
+		"fetched segments cache":    testTieringCache,
+		"offset for archived time":  testTieringOffsetForTime,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "tiering-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// Each segment holds 2 records, and only the active segment is
+			// kept locally.
+			c := Config{}
+			c.Segment.MaxIndexBytes = entryWidth * 2
+			c.Tiering.Archive = LocalArchive{Dir: path.Join(dir, "archive")}
+			c.Tiering.LocalMaxBytes = 1
+			require.NoError(t, os.Mkdir(path.Join(dir, "log"), 0755))
+			log, err := NewLog(path.Join(dir, "log"), c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			for i := 0; i < 6; i++ {
+				_, err := log.Append(&logv1.Record{
+					Value: []byte("hello world"),
+				})
+				require.NoError(t, err)
+			}
+			require.NoError(t, log.Offload(time.Now()))
+			require.Len(t, log.segments, 1)
+			require.Len(t, log.archived, 3)
+
+			fn(t, log)
+		})
+	}
+}
+
+func testTieringRead(t *testing.T, log *Log) {
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lowest)
+
+	for off := uint64(0); off < 6; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+		require.Equal(t, []byte("hello world"), read.Value)
+	}
+	_, err = log.Read(6)
+	require.ErrorAs(t, err, &ErrOffsetOutOfRange{})
+}
+
+func testTieringOffsetForTime(t *testing.T, log *Log) {
+	var times []time.Time
+	for off := uint64(0); off < 6; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		times = append(times, read.AppendTime.AsTime())
+	}
+	for _, ts := range append(times, times[5].Add(time.Nanosecond)) {
+		want := uint64(slices.IndexFunc(times, func(t time.Time) bool {
+			return !t.Before(ts)
+		}))
+		if want == math.MaxUint64 {
+			want = 6
+		}
+		off, err := log.OffsetForTime(ts)
+		require.NoError(t, err)
+		require.Equal(t, want, off, ts)
+	}
+}
+
+func testTieringReopen(t *testing.T, o *Log) {
+	require.NoError(t, o.Close())
+	log, err := NewLog(o.Dir, o.Config)
+	require.NoError(t, err)
+	defer log.Close()
+
+	require.Len(t, log.archived, 3)
+	read, err := log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), read.Offset)
+}
+
+func testTieringRetention(t *testing.T, log *Log) {
+	_, err := log.Read(0)
+	require.NoError(t, err)
+	log.Config.Retention.MaxBytes = 1
+	log.Config.Retention.MinRecords = 2
+
+	off, ok := log.RetentionOffset(time.Now())
+	require.True(t, ok)
+	require.Equal(t, uint64(3), off)
+
+	require.NoError(t, log.Retain(off))
+	require.Len(t, log.archived, 1)
+	require.Empty(t, log.cache)
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lowest)
+	_, err = log.Read(3)
+	require.ErrorAs(t, err, &ErrOffsetOutOfRange{})
+
+	segments, err := log.Config.Tiering.Archive.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+}
+
+func testTieringCache(t *testing.T, log *Log) {
+	log.Config.Tiering.CacheSegments = 2
+	for _, off := range []uint64{0, 2, 4, 1} {
+		_, err := log.Read(off)
+		require.NoError(t, err)
+	}
+	require.Len(t, log.cache, 2)
+	// The segment 2 was evicted.
+	require.Equal(t, uint64(4), log.cache[0].baseOffset)
+	require.Equal(t, uint64(0), log.cache[1].baseOffset)
+}
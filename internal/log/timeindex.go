@@ -0,0 +1,50 @@
+package log
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// timeIndex maps append times to relative offsets.
+//
+// It reuses the layout of the index: 8 bytes for the relative offset and
+// 8 bytes for the append time in Unix nanoseconds. An entry is only written
+// when the time is greater than the last one, so that the entries are sorted
+// even if the clock goes backward.
+type timeIndex struct {
+	*index
+}
+
+func newTimeIndex(f *os.File, c Config) (*timeIndex, error) {
+	idx, err := newIndex(f, c)
+	if err != nil {
+		return nil, err
+	}
+	return &timeIndex{idx}, nil
+}
+
+// Append indexes the append time of the record at the relative offset off.
+func (t *timeIndex) Append(off uint64, ts int64) error {
+	if _, last, err := t.Read(-1); err == nil && int64(last) >= ts {
+		return nil
+	}
+	return t.Write(off, uint64(ts))
+}
+
+// Lookup returns the relative offset of the first record appended at or
+// after ts.
+//
+// It returns io.EOF if every record was appended before ts.
+func (t *timeIndex) Lookup(ts int64) (uint64, error) {
+	n := int(t.size / entryWidth)
+	k := sort.Search(n, func(k int) bool {
+		_, last, _ := t.Read(int64(k))
+		return int64(last) >= ts
+	})
+	if k == n {
+		return 0, io.EOF
+	}
+	off, _, err := t.Read(int64(k))
+	return off, err
+}
@@ -0,0 +1,47 @@
+package log
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeIndex(t *testing.T) {
+	f, err := os.CreateTemp("", "timeindex")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	c := Config{}
+	c.Segment.MaxIndexBytes = 1024
+	idx, err := newTimeIndex(f, c)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	_, err = idx.Lookup(0)
+	require.Equal(t, io.EOF, err)
+
+	require.NoError(t, idx.Append(0, 100))
+	require.NoError(t, idx.Append(1, 200))
+	// The clock went backward: the entry is skipped.
+	require.NoError(t, idx.Append(2, 150))
+	require.NoError(t, idx.Append(3, 300))
+	require.Equal(t, uint64(3*entryWidth), idx.size)
+
+	for _, tt := range []struct {
+		ts   int64
+		want uint64
+	}{
+		{ts: 50, want: 0},
+		{ts: 100, want: 0},
+		{ts: 150, want: 1},
+		{ts: 201, want: 3},
+		{ts: 300, want: 3},
+	} {
+		off, err := idx.Lookup(tt.ts)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, off, tt.ts)
+	}
+	_, err = idx.Lookup(301)
+	require.Equal(t, io.EOF, err)
+}
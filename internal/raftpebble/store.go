@@ -82,6 +82,53 @@ func (l *eventListener) onWALCreated(pebble.WALCreateInfo) {
 func New(options ...Option) (*PebbleKVStore, error) {
 	// config defined options
 	kvStoreOpts := getOptions(options...)
+	opts, cache := newPebbleOptions(kvStoreOpts)
+
+	kv := &PebbleKVStore{
+		options: kvStoreOpts,
+		dbSet:   make(chan struct{}),
+	}
+	event := &eventListener{
+		kv:      kv,
+		stopper: syncutil.NewStopper(),
+	}
+	opts.EventListener = &pebble.EventListener{
+		WALCreated:    event.onWALCreated,
+		FlushEnd:      event.onFlushEnd,
+		CompactionEnd: event.onCompactionEnd,
+	}
+
+	if kvStoreOpts.pebbleOptions != nil {
+		opts = kvStoreOpts.pebbleOptions
+	}
+
+	pdb, err := pebble.Open(kvStoreOpts.dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	cache.Unref()
+	kv.db = pdb
+	kv.setEventListener(event)
+	//kv.defaultWriteOpts = &pebble.WriteOptions{Sync: true}
+	kv.defaultWriteOpts = &pebble.WriteOptions{Sync: false}
+	return kv, nil
+}
+
+// Open opens a pebble db configured like the raft log store, for other
+// uses than raft.
+func Open(options ...Option) (*pebble.DB, error) {
+	kvStoreOpts := getOptions(options...)
+	opts, cache := newPebbleOptions(kvStoreOpts)
+	if kvStoreOpts.pebbleOptions != nil {
+		opts = kvStoreOpts.pebbleOptions
+	}
+	defer cache.Unref()
+	return pebble.Open(kvStoreOpts.dir, opts)
+}
+
+// newPebbleOptions returns the pebble options derived from the config, and
+// the block cache to unref once the db is open.
+func newPebbleOptions(kvStoreOpts *options) (*pebble.Options, *pebble.Cache) {
 	config := kvStoreOpts.config
 	logger := kvStoreOpts.logger
 	fs := kvStoreOpts.fs
@@ -115,35 +162,7 @@ func New(options ...Option) (*PebbleKVStore, error) {
 		WALDir:                      walDir,
 		FormatMajorVersion:          pebble.FormatNewest,
 	}
-
-	kv := &PebbleKVStore{
-		options: kvStoreOpts,
-		dbSet:   make(chan struct{}),
-	}
-	event := &eventListener{
-		kv:      kv,
-		stopper: syncutil.NewStopper(),
-	}
-	opts.EventListener = &pebble.EventListener{
-		WALCreated:    event.onWALCreated,
-		FlushEnd:      event.onFlushEnd,
-		CompactionEnd: event.onCompactionEnd,
-	}
-
-	if kvStoreOpts.pebbleOptions != nil {
-		opts = kvStoreOpts.pebbleOptions
-	}
-
-	pdb, err := pebble.Open(kvStoreOpts.dir, opts)
-	if err != nil {
-		return nil, err
-	}
-	cache.Unref()
-	kv.db = pdb
-	kv.setEventListener(event)
-	//kv.defaultWriteOpts = &pebble.WriteOptions{Sync: true}
-	kv.defaultWriteOpts = &pebble.WriteOptions{Sync: false}
-	return kv, nil
+	return opts, cache
 }
 
 func (s *PebbleKVStore) setEventListener(event *eventListener) {
@@ -28,6 +28,62 @@ func WrapToConnectError(err error) error {
 	if errors.As(err, &errOOR) {
 		return addErrOffsetOutOfRangeDetails(errOOR)
 	}
+	var errCompacted log.ErrOffsetCompacted
+	if errors.As(err, &errCompacted) {
+		return addErrOffsetCompactedDetails(errCompacted)
+	}
+	var errTruncated log.ErrOffsetTruncated
+	if errors.As(err, &errTruncated) {
+		return addErrOffsetTruncatedDetails(errTruncated)
+	}
+	var errCorrupt log.ErrCorruptRecord
+	if errors.As(err, &errCorrupt) {
+		return addErrCorruptRecordDetails(errCorrupt)
+	}
+	var errNotFound log.ErrTopicNotFound
+	if errors.As(err, &errNotFound) {
+		return connect.NewError(connect.CodeNotFound, errNotFound)
+	}
+	var errPartition log.ErrPartitionNotFound
+	if errors.As(err, &errPartition) {
+		return connect.NewError(connect.CodeNotFound, errPartition)
+	}
+	var errExists log.ErrTopicExists
+	if errors.As(err, &errExists) {
+		return connect.NewError(connect.CodeAlreadyExists, errExists)
+	}
+	var errInvalid log.ErrInvalidTopic
+	if errors.As(err, &errInvalid) {
+		return connect.NewError(connect.CodeInvalidArgument, errInvalid)
+	}
+	var errProducer log.ErrUnknownProducer
+	if errors.As(err, &errProducer) {
+		return connect.NewError(connect.CodeFailedPrecondition, errProducer)
+	}
+	var errSequence log.ErrOutOfOrderSequence
+	if errors.As(err, &errSequence) {
+		return connect.NewError(connect.CodeFailedPrecondition, errSequence)
+	}
+	var errTxn log.ErrTxnNotFound
+	if errors.As(err, &errTxn) {
+		return connect.NewError(connect.CodeNotFound, errTxn)
+	}
+	var errGroupOffset log.ErrGroupOffsetNotFound
+	if errors.As(err, &errGroupOffset) {
+		return connect.NewError(connect.CodeNotFound, errGroupOffset)
+	}
+	var errGroup log.ErrInvalidGroup
+	if errors.As(err, &errGroup) {
+		return connect.NewError(connect.CodeInvalidArgument, errGroup)
+	}
+	var errMember log.ErrUnknownMember
+	if errors.As(err, &errMember) {
+		return connect.NewError(connect.CodeNotFound, errMember)
+	}
+	var errGeneration log.ErrStaleGeneration
+	if errors.As(err, &errGeneration) {
+		return connect.NewError(connect.CodeFailedPrecondition, errGeneration)
+	}
 	return err
 }
 
@@ -45,3 +101,51 @@ func addErrOffsetOutOfRangeDetails(e *log.ErrOffsetOutOfRange) *connect.Error {
 	}
 	return newErr
 }
+
+func addErrOffsetCompactedDetails(e log.ErrOffsetCompacted) *connect.Error {
+	newErr := connect.NewError(connect.CodeNotFound, e)
+	msg := fmt.Sprintf(
+		"The requested offset %d was removed by the log compaction, the next offset is %d",
+		e.Offset,
+		e.Next,
+	)
+	if detail, err := connect.NewErrorDetail(&errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}); err == nil {
+		newErr.AddDetail(detail)
+	}
+	return newErr
+}
+
+func addErrOffsetTruncatedDetails(e log.ErrOffsetTruncated) *connect.Error {
+	newErr := connect.NewError(connect.CodeNotFound, e)
+	msg := fmt.Sprintf(
+		"The requested offset %d was removed by the log retention, the lowest offset is %d",
+		e.Offset,
+		e.Lowest,
+	)
+	if detail, err := connect.NewErrorDetail(&errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}); err == nil {
+		newErr.AddDetail(detail)
+	}
+	return newErr
+}
+
+func addErrCorruptRecordDetails(e log.ErrCorruptRecord) *connect.Error {
+	newErr := connect.NewError(connect.CodeDataLoss, e)
+	msg := fmt.Sprintf(
+		"The record at offset %d is corrupted (segment %d)",
+		e.Offset,
+		e.Segment,
+	)
+	if detail, err := connect.NewErrorDetail(&errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}); err == nil {
+		newErr.AddDetail(detail)
+	}
+	return newErr
+}
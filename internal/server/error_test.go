@@ -0,0 +1,31 @@
+package server
+
+import (
+	"distributed-systems/internal/log"
+	"errors"
+	"fmt"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapToConnectError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		code connect.Code
+	}{
+		"compacted offset": {log.ErrOffsetCompacted{Offset: 1, Next: 2}, connect.CodeNotFound},
+		"truncated offset": {log.ErrOffsetTruncated{Offset: 1, Lowest: 2}, connect.CodeNotFound},
+		"corrupt record":   {log.ErrCorruptRecord{Offset: 1}, connect.CodeDataLoss},
+		"wrapped error": {
+			fmt.Errorf("read: %w", log.ErrCorruptRecord{Offset: 1}),
+			connect.CodeDataLoss,
+		},
+		"unknown error": {errors.New("unknown"), connect.CodeUnknown},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.code, connect.CodeOf(WrapToConnectError(tc.err)))
+		})
+	}
+}
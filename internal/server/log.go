@@ -5,19 +5,160 @@ import (
 	logv1 "distributed-systems/gen/log/v1"
 	"distributed-systems/gen/log/v1/logv1connect"
 	"distributed-systems/internal/log"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 type CommitLog interface {
 	Append(*logv1.Record) (uint64, error)
 	Read(uint64) (*logv1.Record, error)
+	OffsetForTime(time.Time) (uint64, error)
+}
+
+// EncodedReader is implemented by the commit logs which can return the
+// encoded records, without decoding them.
+type EncodedReader interface {
+	// ReadEncoded returns a copy of the encoded record at the given offset.
+	ReadEncoded(uint64) ([]byte, error)
+}
+
+// Iterable is implemented by the commit logs which read their records
+// sequentially, instead of looking up every offset in their indexes.
+type Iterable interface {
+	// Iterator returns an iterator over the records starting at the given
+	// offset.
+	Iterator(uint64, ...log.IteratorOption) (*log.Iterator, error)
+}
+
+// OffsetWaiter is implemented by the commit logs which notify the appends.
+type OffsetWaiter interface {
+	// WaitForOffset blocks until the record at the given offset is appended,
+	// or the context is done. It returns log.ErrOffsetTruncated if the
+	// offset is lower than the lowest offset of the log, and io.EOF once the
+	// log is closed.
+	WaitForOffset(context.Context, uint64) error
+}
+
+// OffsetReader is implemented by the commit logs reporting their bounds.
+type OffsetReader interface {
+	// Offsets returns the lowest offset of the log and the offset of the next
+	// appended record.
+	Offsets() (lowest, next uint64, err error)
+}
+
+// Replication is implemented by the commit logs replicated to other nodes.
+type Replication interface {
+	Replication() (*logv1.Replication, error)
+}
+
+// pollInterval is the interval at which the commit logs which are not
+// OffsetWaiters are read again for new records.
+const pollInterval = 100 * time.Millisecond
+
+// TopicRegistry is implemented by the commit logs holding named topics
+// besides the default one.
+type TopicRegistry interface {
+	CreateTopic(*logv1.Topic) error
+	DeleteTopic(string) error
+	ListTopics() []*logv1.Topic
+	// ListPartitions returns the partitions of the topic and their owners,
+	// the default topic if the name is empty.
+	ListPartitions(string) ([]*logv1.Partition, error)
+	// Topic returns the topic, or log.ErrTopicNotFound.
+	Topic(string) (Topic, error)
+}
+
+// Topic is a named topic made of partitions, each its own commit log.
+type Topic interface {
+	Partitions() (uint32, error)
+	// Append appends the record to the partition of its key, or to the next
+	// partition in turn if it has no key.
+	Append(*logv1.Record) (partition uint32, offset uint64, err error)
+	// Partition returns the commit log of the partition, or
+	// log.ErrPartitionNotFound.
+	Partition(uint32) (CommitLog, error)
+}
+
+// Producers is implemented by the commit logs supporting idempotent
+// producers.
+type Producers interface {
+	InitProducer() (uint64, error)
+	// Produce appends the record of the request, unless it was appended
+	// already by its producer, and returns its partition and offset.
+	Produce(*logv1.ProduceRequest) (*logv1.ProduceResponse, error)
+}
+
+// Transactions is implemented by the commit logs supporting transactions
+// whose records are appended together, or not at all.
+type Transactions interface {
+	BeginTxn() (uint64, error)
+	// ProduceTxn stages the record of the request in the transaction and
+	// returns its partition.
+	ProduceTxn(uint64, *logv1.ProduceRequest) (uint32, error)
+	// CommitTxn appends the records of the transaction and returns their
+	// partitions and offsets.
+	CommitTxn(uint64) ([]*logv1.ProduceResponse, error)
+	AbortTxn(uint64) error
+}
+
+// Groups is implemented by the commit logs storing the offsets committed by
+// the consumer groups.
+type Groups interface {
+	// CommitOffset commits the offset of the request, or fails with
+	// log.ErrStaleGeneration if its consumer is not in the current generation
+	// of the group.
+	CommitOffset(*logv1.CommitOffsetRequest) error
+	// FetchOffset returns the offset committed by the group for the
+	// partition, or log.ErrGroupOffsetNotFound.
+	FetchOffset(group, topic string, partition uint32) (uint64, error)
+	ListGroups() []*logv1.ConsumerGroup
+}
+
+// GroupCoordinator is implemented by the commit logs sharing the partitions
+// of a topic between the members of a consumer group.
+type GroupCoordinator interface {
+	JoinGroup(*logv1.JoinGroupRequest) (*logv1.JoinGroupResponse, error)
+	Heartbeat(group, member string) (*logv1.HeartbeatResponse, error)
+	LeaveGroup(group, member string) error
 }
 
 type Config struct {
+	// CommitLog is the commit log of the default topic.
 	CommitLog
+	// Topics is the registry of the named topics.
+	//
+	// The requests naming a topic fail with log.ErrTopicNotFound if nil.
+	Topics TopicRegistry
+	// Producers serves the idempotent producers.
+	//
+	// The requests of idempotent producers are unimplemented if nil.
+	Producers Producers
+	// Transactions serves the transactions.
+	//
+	// The requests of transactions are unimplemented if nil.
+	Transactions Transactions
+	// Groups serves the offsets of the consumer groups.
+	//
+	// The requests of consumer groups are unimplemented if nil.
+	Groups Groups
+	// Coordinator serves the members of the consumer groups.
+	//
+	// The requests of the members of consumer groups are unimplemented if nil.
+	Coordinator GroupCoordinator
+	// Replication reports the progress of the replication of the commit logs.
+	//
+	// The offsets are returned without replication if nil.
+	Replication Replication
+	// Keepalive is the interval after which a response without record is
+	// sent on the idle consume streams, so that the clients and proxies do
+	// not close them. No keepalive is sent if zero.
+	Keepalive time.Duration
 }
 
 var _ logv1connect.LogAPIHandler = (*LogAPIHandler)(nil)
@@ -39,11 +180,395 @@ func NewLogAPIHandler(config *Config, opts ...connect.HandlerOption) (string, ht
 	return path, handler
 }
 
+// topic returns the named topic.
+func (s *LogAPIHandler) topic(name string) (Topic, error) {
+	if s.Topics == nil {
+		return nil, log.ErrTopicNotFound{Name: name}
+	}
+	return s.Topics.Topic(name)
+}
+
+// commitLog returns the commit log of the partition of the topic. The
+// default topic has no name and a single partition.
+func (s *LogAPIHandler) commitLog(name string, partition uint32) (CommitLog, error) {
+	if name == "" {
+		if partition != 0 {
+			return nil, log.ErrPartitionNotFound{Partition: partition}
+		}
+		return s.CommitLog, nil
+	}
+	topic, err := s.topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return topic.Partition(partition)
+}
+
+// append appends the record to the given partition of the topic, or to the
+// partition chosen by the topic if nil.
+func (s *LogAPIHandler) append(
+	name string,
+	partition *uint32,
+	record *logv1.Record,
+) (uint32, uint64, error) {
+	if name != "" && partition == nil {
+		topic, err := s.topic(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return topic.Append(record)
+	}
+	var p uint32
+	if partition != nil {
+		p = *partition
+	}
+	clog, err := s.commitLog(name, p)
+	if err != nil {
+		return 0, 0, err
+	}
+	off, err := clog.Append(record)
+	return p, off, err
+}
+
+// topics returns the topic registry, or an unimplemented error if nil.
+func (s *LogAPIHandler) topics() (TopicRegistry, error) {
+	if s.Topics == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("topics are not supported"))
+	}
+	return s.Topics, nil
+}
+
+// producers returns the idempotent producers, or an unimplemented error if
+// nil.
+func (s *LogAPIHandler) producers() (Producers, error) {
+	if s.Producers == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("idempotent producers are not supported"))
+	}
+	return s.Producers, nil
+}
+
+func (s *LogAPIHandler) InitProducer(
+	_ context.Context,
+	_ *connect.Request[logv1.InitProducerRequest],
+) (*connect.Response[logv1.InitProducerResponse], error) {
+	producers, err := s.producers()
+	if err != nil {
+		return nil, err
+	}
+	id, err := producers.InitProducer()
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.InitProducerResponse]{
+		Msg: &logv1.InitProducerResponse{
+			ProducerId: id,
+		},
+	}, nil
+}
+
+// transactions returns the transactions, or an unimplemented error if nil.
+func (s *LogAPIHandler) transactions() (Transactions, error) {
+	if s.Transactions == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("transactions are not supported"))
+	}
+	return s.Transactions, nil
+}
+
+func (s *LogAPIHandler) BeginTxn(
+	_ context.Context,
+	_ *connect.Request[logv1.BeginTxnRequest],
+) (*connect.Response[logv1.BeginTxnResponse], error) {
+	txns, err := s.transactions()
+	if err != nil {
+		return nil, err
+	}
+	id, err := txns.BeginTxn()
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.BeginTxnResponse]{
+		Msg: &logv1.BeginTxnResponse{
+			TxnId: id,
+		},
+	}, nil
+}
+
+func (s *LogAPIHandler) ProduceTxn(
+	_ context.Context,
+	req *connect.Request[logv1.ProduceTxnRequest],
+) (*connect.Response[logv1.ProduceTxnResponse], error) {
+	txns, err := s.transactions()
+	if err != nil {
+		return nil, err
+	}
+	partition, err := txns.ProduceTxn(req.Msg.TxnId, &logv1.ProduceRequest{
+		Record:    req.Msg.Record,
+		Topic:     req.Msg.Topic,
+		Partition: req.Msg.Partition,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.ProduceTxnResponse]{
+		Msg: &logv1.ProduceTxnResponse{
+			Partition: partition,
+		},
+	}, nil
+}
+
+func (s *LogAPIHandler) CommitTxn(
+	_ context.Context,
+	req *connect.Request[logv1.CommitTxnRequest],
+) (*connect.Response[logv1.CommitTxnResponse], error) {
+	txns, err := s.transactions()
+	if err != nil {
+		return nil, err
+	}
+	records, err := txns.CommitTxn(req.Msg.TxnId)
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.CommitTxnResponse]{
+		Msg: &logv1.CommitTxnResponse{
+			Records: records,
+		},
+	}, nil
+}
+
+func (s *LogAPIHandler) AbortTxn(
+	_ context.Context,
+	req *connect.Request[logv1.AbortTxnRequest],
+) (*connect.Response[logv1.AbortTxnResponse], error) {
+	txns, err := s.transactions()
+	if err != nil {
+		return nil, err
+	}
+	if err := txns.AbortTxn(req.Msg.TxnId); err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.AbortTxnResponse]{
+		Msg: &logv1.AbortTxnResponse{},
+	}, nil
+}
+
+// groups returns the consumer groups, or an unimplemented error if nil.
+func (s *LogAPIHandler) groups() (Groups, error) {
+	if s.Groups == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("consumer groups are not supported"))
+	}
+	return s.Groups, nil
+}
+
+func (s *LogAPIHandler) CommitOffset(
+	_ context.Context,
+	req *connect.Request[logv1.CommitOffsetRequest],
+) (*connect.Response[logv1.CommitOffsetResponse], error) {
+	groups, err := s.groups()
+	if err != nil {
+		return nil, err
+	}
+	if req.Msg.Group == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("missing group"))
+	}
+	if err := groups.CommitOffset(req.Msg); err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.CommitOffsetResponse]{
+		Msg: &logv1.CommitOffsetResponse{},
+	}, nil
+}
+
+func (s *LogAPIHandler) FetchOffset(
+	_ context.Context,
+	req *connect.Request[logv1.FetchOffsetRequest],
+) (*connect.Response[logv1.FetchOffsetResponse], error) {
+	groups, err := s.groups()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := groups.FetchOffset(req.Msg.Group, req.Msg.Topic, req.Msg.Partition)
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.FetchOffsetResponse]{
+		Msg: &logv1.FetchOffsetResponse{
+			Offset: offset,
+		},
+	}, nil
+}
+
+func (s *LogAPIHandler) ListGroups(
+	_ context.Context,
+	_ *connect.Request[logv1.ListGroupsRequest],
+) (*connect.Response[logv1.ListGroupsResponse], error) {
+	groups, err := s.groups()
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.ListGroupsResponse]{
+		Msg: &logv1.ListGroupsResponse{
+			Groups: groups.ListGroups(),
+		},
+	}, nil
+}
+
+// coordinator returns the group coordinator, or an unimplemented error if nil.
+func (s *LogAPIHandler) coordinator() (GroupCoordinator, error) {
+	if s.Coordinator == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("consumer group members are not supported"))
+	}
+	return s.Coordinator, nil
+}
+
+func (s *LogAPIHandler) JoinGroup(
+	_ context.Context,
+	req *connect.Request[logv1.JoinGroupRequest],
+) (*connect.Response[logv1.JoinGroupResponse], error) {
+	coordinator, err := s.coordinator()
+	if err != nil {
+		return nil, err
+	}
+	res, err := coordinator.JoinGroup(req.Msg)
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.JoinGroupResponse]{Msg: res}, nil
+}
+
+func (s *LogAPIHandler) Heartbeat(
+	_ context.Context,
+	req *connect.Request[logv1.HeartbeatRequest],
+) (*connect.Response[logv1.HeartbeatResponse], error) {
+	coordinator, err := s.coordinator()
+	if err != nil {
+		return nil, err
+	}
+	res, err := coordinator.Heartbeat(req.Msg.Group, req.Msg.MemberId)
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.HeartbeatResponse]{Msg: res}, nil
+}
+
+func (s *LogAPIHandler) LeaveGroup(
+	_ context.Context,
+	req *connect.Request[logv1.LeaveGroupRequest],
+) (*connect.Response[logv1.LeaveGroupResponse], error) {
+	coordinator, err := s.coordinator()
+	if err != nil {
+		return nil, err
+	}
+	if err := coordinator.LeaveGroup(req.Msg.Group, req.Msg.MemberId); err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.LeaveGroupResponse]{
+		Msg: &logv1.LeaveGroupResponse{},
+	}, nil
+}
+
+func (s *LogAPIHandler) GetOffsets(
+	_ context.Context,
+	req *connect.Request[logv1.GetOffsetsRequest],
+) (*connect.Response[logv1.GetOffsetsResponse], error) {
+	clog, err := s.commitLog(req.Msg.Topic, req.Msg.Partition)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := clog.(OffsetReader)
+	if !ok {
+		return nil, connect.NewError(connect.CodeUnimplemented, errors.New("offsets are not supported"))
+	}
+	lowest, next, err := reader.Offsets()
+	if err != nil {
+		return nil, err
+	}
+	res := &logv1.GetOffsetsResponse{
+		LowestOffset: lowest,
+		NextOffset:   next,
+	}
+	if s.Replication != nil {
+		if res.Replication, err = s.Replication.Replication(); err != nil {
+			return nil, err
+		}
+	}
+	return &connect.Response[logv1.GetOffsetsResponse]{Msg: res}, nil
+}
+
+func (s *LogAPIHandler) CreateTopic(
+	_ context.Context,
+	req *connect.Request[logv1.CreateTopicRequest],
+) (*connect.Response[logv1.CreateTopicResponse], error) {
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	if err := topics.CreateTopic(req.Msg.GetTopic()); err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.CreateTopicResponse]{
+		Msg: &logv1.CreateTopicResponse{},
+	}, nil
+}
+
+func (s *LogAPIHandler) DeleteTopic(
+	_ context.Context,
+	req *connect.Request[logv1.DeleteTopicRequest],
+) (*connect.Response[logv1.DeleteTopicResponse], error) {
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	if err := topics.DeleteTopic(req.Msg.Name); err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.DeleteTopicResponse]{
+		Msg: &logv1.DeleteTopicResponse{},
+	}, nil
+}
+
+func (s *LogAPIHandler) ListTopics(
+	_ context.Context,
+	_ *connect.Request[logv1.ListTopicsRequest],
+) (*connect.Response[logv1.ListTopicsResponse], error) {
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.ListTopicsResponse]{
+		Msg: &logv1.ListTopicsResponse{
+			Topics: topics.ListTopics(),
+		},
+	}, nil
+}
+
+func (s *LogAPIHandler) ListPartitions(
+	_ context.Context,
+	req *connect.Request[logv1.ListPartitionsRequest],
+) (*connect.Response[logv1.ListPartitionsResponse], error) {
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := topics.ListPartitions(req.Msg.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.ListPartitionsResponse]{
+		Msg: &logv1.ListPartitionsResponse{
+			Partitions: partitions,
+		},
+	}, nil
+}
+
 func (s *LogAPIHandler) Consume(
 	_ context.Context,
 	req *connect.Request[logv1.ConsumeRequest],
 ) (*connect.Response[logv1.ConsumeResponse], error) {
-	record, err := s.CommitLog.Read(req.Msg.Offset)
+	clog, err := s.commitLog(req.Msg.Topic, req.Msg.Partition)
+	if err != nil {
+		return nil, err
+	}
+	record, err := clog.Read(req.Msg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -59,44 +584,303 @@ func (s *LogAPIHandler) ConsumeStream(
 	req *connect.Request[logv1.ConsumeStreamRequest],
 	stream *connect.ServerStream[logv1.ConsumeStreamResponse],
 ) error {
+	cursors, err := s.partitionCursors(req.Msg)
+	if err != nil {
+		return WrapToConnectError(err)
+	}
+	// The records are sent encoded as stored unless the stream is in JSON.
+	encoded := !strings.HasSuffix(req.Header().Get("Content-Type"), "json")
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			res, err := s.Consume(ctx, &connect.Request[logv1.ConsumeRequest]{
-				Msg: &logv1.ConsumeRequest{
-					Offset: req.Msg.Offset,
-				},
-			})
-			switch err.(type) {
+		}
+		// The partitions are read in turn, a record at a time.
+		sent := false
+		for _, c := range cursors {
+			res, err := c.next(encoded)
+			switch err := err.(type) {
 			case nil:
 			case log.ErrOffsetOutOfRange:
 				continue
+			case log.ErrOffsetCompacted:
+				// Skip the records removed by the log compaction.
+				if err := c.seek(err.Next); err != nil {
+					return WrapToConnectError(err)
+				}
+				sent = true
+				continue
+			case log.ErrOffsetTruncated:
+				// Skip the records removed by the log retention.
+				if err := c.seek(err.Lowest); err != nil {
+					return WrapToConnectError(err)
+				}
+				sent = true
+				continue
 			default:
+				return WrapToConnectError(err)
+			}
+			res.Partition = c.partition
+			if err := stream.Send(res); err != nil {
 				return connect.NewError(connect.CodeInternal, err)
 			}
-			if err := stream.Send(&logv1.ConsumeStreamResponse{
-				Record: res.Msg.Record,
-			}); err != nil {
+			sent = true
+		}
+		if sent {
+			continue
+		}
+		// Every partition is read up to its end.
+		err := s.waitForRecords(ctx, cursors)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil, err == io.EOF:
+			return nil
+		case errors.Is(err, context.DeadlineExceeded):
+			if err := stream.Send(&logv1.ConsumeStreamResponse{Keepalive: true}); err != nil {
 				return connect.NewError(connect.CodeInternal, err)
 			}
-			req.Msg.Offset++
+		default:
+			return connect.NewError(connect.CodeInternal, err)
+		}
+	}
+}
+
+// waitForRecords blocks until a record is appended to a partition at the
+// offset of its cursor, or ctx is done. It returns
+// context.DeadlineExceeded once the keepalive interval elapses.
+//
+// The cursors whose offset was removed by the retention are moved to the
+// lowest offset of their partition.
+func (s *LogAPIHandler) waitForRecords(ctx context.Context, cursors []*partitionCursor) error {
+	if s.Keepalive > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Keepalive)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		cursor *partitionCursor
+		err    error
+	}
+	results := make(chan result, len(cursors))
+	for _, c := range cursors {
+		go func(c *partitionCursor) {
+			waiter, ok := c.log.(OffsetWaiter)
+			if !ok {
+				select {
+				case <-time.After(pollInterval):
+					results <- result{c, nil}
+				case <-ctx.Done():
+					results <- result{c, ctx.Err()}
+				}
+				return
+			}
+			results <- result{c, waiter.WaitForOffset(ctx, c.offset)}
+		}(c)
+	}
+	res := <-results
+	if truncated, ok := res.err.(log.ErrOffsetTruncated); ok {
+		return res.cursor.seek(truncated.Lowest)
+	}
+	return res.err
+}
+
+// partitionCursor is the next offset to stream from a partition.
+type partitionCursor struct {
+	partition uint32
+	log       CommitLog
+	offset    uint64
+	// it reads the records from offset if the commit log is Iterable.
+	it *log.Iterator
+}
+
+// seek moves the cursor to the offset.
+func (c *partitionCursor) seek(off uint64) error {
+	c.offset = off
+	iterable, ok := c.log.(Iterable)
+	if !ok {
+		return nil
+	}
+	var err error
+	c.it, err = iterable.Iterator(off)
+	return err
+}
+
+// next returns the response carrying the record at the offset of the cursor,
+// and moves the cursor past it. It returns log.ErrOffsetOutOfRange if the
+// record is not appended yet.
+//
+// If encoded, the encoded record is sent as the raw record field of the
+// response, so that it is not decoded and encoded again. The record is still
+// copied out of the log, and into the field.
+func (c *partitionCursor) next(encoded bool) (*logv1.ConsumeStreamResponse, error) {
+	if c.it != nil {
+		var (
+			record *logv1.Record
+			raw    []byte
+			err    error
+		)
+		if encoded {
+			raw, err = c.it.NextEncoded()
+		} else {
+			record, err = c.it.Next()
+		}
+		if err == io.EOF {
+			return nil, log.ErrOffsetOutOfRange{Offset: c.offset}
+		} else if err != nil {
+			return nil, err
+		}
+		c.offset = c.it.Offset()
+		if encoded {
+			return rawResponse(raw), nil
+		}
+		return &logv1.ConsumeStreamResponse{Record: record}, nil
+	}
+	reader, ok := c.log.(EncodedReader)
+	if !ok || !encoded {
+		record, err := c.log.Read(c.offset)
+		if err != nil {
+			return nil, err
+		}
+		c.offset++
+		return &logv1.ConsumeStreamResponse{Record: record}, nil
+	}
+	raw, err := reader.ReadEncoded(c.offset)
+	if err != nil {
+		return nil, err
+	}
+	c.offset++
+	return rawResponse(raw), nil
+}
+
+// rawResponse returns the response carrying the encoded record as its raw
+// record field.
+func rawResponse(record []byte) *logv1.ConsumeStreamResponse {
+	res := &logv1.ConsumeStreamResponse{}
+	m := res.ProtoReflect()
+	field := m.Descriptor().Fields().ByName("record").Number()
+	raw := protowire.AppendTag(nil, field, protowire.BytesType)
+	m.SetUnknown(protowire.AppendBytes(raw, record))
+	return res
+}
+
+// partitionCursors returns the cursors of the partitions streamed by the
+// request, positioned at the offset committed by its group, or at its offset
+// or timestamp.
+func (s *LogAPIHandler) partitionCursors(
+	req *logv1.ConsumeStreamRequest,
+) ([]*partitionCursor, error) {
+	var groups Groups
+	if req.Group != "" {
+		var err error
+		if groups, err = s.groups(); err != nil {
+			return nil, err
+		}
+	}
+	partitions := []uint32{req.Partition}
+	if req.AllPartitions {
+		n := uint32(1)
+		if req.Topic != "" {
+			topic, err := s.topic(req.Topic)
+			if err != nil {
+				return nil, err
+			}
+			if n, err = topic.Partitions(); err != nil {
+				return nil, err
+			}
+		}
+		partitions = make([]uint32, n)
+		for p := range partitions {
+			partitions[p] = uint32(p)
+		}
+	}
+	cursors := make([]*partitionCursor, 0, len(partitions))
+	for _, p := range partitions {
+		clog, err := s.commitLog(req.Topic, p)
+		if err != nil {
+			return nil, err
 		}
+		c := &partitionCursor{partition: p, log: clog}
+		off, err := cursorOffset(req, groups, clog, p)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.seek(off); err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, nil
+}
+
+// cursorOffset returns the offset from which the partition is streamed: the
+// offset committed by the group of the request, or its offset or timestamp.
+func cursorOffset(
+	req *logv1.ConsumeStreamRequest,
+	groups Groups,
+	clog CommitLog,
+	p uint32,
+) (uint64, error) {
+	if groups != nil {
+		off, err := groups.FetchOffset(req.Group, req.Topic, p)
+		switch err.(type) {
+		case nil:
+			return off, nil
+		case log.ErrGroupOffsetNotFound:
+		default:
+			return 0, err
+		}
+	}
+	if req.FromTimestamp != nil {
+		return clog.OffsetForTime(req.FromTimestamp.AsTime())
 	}
+	return req.Offset, nil
+}
+
+func (s *LogAPIHandler) OffsetForTime(
+	_ context.Context,
+	req *connect.Request[logv1.OffsetForTimeRequest],
+) (*connect.Response[logv1.OffsetForTimeResponse], error) {
+	clog, err := s.commitLog(req.Msg.Topic, req.Msg.Partition)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := clog.OffsetForTime(req.Msg.GetTimestamp().AsTime())
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Response[logv1.OffsetForTimeResponse]{
+		Msg: &logv1.OffsetForTimeResponse{
+			Offset: offset,
+		},
+	}, nil
 }
 
 func (s *LogAPIHandler) Produce(
 	_ context.Context,
 	req *connect.Request[logv1.ProduceRequest],
 ) (*connect.Response[logv1.ProduceResponse], error) {
-	offset, err := s.CommitLog.Append(req.Msg.GetRecord())
+	if req.Msg.ProducerId != 0 {
+		producers, err := s.producers()
+		if err != nil {
+			return nil, err
+		}
+		res, err := producers.Produce(req.Msg)
+		if err != nil {
+			return nil, err
+		}
+		return &connect.Response[logv1.ProduceResponse]{Msg: res}, nil
+	}
+	partition, offset, err := s.append(req.Msg.Topic, req.Msg.Partition, req.Msg.GetRecord())
 	if err != nil {
 		return nil, err
 	}
 	return &connect.Response[logv1.ProduceResponse]{
 		Msg: &logv1.ProduceResponse{
-			Offset: offset,
+			Offset:    offset,
+			Partition: partition,
 		},
 	}, nil
 }
@@ -115,14 +899,19 @@ func (s *LogAPIHandler) ProduceStream(
 		}
 		res, err := s.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
 			Msg: &logv1.ProduceRequest{
-				Record: req.Record,
+				Record:     req.Record,
+				Topic:      req.Topic,
+				Partition:  req.Partition,
+				ProducerId: req.ProducerId,
+				Sequence:   req.Sequence,
 			},
 		})
 		if err != nil {
 			return connect.NewError(connect.CodeInternal, err)
 		}
 		if err := stream.Send(&logv1.ProduceStreamResponse{
-			Offset: res.Msg.Offset,
+			Offset:    res.Msg.Offset,
+			Partition: res.Msg.Partition,
 		}); err != nil {
 			return connect.NewError(connect.CodeInternal, err)
 		}
@@ -14,6 +14,9 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,6 +29,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var debug = flag.Bool("debug", false, "Enable observability for debugging")
@@ -59,6 +63,12 @@ func TestServer(t *testing.T) {
 		"produce/consume a message to/from the log succeeeds": testProduceConsume,
 		"produce/consume stream succeeds":                     testProduceConsumeStream,
 		"consume past log boundary fails":                     testConsumePastBoundary,
+		"offset for time succeeds":                            testOffsetForTime,
+		"produce/consume to/from a topic succeeds":            testTopics,
+		"produce/consume to/from partitions succeeds":         testPartitions,
+		"consume from group offsets succeeds":                 testGroups,
+		"consume stream waits for records":                    testConsumeStreamWait,
+		"get offsets succeeds":                                testGetOffsets,
 		"unauthorized fails":                                  testUnauthorized,
 	} {
 		t.Run(scenario, func(t *testing.T) {
@@ -82,8 +92,12 @@ func setupTest(t *testing.T) (
 
 	clog, err := log.NewLog(dir, log.Config{})
 	require.NoError(t, err)
+	topics := &topicRegistry{dir: dir}
 	cfg := &Config{
 		CommitLog: clog,
+		Topics:    topics,
+		Groups:    &groupRegistry{},
+		Keepalive: 500 * time.Millisecond,
 	}
 
 	tlsConfig := &tls.Config{}
@@ -169,6 +183,7 @@ func setupTest(t *testing.T) (
 	return rootClient, nobodyClient, func() {
 		_ = srv.Shutdown(context.Background())
 		_ = l.Close()
+		_ = topics.close()
 		_ = clog.Remove()
 		_ = otelShutdown(context.Background())
 		if metricExporter != nil && traceExporter != nil {
@@ -184,6 +199,11 @@ func testProduceConsume(t *testing.T, rootClient, _ logv1connect.LogAPIClient) {
 
 	want := &logv1.Record{
 		Value: []byte("hello world"),
+		Headers: []*logv1.Header{
+			{Key: "trace-id", Value: []byte("1")},
+			{Key: "trace-id", Value: []byte("2")},
+		},
+		ProduceTime: timestamppb.New(time.Unix(1700000000, 0)),
 	}
 
 	produce, err := rootClient.Produce(
@@ -204,6 +224,12 @@ func testProduceConsume(t *testing.T, rootClient, _ logv1connect.LogAPIClient) {
 	require.NoError(t, err)
 	require.Equal(t, want.Value, consume.Msg.Record.Value)
 	require.Equal(t, want.Offset, consume.Msg.Record.Offset)
+	require.Len(t, consume.Msg.Record.Headers, 2)
+	for i, header := range want.Headers {
+		require.Equal(t, header.Key, consume.Msg.Record.Headers[i].Key)
+		require.Equal(t, header.Value, consume.Msg.Record.Headers[i].Value)
+	}
+	require.True(t, want.ProduceTime.AsTime().Equal(consume.Msg.Record.ProduceTime.AsTime()))
 }
 
 func testConsumePastBoundary(
@@ -274,14 +300,58 @@ func testProduceConsumeStream(
 		for i, record := range records {
 			_ = stream.Receive()
 			require.NoError(t, stream.Err())
-			require.Equal(t, stream.Msg().Record, &logv1.Record{
-				Value:  record.Value,
-				Offset: uint64(i),
-			})
+			require.Equal(t, record.Value, stream.Msg().Record.Value)
+			require.Equal(t, uint64(i), stream.Msg().Record.Offset)
+			require.NotNil(t, stream.Msg().Record.AppendTime)
 		}
 	}
 }
 
+func testOffsetForTime(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx := context.Background()
+
+	produce := func(value string) uint64 {
+		res, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Record: &logv1.Record{
+					Value: []byte(value),
+				},
+			},
+		})
+		require.NoError(t, err)
+		return res.Msg.Offset
+	}
+
+	_ = produce("before")
+	time.Sleep(10 * time.Millisecond)
+	from := time.Now()
+	want := produce("after")
+
+	res, err := rootClient.OffsetForTime(ctx, &connect.Request[logv1.OffsetForTimeRequest]{
+		Msg: &logv1.OffsetForTimeRequest{
+			Timestamp: timestamppb.New(from),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, want, res.Msg.Offset)
+
+	stream, err := rootClient.ConsumeStream(
+		ctx,
+		&connect.Request[logv1.ConsumeStreamRequest]{
+			Msg: &logv1.ConsumeStreamRequest{
+				FromTimestamp: timestamppb.New(from),
+			},
+		},
+	)
+	require.NoError(t, err)
+	require.True(t, stream.Receive())
+	require.Equal(t, want, stream.Msg().Record.Offset)
+	require.Equal(t, []byte("after"), stream.Msg().Record.Value)
+}
+
 func testUnauthorized(
 	t *testing.T,
 	_, nobodyClient logv1connect.LogAPIClient,
@@ -308,3 +378,420 @@ func testUnauthorized(
 	got, want = connect.CodeOf(err), connect.CodePermissionDenied
 	require.Equal(t, want, got)
 }
+
+// topicRegistry is a TopicRegistry of local logs.
+// groupRegistry holds the offsets committed by the consumer groups.
+type groupRegistry struct {
+	mu      sync.Mutex
+	offsets map[string]uint64
+}
+
+func (r *groupRegistry) key(group, topic string, partition uint32) string {
+	return fmt.Sprintf("%s/%s/%d", group, topic, partition)
+}
+
+func (r *groupRegistry) CommitOffset(req *logv1.CommitOffsetRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.offsets == nil {
+		r.offsets = make(map[string]uint64)
+	}
+	r.offsets[r.key(req.Group, req.Topic, req.Partition)] = req.Offset
+	return nil
+}
+
+func (r *groupRegistry) FetchOffset(group, topic string, partition uint32) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	off, ok := r.offsets[r.key(group, topic, partition)]
+	if !ok {
+		return 0, log.ErrGroupOffsetNotFound{Group: group, Topic: topic, Partition: partition}
+	}
+	return off, nil
+}
+
+func (r *groupRegistry) ListGroups() []*logv1.ConsumerGroup {
+	return nil
+}
+
+type topicRegistry struct {
+	dir    string
+	mu     sync.Mutex
+	topics map[string]*testTopic
+}
+
+// testTopic is a Topic whose partitions are local logs, the records being
+// routed in turn.
+type testTopic struct {
+	meta       *logv1.Topic
+	partitions []*log.Log
+	next       atomic.Uint32
+}
+
+func (r *topicRegistry) CreateTopic(topic *logv1.Topic) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.topics[topic.Name]; ok {
+		return log.ErrTopicExists{Name: topic.Name}
+	}
+	t := &testTopic{meta: topic}
+	for p := uint32(0); p < max(topic.GetConfig().GetPartitions(), 1); p++ {
+		dir := filepath.Join(r.dir, "topics", topic.Name, fmt.Sprint(p))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		l, err := log.NewLog(dir, log.Config{})
+		if err != nil {
+			return err
+		}
+		t.partitions = append(t.partitions, l)
+	}
+	if r.topics == nil {
+		r.topics = make(map[string]*testTopic)
+	}
+	r.topics[topic.Name] = t
+	return nil
+}
+
+func (r *topicRegistry) DeleteTopic(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.topics[name]
+	if !ok {
+		return log.ErrTopicNotFound{Name: name}
+	}
+	delete(r.topics, name)
+	for _, l := range t.partitions {
+		if err := l.Remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *topicRegistry) ListTopics() []*logv1.Topic {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var topics []*logv1.Topic
+	for _, t := range r.topics {
+		topics = append(topics, t.meta)
+	}
+	return topics
+}
+
+func (r *topicRegistry) ListPartitions(name string) ([]*logv1.Partition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.topics[name]
+	if !ok {
+		return nil, log.ErrTopicNotFound{Name: name}
+	}
+	var partitions []*logv1.Partition
+	for p, l := range t.partitions {
+		partitions = append(partitions, &logv1.Partition{
+			Id:         uint32(p),
+			Leader:     "local",
+			Replicas:   []string{"local"},
+			NextOffset: l.NextOffset(),
+		})
+	}
+	return partitions, nil
+}
+
+func (r *topicRegistry) Topic(name string) (Topic, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.topics[name]
+	if !ok {
+		return nil, log.ErrTopicNotFound{Name: name}
+	}
+	return t, nil
+}
+
+func (r *topicRegistry) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.topics {
+		for _, l := range t.partitions {
+			if err := l.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *testTopic) Partitions() (uint32, error) {
+	return uint32(len(t.partitions)), nil
+}
+
+func (t *testTopic) Append(record *logv1.Record) (uint32, uint64, error) {
+	p := (t.next.Add(1) - 1) % uint32(len(t.partitions))
+	off, err := t.partitions[p].Append(record)
+	return p, off, err
+}
+
+func (t *testTopic) Partition(p uint32) (CommitLog, error) {
+	if p >= uint32(len(t.partitions)) {
+		return nil, log.ErrPartitionNotFound{Topic: t.meta.Name, Partition: p}
+	}
+	return t.partitions[p], nil
+}
+
+func testTopics(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx := context.Background()
+
+	_, err := rootClient.CreateTopic(ctx, &connect.Request[logv1.CreateTopicRequest]{
+		Msg: &logv1.CreateTopicRequest{
+			Topic: &logv1.Topic{Name: "orders"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = rootClient.CreateTopic(ctx, &connect.Request[logv1.CreateTopicRequest]{
+		Msg: &logv1.CreateTopicRequest{
+			Topic: &logv1.Topic{Name: "orders"},
+		},
+	})
+	require.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+
+	// The topics have their own offsets.
+	for _, topic := range []string{"", "orders"} {
+		produce, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Topic: topic,
+				Record: &logv1.Record{
+					Value: []byte(topic),
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), produce.Msg.Offset)
+	}
+	consume, err := rootClient.Consume(ctx, &connect.Request[logv1.ConsumeRequest]{
+		Msg: &logv1.ConsumeRequest{
+			Topic: "orders",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []byte("orders"), consume.Msg.Record.Value)
+
+	list, err := rootClient.ListTopics(ctx, &connect.Request[logv1.ListTopicsRequest]{
+		Msg: &logv1.ListTopicsRequest{},
+	})
+	require.NoError(t, err)
+	require.Len(t, list.Msg.Topics, 1)
+	require.Equal(t, "orders", list.Msg.Topics[0].Name)
+
+	_, err = rootClient.DeleteTopic(ctx, &connect.Request[logv1.DeleteTopicRequest]{
+		Msg: &logv1.DeleteTopicRequest{
+			Name: "orders",
+		},
+	})
+	require.NoError(t, err)
+	_, err = rootClient.Consume(ctx, &connect.Request[logv1.ConsumeRequest]{
+		Msg: &logv1.ConsumeRequest{
+			Topic: "orders",
+		},
+	})
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+}
+
+func testPartitions(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx := context.Background()
+
+	_, err := rootClient.CreateTopic(ctx, &connect.Request[logv1.CreateTopicRequest]{
+		Msg: &logv1.CreateTopicRequest{
+			Topic: &logv1.Topic{
+				Name:   "events",
+				Config: &logv1.TopicConfig{Partitions: 2},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The partition is chosen by the topic, unless given.
+	produce := func(partition *uint32, value string) *logv1.ProduceResponse {
+		res, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Topic:     "events",
+				Partition: partition,
+				Record: &logv1.Record{
+					Value: []byte(value),
+				},
+			},
+		})
+		require.NoError(t, err)
+		return res.Msg
+	}
+	first, second := produce(nil, "first"), produce(nil, "second")
+	require.Equal(t, []uint32{0, 1}, []uint32{first.Partition, second.Partition})
+	require.Equal(t, []uint64{0, 0}, []uint64{first.Offset, second.Offset})
+	p := uint32(1)
+	third := produce(&p, "third")
+	require.Equal(t, uint32(1), third.Partition)
+	require.Equal(t, uint64(1), third.Offset)
+
+	consume, err := rootClient.Consume(ctx, &connect.Request[logv1.ConsumeRequest]{
+		Msg: &logv1.ConsumeRequest{
+			Topic:     "events",
+			Partition: 1,
+			Offset:    1,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []byte("third"), consume.Msg.Record.Value)
+	_, err = rootClient.Consume(ctx, &connect.Request[logv1.ConsumeRequest]{
+		Msg: &logv1.ConsumeRequest{
+			Topic:     "events",
+			Partition: 2,
+		},
+	})
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+	// The records of every partition are streamed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := rootClient.ConsumeStream(ctx, &connect.Request[logv1.ConsumeStreamRequest]{
+		Msg: &logv1.ConsumeStreamRequest{
+			Topic:         "events",
+			AllPartitions: true,
+		},
+	})
+	require.NoError(t, err)
+	got := make(map[string]uint32)
+	for i := 0; i < 3; i++ {
+		require.True(t, stream.Receive())
+		got[string(stream.Msg().Record.Value)] = stream.Msg().Partition
+	}
+	require.Equal(t, map[string]uint32{"first": 0, "second": 1, "third": 1}, got)
+
+	list, err := rootClient.ListPartitions(ctx, &connect.Request[logv1.ListPartitionsRequest]{
+		Msg: &logv1.ListPartitionsRequest{
+			Topic: "events",
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, list.Msg.Partitions, 2)
+	require.Equal(t, uint64(2), list.Msg.Partitions[1].NextOffset)
+}
+
+func testGroups(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx := context.Background()
+
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Record: &logv1.Record{Value: []byte(value)},
+			},
+		})
+		require.NoError(t, err)
+	}
+	_, err := rootClient.FetchOffset(ctx, &connect.Request[logv1.FetchOffsetRequest]{
+		Msg: &logv1.FetchOffsetRequest{Group: "billing"},
+	})
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	_, err = rootClient.CommitOffset(ctx, &connect.Request[logv1.CommitOffsetRequest]{
+		Msg: &logv1.CommitOffsetRequest{Group: "billing", Offset: 2},
+	})
+	require.NoError(t, err)
+	fetch, err := rootClient.FetchOffset(ctx, &connect.Request[logv1.FetchOffsetRequest]{
+		Msg: &logv1.FetchOffsetRequest{Group: "billing"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), fetch.Msg.Offset)
+
+	// The stream resumes from the offset committed by the group, or from the
+	// offset of the request if the group committed none.
+	for group, want := range map[string]string{"billing": "third", "shipping": "second"} {
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := rootClient.ConsumeStream(ctx, &connect.Request[logv1.ConsumeStreamRequest]{
+			Msg: &logv1.ConsumeStreamRequest{
+				Group:  group,
+				Offset: 1,
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, stream.Receive())
+		require.Equal(t, want, string(stream.Msg().Record.Value))
+		cancel()
+	}
+}
+
+func testConsumeStreamWait(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The record is appended while the stream waits for it: the stream call
+	// returns with the first message sent.
+	produced := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Record: &logv1.Record{Value: []byte("hello world")},
+			},
+		})
+		produced <- err
+	}()
+	stream, err := rootClient.ConsumeStream(ctx, &connect.Request[logv1.ConsumeStreamRequest]{
+		Msg: &logv1.ConsumeStreamRequest{},
+	})
+	require.NoError(t, err)
+	require.True(t, stream.Receive())
+	require.NoError(t, <-produced)
+	require.False(t, stream.Msg().Keepalive)
+	require.Equal(t, "hello world", string(stream.Msg().GetRecord().GetValue()))
+
+	// A keepalive is sent once the stream is idle.
+	require.True(t, stream.Receive())
+	require.True(t, stream.Msg().Keepalive)
+	require.Nil(t, stream.Msg().Record)
+}
+
+func testGetOffsets(
+	t *testing.T,
+	rootClient, _ logv1connect.LogAPIClient,
+) {
+	ctx := context.Background()
+
+	res, err := rootClient.GetOffsets(ctx, &connect.Request[logv1.GetOffsetsRequest]{
+		Msg: &logv1.GetOffsetsRequest{},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), res.Msg.LowestOffset)
+	require.Equal(t, uint64(0), res.Msg.NextOffset)
+
+	for i := 0; i < 2; i++ {
+		_, err := rootClient.Produce(ctx, &connect.Request[logv1.ProduceRequest]{
+			Msg: &logv1.ProduceRequest{
+				Record: &logv1.Record{Value: []byte("hello world")},
+			},
+		})
+		require.NoError(t, err)
+	}
+	res, err = rootClient.GetOffsets(ctx, &connect.Request[logv1.GetOffsetsRequest]{
+		Msg: &logv1.GetOffsetsRequest{},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), res.Msg.LowestOffset)
+	require.Equal(t, uint64(2), res.Msg.NextOffset)
+	// The log of the test is not replicated.
+	require.Nil(t, res.Msg.Replication)
+
+	_, err = rootClient.GetOffsets(ctx, &connect.Request[logv1.GetOffsetsRequest]{
+		Msg: &logv1.GetOffsetsRequest{Partition: 1},
+	})
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+}